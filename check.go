@@ -0,0 +1,207 @@
+package vigilant
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// checkWatch checks a single watch for new commits, and creates a pull request if there are any
+func (e *Engine) checkWatch(ctx context.Context, watch config.RepoConfig) watchResult {
+	logger := e.watchLogger(watch)
+	start := time.Now()
+	defer func() {
+		logger.Debug("Finished check", "duration", time.Since(start))
+	}()
+
+	// Finish the pull request from an earlier check first
+	if err := e.creator.Resume(ctx, watch); err != nil {
+		logger.Error("Could not create pull request", "error", err)
+		return resultFailed
+	}
+
+	data, err := e.changes(ctx, watch)
+	if err != nil {
+		logger.Error("Could not check for changes", "error", err)
+		return resultFailed
+	}
+
+	if data == nil {
+		logger.Info("No new commits found")
+		return resultUpToDate
+	}
+	if e.abandoned(watch, data) {
+		return resultSkipped
+	}
+
+	logger.Info("Found new commits, creating pull request", "commits", len(data.Commits), "base_sha", data.BaseSHA, "head_sha", data.HeadSHA)
+	if err := e.creator.Create(ctx, watch, data); errors.Is(err, pullrequest.ErrUpToDate) {
+		return resultUpToDate
+	} else if err != nil {
+		logger.Error("Could not create pull request", "head_sha", data.HeadSHA, "error", err)
+		return resultFailed
+	}
+	return resultCreated
+}
+
+// checkGroup checks the watches of a group for new commits, and creates one combined pull request
+// for the watches that have any. A group of a single watch is checked by checkWatch.
+func (e *Engine) checkGroup(ctx context.Context, watches []config.RepoConfig) watchResult {
+	if len(watches) == 1 {
+		return e.checkWatch(ctx, watches[0])
+	}
+	logger := e.logger.With("group", watches[0].Group, "target", watches[0].TargetRepoName)
+
+	// Finish the pull request from an earlier check first
+	if err := e.creator.Resume(ctx, watches[0]); err != nil {
+		logger.Error("Could not create pull request", "error", err)
+		return resultFailed
+	}
+
+	// If any watch can not be checked, none of them are, so that the next check includes the changes of all of them
+	var (
+		changed   []config.RepoConfig
+		data      []*pullrequest.TemplateData
+		abandoned bool
+	)
+	for _, watch := range watches {
+		watchData, err := e.changes(ctx, watch)
+		if err != nil {
+			e.watchLogger(watch).Error("Could not check for changes", "group", watch.Group, "error", err)
+			return resultFailed
+		}
+		if watchData != nil && e.abandoned(watch, watchData) {
+			abandoned = true
+		} else if watchData != nil {
+			changed = append(changed, watch)
+			data = append(data, watchData)
+		}
+	}
+
+	if len(changed) == 0 && abandoned {
+		return resultSkipped
+	} else if len(changed) == 0 {
+		logger.Info("No new commits found")
+		return resultUpToDate
+	}
+
+	logger.Info("Found new commits, creating a combined pull request", "watches", len(changed))
+	if err := e.creator.CreateCombined(ctx, changed, data); errors.Is(err, pullrequest.ErrUpToDate) {
+		return resultUpToDate
+	} else if err != nil {
+		logger.Error("Could not create pull request", "error", err)
+		return resultFailed
+	}
+	return resultCreated
+}
+
+// abandoned checks if a pull request for the newest upstream commit of a watch was given up on, in which case
+// it is not tried again until there is a newer upstream commit. This was warned about when it was given up on.
+func (e *Engine) abandoned(watch config.RepoConfig, data *pullrequest.TemplateData) bool {
+	if sha := e.state.Watch(watch.Key()).AbandonedSHA; sha == "" || sha != data.HeadSHA {
+		return false
+	}
+	e.watchLogger(watch).Debug("Skipping the upstream commit that a pull request was given up on", "head_sha", data.HeadSHA)
+	return true
+}
+
+// changes returns the data for a pull request about the new upstream changes of a watch, or nil if there are none.
+// These are the commits to the watched path since the watch was last checked, or those in a new release or tag.
+// For a watch that updates a Go module requirement or a submodule, they are the commits since the version that the target has.
+func (e *Engine) changes(ctx context.Context, watch config.RepoConfig) (*pullrequest.TemplateData, error) {
+	data, err := e.newChanges(ctx, watch)
+	if err != nil || data == nil {
+		return data, err
+	}
+	switch watch.Mode {
+	case config.ModeGoMod:
+		return e.requiredChanges(ctx, watch, data)
+	case config.ModeSubmodule:
+		return e.submoduleChanges(ctx, watch, data)
+	case config.ModeSync:
+		return e.syncChanges(ctx, watch, data)
+	}
+	return data, nil
+}
+
+// changesSince replaces the commits in the data of a watch with the commits from baseSHA, which is the upstream commit
+// that the target has, like the version of the module that it requires. The data is kept as it is if there are
+// no such commits, or if baseSHA is not in the source repository. The release is described as being since previous.
+func (e *Engine) changesSince(ctx context.Context, watch config.RepoConfig, data *pullrequest.TemplateData, baseSHA, previous string) (*pullrequest.TemplateData, error) {
+	if baseSHA == data.HeadSHA {
+		return data, nil
+	}
+	commits, err := e.releaseCommits(ctx, watch, baseSHA, data.HeadSHA)
+	if pullrequest.IsNotFound(err) {
+		e.watchLogger(watch).Warn("The commit of the target is not in the source repository, the commits are listed since the last check", "base_sha", baseSHA)
+		return data, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return data, nil
+	}
+
+	updated := e.creator.TemplateDataBetween(ctx, watch, commits, baseSHA, data.HeadSHA)
+	if data.Release != nil {
+		release := *data.Release
+		release.PreviousTag = previous
+		updated.Release = &release
+	}
+	return updated, nil
+}
+
+// newChanges returns the data for a pull request about the commits to the watched path since the watch was last checked,
+// or those in a new release or tag, or nil if there are none
+func (e *Engine) newChanges(ctx context.Context, watch config.RepoConfig) (*pullrequest.TemplateData, error) {
+	if watch.WatchesReleases() {
+		return e.releaseChanges(ctx, watch)
+	}
+	since := e.state.Watch(watch.Key()).LastChecked
+	if since.IsZero() {
+		since = e.lastChecked
+	}
+	e.watchLogger(watch).Info("Checking for changes", "since", since)
+	newCommits, err := e.checkRepo(ctx, watch.SourceRepoName, watch.WatchedPath(), since)
+	if err != nil || len(newCommits) == 0 {
+		return nil, err
+	}
+	return e.creator.TemplateData(ctx, watch, newCommits), nil
+}
+
+func (e *Engine) checkRepo(ctx context.Context, repoName, filePath string, lastChecked time.Time) ([]*github.RepositoryCommit, error) {
+	owner, repo := config.SplitRepoName(repoName)
+
+	opts := &github.CommitsListOptions{
+		Path:        filePath,
+		Since:       lastChecked,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var commits []*github.RepositoryCommit
+	for {
+		page, resp, err := e.githubClient.Repositories.ListCommits(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	var newCommits []*github.RepositoryCommit
+	for _, commit := range commits {
+		// A commit without a date can not be compared, but the API already only returns commits since lastChecked
+		if date := commit.GetCommit().GetAuthor().GetDate(); date.IsZero() || date.After(lastChecked) {
+			newCommits = append(newCommits, commit)
+		}
+	}
+
+	return newCommits, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/vigilant"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+const usage = `Usage: vigilant [--config FILE] [--state-dir DIR] [--cache-dir DIR] [command]
+
+With no command, vigilant runs as a server and polls the configured repositories.
+
+Options:
+  --config FILE          use this configuration file, instead of looking for config.toml, config.yaml,
+                         config.yml or config.json in /etc/vigilant, ~/.config/vigilant and .
+  --state-dir DIR        keep the state in DIR, instead of state_dir, $STATE_DIRECTORY,
+                         $XDG_STATE_HOME/vigilant or ~/.local/state/vigilant
+  --cache-dir DIR        keep disposable data in DIR, instead of cache_dir, $CACHE_DIRECTORY,
+                         $XDG_CACHE_HOME/vigilant or ~/.cache/vigilant
+
+Commands:
+  template preview [N]   render the templates of all watches, or only watch N, against sample data
+  config check           check the configuration, and that the repositories, paths and branches exist
+                         and the token can push to them, and list all problems
+  check                  check all watches once, create pull requests if needed, and exit
+  gc [-n] [-legacy]      delete the branches of merged or closed pull requests, -n only lists them,
+                         -legacy also deletes untracked *-update-YYYYMMDD-HHMMSS branches
+  help                   show this help text`
+
+// runCommand runs the subcommand given on the command line
+func runCommand(args []string) error {
+	switch args[0] {
+	case "template":
+		if len(args) < 2 || args[1] != "preview" {
+			return errors.New("usage: vigilant template preview [N]")
+		}
+		return previewTemplates(args[2:])
+	case "config":
+		if len(args) != 2 || args[1] != "check" {
+			return errors.New("usage: vigilant config check")
+		}
+		return checkConfig()
+	case "check":
+		return checkOnce()
+	case "gc":
+		return collectGarbage(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return nil
+	default:
+		return fmt.Errorf("unknown command: %s\n\n%s", args[0], usage)
+	}
+}
+
+// previewTemplates renders the templates of the configured watches against sample data
+func previewTemplates(args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+
+	watches := cfg.Watches()
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(watches) {
+			return fmt.Errorf("watch number must be between 1 and %d", len(watches))
+		}
+		watches = watches[n-1 : n]
+	}
+
+	now := time.Now()
+	for i, watch := range watches {
+		templates, err := pullrequest.ParseTemplates(watch.Templates.Merge(cfg.Templates))
+		if err != nil {
+			return err
+		}
+		text, err := templates.Render(pullrequest.SampleData(watch, now))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("=== %s (%s) -> %s ===\n", watch.SourceRepoName, watch.FilePath, watch.TargetRepoName)
+		fmt.Printf("Branch: %s\n", text.Branch)
+		fmt.Printf("Title: %s\n", text.Title)
+		fmt.Printf("Commit message:\n%s\n", text.CommitMessage)
+		fmt.Printf("Body:\n%s\n", text.Body)
+	}
+	return nil
+}
+
+// checkConfig lists all problems with the configuration, and fails if there are any
+func checkConfig() error {
+	cfg, err := config.Read(configFile)
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	// A log setting that is not valid is listed as a problem
+	setupLogging(cfg.Log, cfg.Secrets()...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	problems := vigilant.CheckConfig(ctx, cfg)
+	for _, problem := range problems {
+		fmt.Println(problem.Error())
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems in the configuration", len(problems))
+	}
+	fmt.Printf("%s: the configuration is valid\n", cfg.File())
+	return nil
+}
+
+// checkOnce checks all watches once, and then exits
+func checkOnce() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	engine, err := newEngine(cfg)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+	if err := engine.TryLead(); err != nil {
+		return err
+	}
+
+	// Cancel the check on Ctrl-C, which also rolls back partially created pull requests
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return engine.CheckOnce(ctx)
+}
+
+// collectGarbage deletes stale branches once, and then exits
+func collectGarbage(args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	dryRun := flags.Bool("n", false, "only list the branches that would be deleted")
+	legacy := flags.Bool("legacy", false, "also delete untracked branches created by older versions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	engine, err := newEngine(cfg)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+	if err := engine.TryLead(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	engine.CollectGarbage(ctx, *dryRun)
+	if *legacy {
+		return engine.CollectLegacyBranches(ctx, *dryRun)
+	}
+	return nil
+}
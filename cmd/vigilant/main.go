@@ -0,0 +1,130 @@
+// Command vigilant watches files and directories in GitHub repositories,
+// and opens a pull request in a target repository when they change
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/xyproto/vigilant"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/systemd"
+)
+
+var (
+	// configFile is the path given with --config, or empty to look for a configuration file
+	configFile string
+
+	// stateDir and cacheDir are given with --state-dir and --cache-dir, or empty to use the configured directories
+	stateDir, cacheDir string
+)
+
+func main() {
+	// Log at the default level until the configuration is loaded
+	setupLogging(config.LogConfig{})
+
+	flag.StringVar(&configFile, "config", "", "the configuration file")
+	flag.StringVar(&stateDir, "state-dir", "", "the directory to keep the state in")
+	flag.StringVar(&cacheDir, "cache-dir", "", "the directory to keep disposable data in")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	// Handle subcommands, like "vigilant template preview"
+	if flag.NArg() > 0 {
+		if err := runCommand(flag.Args()); err != nil {
+			fatal(err.Error())
+		}
+		return
+	}
+
+	// Load and validate configuration
+	cfg, err := loadConfig()
+	if err != nil {
+		fatal("Error loading config", "error", err)
+	}
+
+	engine, err := newEngine(cfg)
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer engine.Close()
+
+	slog.Info("Polling for changes", "interval", time.Duration(cfg.PollInterval)*time.Minute)
+
+	// Set up signal handling for manual checks and graceful shutdown
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1, syscall.SIGTERM, syscall.SIGINT)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+
+	go func() {
+		for sig := range sigs {
+			switch sig {
+			case syscall.SIGUSR1:
+				slog.Info("Received SIGUSR1, manually triggering repository check")
+				engine.TriggerCheck()
+			case syscall.SIGTERM, syscall.SIGINT:
+				slog.Info("Received termination signal, shutting down", "signal", sig.String())
+				stop()
+				return
+			}
+		}
+	}()
+
+	// Serve the control endpoint on the sockets that systemd passed, or else on the configured address
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		fatal("Could not use the sockets from systemd", "error", err)
+	}
+	if len(listeners) == 0 && cfg.Control.Listen != "" {
+		ln, err := net.Listen("tcp", cfg.Control.Listen)
+		if err != nil {
+			fatal("Could not listen for the control endpoint", "error", err)
+		}
+		listeners = append(listeners, ln)
+	}
+	for _, ln := range listeners {
+		go func() {
+			if err := engine.Serve(ctx, ln); err != nil {
+				slog.Error("Control endpoint stopped", "address", ln.Addr().String(), "error", err)
+			}
+		}()
+	}
+
+	// Run the engine
+	engine.Run(ctx)
+}
+
+// newEngine creates an engine, with the directories that are given on the command line
+func newEngine(cfg *config.Config) (*vigilant.Engine, error) {
+	var opts []vigilant.Option
+	if stateDir != "" {
+		opts = append(opts, vigilant.WithStateDir(stateDir))
+	}
+	if cacheDir != "" {
+		opts = append(opts, vigilant.WithCacheDir(cacheDir))
+	}
+	return vigilant.New(cfg, opts...)
+}
+
+// loadConfig loads and validates the configuration, and sets up logging as configured
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := setupLogging(cfg.Log, cfg.Secrets()...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
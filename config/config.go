@@ -0,0 +1,784 @@
+// Package config loads and validates the vigilant configuration: the global settings,
+// and the watches, which are the upstream paths to watch and where to open pull requests.
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/xyproto/vigilant/semver"
+)
+
+// RepoConfig is a watch: a file or directory in a source repository,
+// and the target repository that pull requests are opened in when it changes.
+// A watch with Targets opens pull requests in every target, see Config.Watches.
+type RepoConfig struct {
+	SourceRepoName        string            `mapstructure:"source_repo_name"`
+	FilePath              string            `mapstructure:"file_path"`
+	TargetRepoName        string            `mapstructure:"target_repo_name"`
+	PullRequestBaseBranch string            `mapstructure:"pull_request_base_branch"`
+	TargetPath            string            `mapstructure:"target_path"` // the notification file in the target, see DestinationPath
+	Mode                  string            `mapstructure:"mode"`        // what the pull requests change in the target, see ModeNotify
+	Include               []string          `mapstructure:"include"`     // globs of the files that a watch in sync mode syncs, all by default
+	Exclude               []string          `mapstructure:"exclude"`     // globs of the files that a watch in sync mode leaves alone
+	Transforms            []TransformConfig `mapstructure:"transforms"`  // applied in order to the files of a watch in sync mode
+	Targets               []TargetConfig    `mapstructure:"targets"`
+	Group                 string            `mapstructure:"group"`       // watches in the same group share one pull request per target
+	Trigger               string            `mapstructure:"trigger"`     // commits, releases or tags, see TriggerCommits
+	TagPattern            string            `mapstructure:"tag_pattern"` // a glob that the tags must match, like v*
+	Versions              string            `mapstructure:"versions"`    // a constraint that the versions must satisfy, like ">= 9.1, < 10"
+	Prereleases           bool              `mapstructure:"prereleases"` // also pre-releases, which are skipped by default
+	PollInterval          int               `mapstructure:"poll_interval"`
+	Templates             TemplateConfig    `mapstructure:"templates"`
+	Labels                []string          `mapstructure:"labels"`
+	Assignees             []string          `mapstructure:"assignees"`
+	Reviewers             []string          `mapstructure:"reviewers"`
+	TeamReviewers         []string          `mapstructure:"team_reviewers"`
+	Milestone             string            `mapstructure:"milestone"`
+	Draft                 bool              `mapstructure:"draft"`
+	KeepSuperseded        bool              `mapstructure:"keep_superseded"`
+	Commit                CommitConfig      `mapstructure:"commit"`
+	Fork                  bool              `mapstructure:"fork"`
+	ForkRepoName          string            `mapstructure:"fork_repo_name"`
+
+	fannedOut bool // expanded from Targets, so the key includes the base branch and the destination path
+}
+
+// The triggers of a watch, which is what it opens pull requests for
+const (
+	TriggerCommits  = "commits"  // new commits that change the watched path, the default
+	TriggerReleases = "releases" // new GitHub releases that change the watched path since the previous release
+	TriggerTags     = "tags"     // new tags that change the watched path since the previous tag
+)
+
+// The modes of a watch, which is what its pull requests change in the target
+const (
+	ModeNotify    = "notify"    // add a notification file about the changes, the default
+	ModePKGBUILD  = "pkgbuild"  // update the version and checksums of a PKGBUILD to a new release, and its .SRCINFO
+	ModeGoMod     = "gomod"     // update the requirement of the watched Go module in a go.mod, and its go.sum
+	ModeSubmodule = "submodule" // point a submodule of the source repository to the new upstream commit
+	ModeSync      = "sync"      // copy the watched directory into a directory in the target, with a manifest
+)
+
+// TargetConfig is one of the targets of a watch that fans out to several targets.
+// Empty fields fall back to the fields of the watch.
+type TargetConfig struct {
+	RepoName   string `mapstructure:"repo_name"`
+	BaseBranch string `mapstructure:"base_branch"`
+	Path       string `mapstructure:"path"`
+	Group      string `mapstructure:"group"`
+	Mode       string `mapstructure:"mode"`
+}
+
+// The types of the transforms of the files of a watch in sync mode
+const (
+	TransformReplace     = "replace"      // replace the matches of a regular expression
+	TransformPrepend     = "prepend"      // add a header, like a license or where the file came from
+	TransformAppend      = "append"       // add a footer
+	TransformLineEndings = "line_endings" // convert the line endings to LF or CRLF
+	TransformFilter      = "filter"       // pipe the file through a command
+)
+
+// TransformConfig is a change to the upstream files of a watch in sync mode, before they are committed
+type TransformConfig struct {
+	Type        string   `mapstructure:"type"`         // see TransformReplace
+	Files       []string `mapstructure:"files"`        // globs of the files to transform, like include, all files by default
+	Pattern     string   `mapstructure:"pattern"`      // the regular expression of a replace
+	Replacement string   `mapstructure:"replacement"`  // the replacement of a replace, where $1 is the first group
+	Text        string   `mapstructure:"text"`         // the header or footer, a template with .Repo and .Path
+	LineEndings string   `mapstructure:"line_endings"` // lf or crlf
+	Command     []string `mapstructure:"command"`      // the command of a filter, which reads the file from stdin and writes it to stdout
+}
+
+// Transforms checks if a transform changes the file with the given path, relative to the synced directory
+func (t TransformConfig) Transforms(rel string) bool {
+	if len(t.Files) == 0 {
+		return true
+	}
+	for _, pattern := range t.Files {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the complete configuration
+type Config struct {
+	PollInterval      int            `mapstructure:"poll_interval"`
+	BranchGracePeriod int            `mapstructure:"branch_grace_period"`
+	Workers           int            `mapstructure:"workers"`
+	APITimeout        int            `mapstructure:"api_timeout"`
+	ShutdownTimeout   int            `mapstructure:"shutdown_timeout"`
+	MaxAttempts       int            `mapstructure:"max_attempts"`
+	StateDir          string         `mapstructure:"state_dir"` // durable data, relative to the configuration file
+	CacheDir          string         `mapstructure:"cache_dir"` // disposable data, relative to the configuration file
+	GoProxy           string         `mapstructure:"go_proxy"`  // the Go module proxy of watches with mode = gomod
+	Control           ControlConfig  `mapstructure:"control"`
+	LeaderElection    LeaderConfig   `mapstructure:"leader_election"`
+	Log               LogConfig      `mapstructure:"log"`
+	Templates         TemplateConfig `mapstructure:"templates"`
+	Commit            CommitConfig   `mapstructure:"commit"`
+	Repos             []RepoConfig   `mapstructure:"repos"`
+
+	file        string              // the configuration file
+	positions   map[string]Position // where each field is set, by the path of the field
+	unknownKeys []string            // the keys in the files that are not settings
+}
+
+// TemplateConfig holds the Go text/template sources used when creating a pull request.
+// Empty fields fall back to the global templates, and then to the built-in defaults.
+type TemplateConfig struct {
+	Branch        string `mapstructure:"branch"`
+	Title         string `mapstructure:"title"`
+	Body          string `mapstructure:"body"`
+	CommitMessage string `mapstructure:"commit_message"`
+}
+
+// CommitConfig configures the identity of generated commits and how they are signed.
+// Empty fields fall back to the global commit configuration.
+type CommitConfig struct {
+	AuthorName           string `mapstructure:"author_name"`
+	AuthorEmail          string `mapstructure:"author_email"`
+	CommitterName        string `mapstructure:"committer_name"`
+	CommitterEmail       string `mapstructure:"committer_email"`
+	SigningKey           string `mapstructure:"signing_key"`            // path to an ASCII armored private PGP key
+	SigningKeyPassphrase string `mapstructure:"signing_key_passphrase"` // falls back to $VIGILANT_SIGNING_KEY_PASSPHRASE
+}
+
+// ControlConfig configures the HTTP endpoint for triggering checks and receiving GitHub webhooks.
+// When vigilant is socket activated by systemd, the endpoint is served on the passed sockets instead of Listen.
+type ControlConfig struct {
+	Listen        string `mapstructure:"listen"`         // like 127.0.0.1:8080, or empty to not listen
+	Token         string `mapstructure:"token"`          // the bearer token for /check, which is then only allowed from loopback addresses and Unix sockets if empty
+	WebhookSecret string `mapstructure:"webhook_secret"` // the secret of the GitHub webhook, which enables /webhook
+}
+
+// LeaderConfig configures leader election between instances that share a state directory,
+// where only the leader checks the watches, and a standby takes over when the leader stops
+type LeaderConfig struct {
+	Enabled       bool   `mapstructure:"enabled"`
+	LeaseDuration int    `mapstructure:"lease_duration"` // in seconds, how long a leader that stops renewing keeps the lease
+	ID            string `mapstructure:"id"`             // the name of this instance, defaults to the host name and process ID
+}
+
+// LogConfig configures the log output
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug, info, warn or error
+	Format string `mapstructure:"format"` // text or json
+}
+
+// Validate checks that the configuration is complete and consistent, and returns all problems that it finds.
+// The templates are checked when they are parsed, by vigilant.New.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, problem := range c.Problems() {
+		errs = append(errs, problem)
+	}
+	return errors.Join(errs...)
+}
+
+// Problems checks that the configuration is complete and consistent, without contacting GitHub
+func (c *Config) Problems() []Problem {
+	var problems []Problem
+	for _, key := range c.unknownKeys {
+		problems = append(problems, c.Problemf(key, "unknown setting"))
+	}
+	if c.PollInterval <= 0 {
+		problems = append(problems, c.Problemf("poll_interval", "must be greater than zero"))
+	}
+	if c.Workers <= 0 {
+		problems = append(problems, c.Problemf("workers", "must be greater than zero"))
+	}
+	if c.APITimeout <= 0 {
+		problems = append(problems, c.Problemf("api_timeout", "must be greater than zero"))
+	}
+	if c.ShutdownTimeout < 0 {
+		problems = append(problems, c.Problemf("shutdown_timeout", "can not be negative"))
+	}
+	if c.MaxAttempts < 1 {
+		problems = append(problems, c.Problemf("max_attempts", "must be at least 1"))
+	}
+	if _, err := c.Log.SlogLevel(); err != nil {
+		problems = append(problems, c.Problemf("log.level", "%v", err))
+	} else if err := c.Log.Validate(); err != nil {
+		problems = append(problems, c.Problemf("log.format", "%v", err))
+	}
+	if c.LeaderElection.Enabled && c.LeaderElection.LeaseDuration <= 0 {
+		problems = append(problems, c.Problemf("leader_election.lease_duration", "must be greater than zero"))
+	}
+	if u, err := url.Parse(c.GoProxy); c.GoProxy != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		problems = append(problems, c.Problemf("go_proxy", "must be an http or https URL, got %q", c.GoProxy))
+	}
+	if c.BranchGracePeriod < 0 {
+		problems = append(problems, c.Problemf("branch_grace_period", "can not be negative"))
+	}
+	if len(c.Repos) == 0 {
+		problems = append(problems, c.Problemf("repos", "at least one repo configuration is required"))
+	}
+	for i, repo := range c.Repos {
+		field := func(name string) string {
+			return fmt.Sprintf("repos[%d].%s", i, name)
+		}
+		required := []struct{ name, value string }{
+			{"source_repo_name", repo.SourceRepoName},
+			{"file_path", repo.FilePath},
+		}
+		if len(repo.Targets) == 0 {
+			required = append(required, []struct{ name, value string }{
+				{"target_repo_name", repo.TargetRepoName},
+				{"pull_request_base_branch", repo.PullRequestBaseBranch},
+			}...)
+		} else if repo.TargetRepoName != "" {
+			problems = append(problems, c.Problemf(field("target_repo_name"), "can not be used together with targets"))
+		}
+		for _, required := range required {
+			if required.value == "" {
+				problems = append(problems, c.Problemf(fmt.Sprintf("repos[%d]", i), "%s is required", required.name))
+			}
+		}
+		names := []struct{ name, value string }{
+			{"source_repo_name", repo.SourceRepoName},
+			{"target_repo_name", repo.TargetRepoName},
+			{"fork_repo_name", repo.ForkRepoName},
+		}
+		paths := []struct{ name, value string }{
+			{"file_path", repo.FilePath},
+			{"target_path", repo.TargetPath},
+		}
+		for j, target := range repo.Targets {
+			targetField := fmt.Sprintf("targets[%d]", j)
+			if target.RepoName == "" {
+				problems = append(problems, c.Problemf(field(targetField), "repo_name is required"))
+			}
+			if target.BaseBranch == "" && repo.PullRequestBaseBranch == "" {
+				problems = append(problems, c.Problemf(field(targetField), "base_branch is required, unless the watch has a pull_request_base_branch"))
+			}
+			names = append(names, struct{ name, value string }{targetField + ".repo_name", target.RepoName})
+			paths = append(paths, struct{ name, value string }{targetField + ".path", target.Path})
+		}
+		// A target that is listed twice would get the same pull requests twice
+		watches := repo.Expand()
+		for j := range repo.Targets {
+			for k := range j {
+				if watches[j].Key() == watches[k].Key() {
+					problems = append(problems, c.Problemf(field(fmt.Sprintf("targets[%d]", j)), "is the same target as targets[%d]", k))
+				}
+			}
+		}
+		for _, name := range names {
+			if name.value == "" {
+				continue
+			}
+			if _, _, err := ParseRepoName(name.value); err != nil {
+				problems = append(problems, c.Problemf(field(name.name), "%v", err))
+			}
+		}
+		for _, path := range paths {
+			if strings.HasPrefix(path.value, "/") {
+				problems = append(problems, c.Problemf(field(path.name), "must be relative to the root of the repository"))
+			}
+		}
+		if repo.PollInterval < 0 {
+			problems = append(problems, c.Problemf(field("poll_interval"), "can not be negative"))
+		}
+		problems = append(problems, c.triggerProblems(repo, field)...)
+		for _, globs := range []struct {
+			name     string
+			patterns []string
+		}{{"include", repo.Include}, {"exclude", repo.Exclude}} {
+			for _, pattern := range globs.patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					problems = append(problems, c.Problemf(field(globs.name), "invalid pattern %q: %v", pattern, err))
+				}
+			}
+		}
+		problems = append(problems, c.transformProblems(repo, field)...)
+		modeField := func(j int) string { return field("mode") }
+		if len(repo.Targets) > 0 {
+			modeField = func(j int) string {
+				if repo.Targets[j].Mode == "" {
+					return field("mode")
+				}
+				return field(fmt.Sprintf("targets[%d].mode", j))
+			}
+		}
+		for j, watch := range watches {
+			if problem, ok := c.modeProblem(watch, modeField(j)); ok && !slices.Contains(problems, problem) {
+				problems = append(problems, problem)
+			}
+		}
+		if commit := repo.Commit.Merge(c.Commit); commit.SigningKey != "" {
+			if _, err := os.Stat(commit.SigningKey); err != nil {
+				keyField := "commit.signing_key"
+				if repo.Commit.SigningKey != "" {
+					keyField = field(keyField)
+				}
+				problems = append(problems, c.Problemf(keyField, "%v", err))
+			}
+		}
+	}
+	return append(problems, c.groupProblems()...)
+}
+
+// groupProblems checks that the watches of every group can share a pull request. Watches that change a file in the
+// same mode build their changes on each other, but a submodule or a synced directory can only be changed by one watch
+// of a group, and a file can not be changed by watches with different modes.
+func (c *Config) groupProblems() []Problem {
+	type member struct {
+		field string
+		watch RepoConfig
+	}
+	var problems []Problem
+	groups := make(map[string][]member)
+	for i, repo := range c.Repos {
+		for j, watch := range repo.Expand() {
+			if watch.Group == "" {
+				continue
+			}
+			field := fmt.Sprintf("repos[%d].group", i)
+			if len(repo.Targets) > 0 && repo.Targets[j].Group != "" {
+				field = fmt.Sprintf("repos[%d].targets[%d].group", i, j)
+			}
+			key := watch.GroupKey()
+			for _, other := range groups[key] {
+				if watch.conflicts(other.watch) {
+					problems = append(problems, c.Problemf(field, "%s is also changed by the watch of %s, which is in the same group",
+						watch.DestinationPath(), strings.TrimSuffix(other.field, ".group")))
+				}
+			}
+			groups[key] = append(groups[key], member{field, watch})
+		}
+	}
+	return problems
+}
+
+// conflicts checks if two watches change the same path, or a path in a directory that the other watch changes,
+// in a way that can not be built on each other
+func (r RepoConfig) conflicts(other RepoConfig) bool {
+	a, b := strings.Trim(r.DestinationPath(), "/"), strings.Trim(other.DestinationPath(), "/")
+	if a != b && !strings.HasPrefix(a, b+"/") && !strings.HasPrefix(b, a+"/") {
+		return false
+	}
+	mode, otherMode := cmp.Or(r.Mode, ModeNotify), cmp.Or(other.Mode, ModeNotify)
+	return mode != otherMode || mode == ModeSubmodule || mode == ModeSync
+}
+
+// triggerProblems checks the trigger of a watch, and the settings that select its releases or tags
+func (c *Config) triggerProblems(repo RepoConfig, field func(string) string) []Problem {
+	var problems []Problem
+	switch repo.Trigger {
+	case "", TriggerCommits:
+		for _, setting := range []struct {
+			name string
+			set  bool
+		}{
+			{"tag_pattern", repo.TagPattern != ""},
+			{"versions", repo.Versions != ""},
+			{"prereleases", repo.Prereleases},
+		} {
+			if setting.set {
+				problems = append(problems, c.Problemf(field(setting.name), "is only used with trigger = %s or %s", TriggerReleases, TriggerTags))
+			}
+		}
+	case TriggerReleases, TriggerTags:
+	default:
+		problems = append(problems, c.Problemf(field("trigger"), "unknown trigger %q, must be %s, %s or %s", repo.Trigger, TriggerCommits, TriggerReleases, TriggerTags))
+	}
+	if _, err := path.Match(repo.TagPattern, ""); err != nil {
+		problems = append(problems, c.Problemf(field("tag_pattern"), "invalid pattern %q: %v", repo.TagPattern, err))
+	}
+	if _, err := semver.ParseConstraint(repo.Versions); err != nil {
+		problems = append(problems, c.Problemf(field("versions"), "%v", err))
+	}
+	return problems
+}
+
+// transformProblems checks the transforms of a watch
+func (c *Config) transformProblems(repo RepoConfig, field func(string) string) []Problem {
+	var problems []Problem
+	if len(repo.Transforms) > 0 && !slices.ContainsFunc(repo.Expand(), func(watch RepoConfig) bool { return watch.Mode == ModeSync }) {
+		problems = append(problems, c.Problemf(field("transforms"), "are only used with mode = %s", ModeSync))
+	}
+	for i, t := range repo.Transforms {
+		transformField := func(name string) string {
+			return field(fmt.Sprintf("transforms[%d].%s", i, name))
+		}
+		for _, pattern := range t.Files {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, c.Problemf(transformField("files"), "invalid pattern %q: %v", pattern, err))
+			}
+		}
+		switch t.Type {
+		case TransformReplace:
+			if t.Pattern == "" {
+				problems = append(problems, c.Problemf(transformField("pattern"), "is required for type = %s", t.Type))
+			} else if _, err := regexp.Compile(t.Pattern); err != nil {
+				problems = append(problems, c.Problemf(transformField("pattern"), "%v", err))
+			}
+		case TransformPrepend, TransformAppend:
+			if t.Text == "" {
+				problems = append(problems, c.Problemf(transformField("text"), "is required for type = %s", t.Type))
+			} else if _, err := template.New("text").Parse(t.Text); err != nil {
+				problems = append(problems, c.Problemf(transformField("text"), "%v", err))
+			}
+		case TransformLineEndings:
+			if t.LineEndings != "lf" && t.LineEndings != "crlf" {
+				problems = append(problems, c.Problemf(transformField("line_endings"), "must be lf or crlf, got %q", t.LineEndings))
+			}
+		case TransformFilter:
+			if len(t.Command) == 0 || t.Command[0] == "" {
+				problems = append(problems, c.Problemf(transformField("command"), "is required for type = %s", t.Type))
+			}
+		default:
+			problems = append(problems, c.Problemf(transformField("type"), "unknown type %q, must be %s, %s, %s, %s or %s",
+				t.Type, TransformReplace, TransformPrepend, TransformAppend, TransformLineEndings, TransformFilter))
+		}
+	}
+	return problems
+}
+
+// modeProblem checks the mode of a watch, which may be set for the watch or for one of its targets
+func (c *Config) modeProblem(watch RepoConfig, field string) (Problem, bool) {
+	switch watch.Mode {
+	case "", ModeNotify, ModeGoMod, ModeSubmodule:
+	case ModeSync:
+		if dir := strings.Trim(watch.DestinationPath(), "/"); dir == "" || dir == "." {
+			return c.Problemf(field, "mode = %s needs a target_path, since the target directory can not be the root", watch.Mode), true
+		}
+	case ModePKGBUILD:
+		if !watch.WatchesReleases() {
+			return c.Problemf(field, "mode = %s needs trigger = %s or %s", watch.Mode, TriggerReleases, TriggerTags), true
+		}
+	default:
+		return c.Problemf(field, "unknown mode %q, must be %s, %s, %s, %s or %s", watch.Mode, ModeNotify, ModePKGBUILD, ModeGoMod, ModeSubmodule, ModeSync), true
+	}
+	return Problem{}, false
+}
+
+// Watches returns the watches, where every watch with targets is replaced by one watch per target
+func (c *Config) Watches() []RepoConfig {
+	var watches []RepoConfig
+	for _, repo := range c.Repos {
+		watches = append(watches, repo.Expand()...)
+	}
+	return watches
+}
+
+// Expand returns one watch per target of a watch with targets, or the watch itself
+func (r RepoConfig) Expand() []RepoConfig {
+	if len(r.Targets) == 0 {
+		return []RepoConfig{r}
+	}
+	var watches []RepoConfig
+	for _, target := range r.Targets {
+		watch := r
+		watch.Targets = nil
+		watch.fannedOut = true
+		watch.TargetRepoName = target.RepoName
+		if target.BaseBranch != "" {
+			watch.PullRequestBaseBranch = target.BaseBranch
+		}
+		if target.Path != "" {
+			watch.TargetPath = target.Path
+		}
+		if target.Group != "" {
+			watch.Group = target.Group
+		}
+		if target.Mode != "" {
+			watch.Mode = target.Mode
+		}
+		watches = append(watches, watch)
+	}
+	return watches
+}
+
+// Secrets returns the configured secrets, which must never be logged
+func (c *Config) Secrets() []string {
+	secrets := []string{c.Commit.SigningKeyPassphrase, c.Control.Token, c.Control.WebhookSecret}
+	for _, repo := range c.Repos {
+		secrets = append(secrets, repo.Commit.SigningKeyPassphrase)
+	}
+	return secrets
+}
+
+// SplitRepoName splits a repository name of the form owner/name. Validate checks that all names have this form.
+func SplitRepoName(fullRepoName string) (owner, repo string) {
+	owner, repo, _ = strings.Cut(fullRepoName, "/")
+	return owner, repo
+}
+
+var (
+	// ownerPattern matches GitHub user and organization names
+	ownerPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]{0,38})$`)
+
+	// repoNamePattern matches GitHub repository names
+	repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,100}$`)
+)
+
+// ParseRepoName parses a repository name, which is either owner/name, or the URL of a repository on github.com,
+// like https://github.com/owner/name, https://github.com/owner/name.git or git@github.com:owner/name.git
+func ParseRepoName(name string) (owner, repo string, err error) {
+	s := strings.TrimSpace(name)
+	if rest, ok := strings.CutPrefix(s, "git@"); ok {
+		host, path, _ := strings.Cut(rest, ":")
+		s = host + "/" + path
+	} else if i := strings.Index(s, "://"); i >= 0 {
+		s = s[i+len("://"):]
+		if _, rest, ok := strings.Cut(s, "@"); ok {
+			s = rest
+		}
+	}
+	if host, path, ok := strings.Cut(s, "/"); ok && strings.Contains(host, ".") {
+		if host != "github.com" && host != "www.github.com" {
+			return "", "", fmt.Errorf("invalid repository %q, only repositories on github.com are supported", name)
+		}
+		s = path
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "/"), ".git")
+
+	owner, repo, ok := strings.Cut(s, "/")
+	if !ok || strings.Contains(repo, "/") {
+		return "", "", fmt.Errorf("invalid repository %q, must be owner/name", name)
+	}
+	if !ownerPattern.MatchString(owner) {
+		return "", "", fmt.Errorf("invalid repository %q, %q is not a valid user or organization name", name, owner)
+	}
+	if !repoNamePattern.MatchString(repo) || repo == "." || repo == ".." {
+		return "", "", fmt.Errorf("invalid repository %q, %q is not a valid repository name", name, repo)
+	}
+	return owner, repo, nil
+}
+
+// normalize replaces the repository URLs in the watches with owner/name.
+// Invalid names are left as they are, to be reported by Validate.
+func (c *Config) normalize() {
+	for i := range c.Repos {
+		names := []*string{&c.Repos[i].SourceRepoName, &c.Repos[i].TargetRepoName, &c.Repos[i].ForkRepoName}
+		for j := range c.Repos[i].Targets {
+			names = append(names, &c.Repos[i].Targets[j].RepoName)
+		}
+		for _, name := range names {
+			if owner, repo, err := ParseRepoName(*name); *name != "" && err == nil {
+				*name = owner + "/" + repo
+			}
+		}
+	}
+}
+
+// Key returns a string that identifies the watch, for use in the state file.
+// The targets of a watch may share a repository, so their keys also include the base branch and the destination path.
+func (r RepoConfig) Key() string {
+	key := fmt.Sprintf("%s:%s->%s", r.SourceRepoName, r.FilePath, r.TargetRepoName)
+	if r.fannedOut {
+		key += fmt.Sprintf("@%s:%s", r.PullRequestBaseBranch, r.DestinationPath())
+	}
+	return key
+}
+
+// GroupKey returns a string that identifies the pull requests of the watch. Watches in the same group,
+// with the same target and base branch, share one pull request, and the key of the watch is used otherwise.
+func (r RepoConfig) GroupKey() string {
+	if r.Group == "" {
+		return r.Key()
+	}
+	return fmt.Sprintf("group:%s->%s@%s", r.Group, r.TargetRepoName, r.PullRequestBaseBranch)
+}
+
+// DestinationPath returns the path of the notification file in the target repository,
+// which defaults to the watched path with dashes instead of slashes, followed by -updates.md.
+// For a watch that updates a PKGBUILD, it is the PKGBUILD, which defaults to the one at the root,
+// for a watch that updates a Go module requirement, it is the go.mod, which also defaults to the one at the root,
+// for a watch that updates a submodule, it is the submodule, which defaults to the name of the source repository,
+// and for a watch that syncs a directory, it is the target directory, which defaults to the watched directory.
+func (r RepoConfig) DestinationPath() string {
+	if r.TargetPath != "" {
+		return r.TargetPath
+	}
+	switch r.Mode {
+	case ModePKGBUILD:
+		return "PKGBUILD"
+	case ModeGoMod:
+		return "go.mod"
+	case ModeSubmodule:
+		_, name := SplitRepoName(r.SourceRepoName)
+		return name
+	case ModeSync:
+		return r.WatchedPath()
+	}
+	return strings.ReplaceAll(r.FilePath, "/", "-") + "-updates.md"
+}
+
+// WatchedPath returns the watched path without a trailing slash, which is empty if the whole repository is watched,
+// with file_path = "."
+func (r RepoConfig) WatchedPath() string {
+	if p := strings.TrimSuffix(r.FilePath, "/"); p != "." {
+		return p
+	}
+	return ""
+}
+
+// DisplayPath returns the watched path as it is named in pull requests, which is the source repository
+// if the whole repository is watched
+func (r RepoConfig) DisplayPath() string {
+	if r.WatchedPath() == "" {
+		return r.SourceRepoName
+	}
+	return r.FilePath
+}
+
+// Watches checks if the given filename is the watched path, or is inside of it if it is a directory
+func (r RepoConfig) Watches(filename string) bool {
+	path := r.WatchedPath()
+	return path == "" || filename == path || strings.HasPrefix(filename, path+"/")
+}
+
+// Syncs checks if a watch in sync mode syncs a file, given by its path relative to the watched directory.
+// A file is synced if it matches one of the include globs, or if there are none, and no exclude glob.
+func (r RepoConfig) Syncs(rel string) bool {
+	included := len(r.Include) == 0
+	for _, pattern := range r.Include {
+		included = included || matchGlob(pattern, rel)
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range r.Exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob checks if a glob matches a relative path, or one of the directories that it is in.
+// A glob without a slash matches the name of the file or directory at any depth, like in .gitignore.
+func matchGlob(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anyDepth := !strings.Contains(pattern, "/")
+	for ; name != "." && name != "/"; name = path.Dir(name) {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(name)); ok && anyDepth {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchesReleases checks if the watch opens pull requests for releases or tags, instead of for commits
+func (r RepoConfig) WatchesReleases() bool {
+	return r.Trigger == TriggerReleases || r.Trigger == TriggerTags
+}
+
+// MatchTag checks if a release or tag is one that the watch opens pull requests for, and returns its version.
+// The tag must match the tag pattern, and the rest of the tag after the text before the first wildcard
+// of the pattern must be a version that satisfies the version constraint, like 9.1.0123 for v9.1.0123
+// or vim-9.1.0123 with the pattern vim-*. Pre-releases are only matched if the watch allows them.
+func (r RepoConfig) MatchTag(tag string) (semver.Version, bool) {
+	if r.TagPattern != "" {
+		if ok, err := path.Match(r.TagPattern, tag); err != nil || !ok {
+			return semver.Version{}, false
+		}
+	}
+	version, err := semver.Parse(r.TagVersion(tag))
+	if err != nil || (version.IsPrerelease() && !r.Prereleases) {
+		return semver.Version{}, false
+	}
+	constraint, err := semver.ParseConstraint(r.Versions)
+	if err != nil || !constraint.Check(version) {
+		return semver.Version{}, false
+	}
+	version.Original = tag
+	return version, true
+}
+
+// TagVersion returns the version in a release or tag, which is the rest of the tag after the text
+// before the first wildcard of the tag pattern, like 9.1.0123 for vim-9.1.0123 with the pattern vim-*
+func (r RepoConfig) TagVersion(tag string) string {
+	prefix := ""
+	if i := strings.IndexAny(r.TagPattern, `*?[\`); i >= 0 {
+		prefix = r.TagPattern[:i]
+	}
+	return strings.TrimPrefix(tag, prefix)
+}
+
+// UsesFork checks if pull requests for this watch should be opened from a fork
+func (r RepoConfig) UsesFork() bool {
+	return r.Fork || r.ForkRepoName != ""
+}
+
+// Merge returns a copy of tc where empty fields are taken from defaults
+func (tc TemplateConfig) Merge(defaults TemplateConfig) TemplateConfig {
+	if tc.Branch == "" {
+		tc.Branch = defaults.Branch
+	}
+	if tc.Title == "" {
+		tc.Title = defaults.Title
+	}
+	if tc.Body == "" {
+		tc.Body = defaults.Body
+	}
+	if tc.CommitMessage == "" {
+		tc.CommitMessage = defaults.CommitMessage
+	}
+	return tc
+}
+
+// Merge returns a copy of cc where empty fields are taken from defaults
+func (cc CommitConfig) Merge(defaults CommitConfig) CommitConfig {
+	if cc.AuthorName == "" {
+		cc.AuthorName = defaults.AuthorName
+	}
+	if cc.AuthorEmail == "" {
+		cc.AuthorEmail = defaults.AuthorEmail
+	}
+	if cc.CommitterName == "" {
+		cc.CommitterName = defaults.CommitterName
+	}
+	if cc.CommitterEmail == "" {
+		cc.CommitterEmail = defaults.CommitterEmail
+	}
+	if cc.SigningKey == "" {
+		cc.SigningKey = defaults.SigningKey
+		cc.SigningKeyPassphrase = defaults.SigningKeyPassphrase
+	}
+	return cc
+}
+
+// SlogLevel returns the configured log level
+func (lc LogConfig) SlogLevel() (slog.Level, error) {
+	switch strings.ToLower(lc.Level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", lc.Level)
+}
+
+// Validate checks that the level and format are known
+func (lc LogConfig) Validate() error {
+	if _, err := lc.SlogLevel(); err != nil {
+		return err
+	}
+	switch strings.ToLower(lc.Format) {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q, must be text or json", lc.Format)
+}
@@ -0,0 +1,365 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseRepoName(t *testing.T) {
+	valid := []string{
+		"upstream/tool",
+		"https://github.com/upstream/tool",
+		"https://github.com/upstream/tool.git",
+		"https://github.com/upstream/tool/",
+		"https://token@github.com/upstream/tool",
+		"ssh://git@github.com/upstream/tool.git",
+		"git@github.com:upstream/tool.git",
+		"github.com/upstream/tool",
+	}
+	for _, name := range valid {
+		owner, repo, err := ParseRepoName(name)
+		if err != nil {
+			t.Errorf("ParseRepoName(%q): %v", name, err)
+		} else if owner != "upstream" || repo != "tool" {
+			t.Errorf("ParseRepoName(%q) = %s, %s", name, owner, repo)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"tool",
+		"upstream/tool/extra",
+		"https://gitlab.com/upstream/tool",
+		"-upstream/tool",
+		"upstream/tool name",
+		"upstream/..",
+	}
+	for _, name := range invalid {
+		if _, _, err := ParseRepoName(name); err == nil {
+			t.Errorf("ParseRepoName(%q) should fail", name)
+		}
+	}
+}
+
+func TestProblemsHaveLineNumbers(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.toml", `poll_interval = 10
+workers = 0
+
+[[repos]]
+source_repo_name = "https://github.com/upstream/tool.git"
+file_path = "src/main.c"
+target_repo_name = "distro/packages"
+pull_request_base_branch = "main"
+labels = ["upstream"]
+
+[[repos]]
+source_repo_name = "upstream/web"
+file_pat = "index.html"
+target_repo_name = "gitlab.com/distro/packages"
+pull_request_base_branch = "main"
+`)
+	writeFile(t, dir, "conf.d/10-lib.yaml", `repos:
+  - source_repo_name: upstream/lib
+    file_path: /lib.c
+    target_repo_name: distro/packages
+    pull_request_base_branch: main
+`)
+
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Repos[0].SourceRepoName != "upstream/tool" {
+		t.Errorf("the URL was not replaced with owner/name: %s", cfg.Repos[0].SourceRepoName)
+	}
+
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	lib := filepath.Join(dir, "conf.d", "10-lib.yaml")
+	want := []string{
+		path + ":13: repos[1].file_pat: unknown setting",
+		path + ":2: workers: must be greater than zero",
+		path + ":11: repos[1]: file_path is required",
+		path + `:14: repos[1].target_repo_name: invalid repository "gitlab.com/distro/packages", only repositories on github.com are supported`,
+		lib + ":3: repos[2].file_path: must be relative to the root of the repository",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	if err := cfg.Validate(); err == nil {
+		t.Error("expected Validate to fail")
+	}
+}
+
+func TestTargets(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.toml", `poll_interval = 10
+
+[[repos]]
+source_repo_name = "vim/vim"
+file_path = "src/xxd/"
+group = "xxd"
+
+[[repos.targets]]
+repo_name = "https://github.com/distro/packages"
+base_branch = "main"
+path = "xxd/UPSTREAM.md"
+
+[[repos.targets]]
+repo_name = "ports/xxd"
+base_branch = "develop"
+group = "ports"
+
+[[repos.targets]]
+repo_name = "distro/packages"
+base_branch = "main"
+path = "xxd/UPSTREAM.md"
+
+[[repos.targets]]
+path = "/UPSTREAM.md"
+`)
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watches := cfg.Watches()
+	if len(watches) != 4 {
+		t.Fatalf("expected 4 watches, got %d", len(watches))
+	}
+	if w := watches[0]; w.TargetRepoName != "distro/packages" || w.PullRequestBaseBranch != "main" || w.DestinationPath() != "xxd/UPSTREAM.md" || w.Group != "xxd" {
+		t.Errorf("unexpected first watch %+v", w)
+	}
+	if w := watches[1]; w.DestinationPath() != "src-xxd--updates.md" || w.Group != "ports" {
+		t.Errorf("the second watch should have the default path and the group of the target, got %+v", w)
+	}
+	if watches[0].Key() == watches[1].Key() || watches[0].GroupKey() == watches[0].Key() {
+		t.Errorf("unexpected keys %s, %s and group key %s", watches[0].Key(), watches[1].Key(), watches[0].GroupKey())
+	}
+
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		path + ":23: repos[0].targets[3]: repo_name is required",
+		path + ":23: repos[0].targets[3]: base_branch is required, unless the watch has a pull_request_base_branch",
+		path + ":18: repos[0].targets[2]: is the same target as targets[0]",
+		path + ":24: repos[0].targets[3].path: must be relative to the root of the repository",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMatchTag(t *testing.T) {
+	watch := RepoConfig{Trigger: TriggerTags, TagPattern: "vim-*", Versions: ">= 9.1, < 10"}
+	for tag, want := range map[string]bool{
+		"vim-9.1.0123":    true,
+		"vim-9.0.2000":    false,
+		"vim-10.0":        false,
+		"v9.1.0123":       false,
+		"vim-9.1.0124-rc": false,
+		"vim-nightly":     false,
+	} {
+		if v, ok := watch.MatchTag(tag); ok != want || (ok && v.String() != tag) {
+			t.Errorf("MatchTag(%q) = %v, %v, want %v", tag, v, ok, want)
+		}
+	}
+	watch.Prereleases = true
+	if _, ok := watch.MatchTag("vim-9.1.0124-rc"); !ok {
+		t.Error("expected a pre-release to match when they are allowed")
+	}
+}
+
+func TestTriggerProblems(t *testing.T) {
+	cfg := Config{PollInterval: 1, Workers: 1, APITimeout: 1, MaxAttempts: 1, Repos: []RepoConfig{
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", TagPattern: "v*"},
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", Trigger: "release"},
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", Trigger: "tags", TagPattern: "[v", Versions: ">= nine"},
+	}}
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		"repos[0].tag_pattern: is only used with trigger = releases or tags",
+		`repos[1].trigger: unknown trigger "release", must be commits, releases or tags`,
+		`repos[2].tag_pattern: invalid pattern "[v": syntax error in pattern`,
+		`repos[2].versions: invalid version constraint ">= nine": invalid version "nine", "nine" is not a number`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestModeProblems(t *testing.T) {
+	cfg := Config{PollInterval: 1, Workers: 1, APITimeout: 1, MaxAttempts: 1, GoProxy: "file:///var/cache/goproxy", Repos: []RepoConfig{
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", Mode: ModePKGBUILD},
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", Mode: "pkgbuilds"},
+		{SourceRepoName: "vim/vim", FilePath: "src/xxd/", PullRequestBaseBranch: "main", Trigger: TriggerTags, Targets: []TargetConfig{
+			{RepoName: "distro/packages", Mode: ModePKGBUILD},
+			{RepoName: "distro/notes"},
+			{RepoName: "example/app", Mode: ModeGoMod},
+			{RepoName: "example/app", Mode: ModeSubmodule},
+		}},
+		{SourceRepoName: "vim/vim", FilePath: ".", TargetRepoName: "distro/packages", PullRequestBaseBranch: "main", Mode: ModeSync, Exclude: []string{"[a"}},
+	}}
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		`go_proxy: must be an http or https URL, got "file:///var/cache/goproxy"`,
+		"repos[0].mode: mode = pkgbuild needs trigger = releases or tags",
+		`repos[1].mode: unknown mode "pkgbuilds", must be notify, pkgbuild, gomod, submodule or sync`,
+		`repos[3].exclude: invalid pattern "[a": syntax error in pattern`,
+		"repos[3].mode: mode = sync needs a target_path, since the target directory can not be the root",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if path := cfg.Watches()[2].DestinationPath(); path != "PKGBUILD" {
+		t.Errorf("expected the PKGBUILD at the root by default, got %s", path)
+	}
+	if path := cfg.Watches()[4].DestinationPath(); path != "go.mod" {
+		t.Errorf("expected the go.mod at the root by default, got %s", path)
+	}
+	if path := cfg.Watches()[5].DestinationPath(); path != "vim" {
+		t.Errorf("expected the submodule to be named after the source repository by default, got %s", path)
+	}
+}
+
+func TestGroupProblems(t *testing.T) {
+	watch := func(source, mode, targetPath string) RepoConfig {
+		return RepoConfig{SourceRepoName: source, FilePath: "src/", TargetRepoName: "example/app", PullRequestBaseBranch: "main",
+			Mode: mode, TargetPath: targetPath, Group: "deps", Trigger: TriggerTags}
+	}
+	cfg := Config{PollInterval: 1, Workers: 1, APITimeout: 1, MaxAttempts: 1, Repos: []RepoConfig{
+		watch("example/lib", ModeGoMod, ""),
+		watch("example/util", ModeGoMod, ""),
+		watch("example/lib", "", "go.mod"),
+		watch("example/lib", ModeSync, "third_party"),
+		watch("example/util", ModeSync, "third_party/util"),
+		watch("example/lib", ModeSubmodule, "lib"),
+		watch("example/util", ModeSubmodule, "util"),
+	}}
+	cfg.Repos[6].Targets = []TargetConfig{{RepoName: "example/app", Path: "lib", Group: "deps"}}
+	cfg.Repos[6].TargetRepoName = ""
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	// Two watches that update the same go.mod build on each other
+	want := []string{
+		"repos[2].group: go.mod is also changed by the watch of repos[0], which is in the same group",
+		"repos[2].group: go.mod is also changed by the watch of repos[1], which is in the same group",
+		"repos[4].group: third_party/util is also changed by the watch of repos[3], which is in the same group",
+		"repos[6].targets[0].group: lib is also changed by the watch of repos[5], which is in the same group",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSyncs(t *testing.T) {
+	watch := RepoConfig{FilePath: "src/", Include: []string{"*.c", "*.h", "docs/"}, Exclude: []string{"testdata", "docs/internal/*"}}
+	for rel, want := range map[string]bool{
+		"main.c":                true,
+		"lib/util.h":            true,
+		"Makefile":              false,
+		"docs/README.md":        true,
+		"docs/internal/plan.md": false,
+		"lib/testdata/input.c":  false,
+	} {
+		if got := watch.Syncs(rel); got != want {
+			t.Errorf("Syncs(%q): expected %v, got %v", rel, want, got)
+		}
+	}
+	if watch.Mode = ModeSync; watch.DestinationPath() != "src" {
+		t.Errorf("expected the watched directory as the target directory, got %q", watch.DestinationPath())
+	}
+}
+
+func TestTransforms(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.toml", `poll_interval = 10
+
+[[repos]]
+source_repo_name = "madler/zlib"
+file_path = "contrib/minizip/"
+target_repo_name = "example/app"
+pull_request_base_branch = "main"
+mode = "sync"
+target_path = "third_party/minizip"
+
+[[repos.transforms]]
+type = "replace"
+files = ["*.c"]
+pattern = "#include \"(zlib\\.h)\""
+replacement = "#include <zlib/$1>"
+
+[[repos.transforms]]
+type = "prepend"
+text = "// From {{ .Path }} in {{ .Repo"
+
+[[repos.transforms]]
+type = "line_endings"
+line_endings = "cr"
+
+[[repos.transforms]]
+type = "sed"
+
+[[repos]]
+source_repo_name = "madler/zlib"
+file_path = "contrib/minizip/"
+target_repo_name = "example/app"
+pull_request_base_branch = "main"
+transforms = [{ type = "filter", command = [] }]
+`)
+	cfg, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transforms := cfg.Repos[0].Transforms; len(transforms) != 4 || transforms[0].Replacement != "#include <zlib/$1>" {
+		t.Fatalf("unexpected transforms %+v", transforms)
+	}
+	if transform := cfg.Repos[0].Transforms[0]; !transform.Transforms("unzip.c") || transform.Transforms("unzip.h") {
+		t.Error("expected only the files that match the globs to be transformed")
+	}
+
+	var got []string
+	for _, problem := range cfg.Problems() {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		path + `:19: repos[0].transforms[1].text: template: text:1: unclosed action`,
+		path + `:23: repos[0].transforms[2].line_endings: must be lf or crlf, got "cr"`,
+		path + `:26: repos[0].transforms[3].type: unknown type "sed", must be replace, prepend, append, line_endings or filter`,
+		path + `:33: repos[1].transforms: are only used with mode = sync`,
+		path + `:33: repos[1].transforms[0].command: is required for type = filter`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// A named group in braces is escaped, so that it is not replaced with an environment variable
+	path = writeFile(t, dir, "named.toml", `[[repos]]
+source_repo_name = "madler/zlib"
+file_path = "contrib/minizip/"
+target_repo_name = "example/app"
+mode = "sync"
+transforms = [{ type = "replace", pattern = "#include \"(?P<header>zlib\\.h)\"", replacement = "#include <zlib/$${header}>" }]
+`)
+	if cfg, err = Read(path); err != nil {
+		t.Fatal(err)
+	}
+	if replacement := cfg.Repos[0].Transforms[0].Replacement; replacement != "#include <zlib/${header}>" {
+		t.Errorf("expected the named group to be kept, got %q", replacement)
+	}
+}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+)
+
+// Defaults are the default values of the global settings
+var Defaults = map[string]any{
+	"branch_grace_period": 24,
+	"workers":             4,
+	"api_timeout":         30,
+	"shutdown_timeout":    60,
+	"max_attempts":        5,
+	"go_proxy":            "https://proxy.golang.org",
+
+	"leader_election.lease_duration": 30,
+}
+
+// SearchPaths are the directories that Load looks for a configuration file in, in order
+var SearchPaths = []string{
+	"/etc/vigilant",
+	filepath.Join(os.Getenv("HOME"), ".config/vigilant"),
+	".",
+}
+
+// Extensions are the supported configuration file formats, in the order they are looked for
+var Extensions = []string{"toml", "yaml", "yml", "json"}
+
+// confDir is the directory next to the configuration file that additional watches are read from
+const confDir = "conf.d"
+
+// envPattern matches ${NAME} and ${NAME:-default}, and $${ which is an escaped ${
+var envPattern = regexp.MustCompile(`\$\$\{|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// Find returns the path of the first config.toml, config.yaml, config.yml or config.json in the SearchPaths
+func Find() (string, error) {
+	for _, dir := range SearchPaths {
+		for _, ext := range Extensions {
+			path := filepath.Join(dir, "config."+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return "", errors.New("could not find config.toml, config.yaml, config.yml or config.json in any of the expected locations")
+}
+
+// Load reads the configuration with Read, and validates it
+func Load(path string) (*Config, error) {
+	config, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("config validation failed:\n%w", err)
+	}
+	return config, nil
+}
+
+// Read reads the configuration file at the given path, or the one that Find finds if path is empty,
+// without validating it. The watches in the files in the conf.d directory next to it are added to the
+// watches of the configuration file, environment variables and files that are referred to in values
+// are interpolated, and repository URLs are replaced with owner/name.
+func Read(path string) (*Config, error) {
+	if path == "" {
+		var err error
+		if path, err = Find(); err != nil {
+			return nil, err
+		}
+	}
+
+	v, data, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range Defaults {
+		v.SetDefault(key, value)
+	}
+
+	var (
+		config Config
+		md     mapstructure.Metadata
+	)
+	if err := v.Unmarshal(&config, decodeOptions(filepath.Dir(path), &md)); err != nil {
+		return nil, fmt.Errorf("unable to decode %s: %w", path, err)
+	}
+	config.file = path
+	for _, dir := range []*string{&config.StateDir, &config.CacheDir} {
+		if *dir != "" && !filepath.IsAbs(*dir) {
+			*dir = filepath.Join(filepath.Dir(path), *dir)
+		}
+	}
+	config.positions = findPositions(path, data, 0)
+	config.unknownKeys = md.Unused
+
+	if err := config.readConfDir(filepath.Join(filepath.Dir(path), confDir)); err != nil {
+		return nil, err
+	}
+	sort.Strings(config.unknownKeys)
+	config.normalize()
+	return &config, nil
+}
+
+// readConfDir adds the watches from all configuration files in dir, in the order of their names.
+// These files can only contain watches. A missing directory has no watches.
+func (c *Config) readConfDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && slices.Contains(Extensions, strings.TrimPrefix(filepath.Ext(entry.Name()), ".")) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		v, data, err := readFile(path)
+		if err != nil {
+			return err
+		}
+		for key := range v.AllSettings() {
+			if key != "repos" {
+				return fmt.Errorf("%s: only repos can be configured in %s, not %s", path, confDir, key)
+			}
+		}
+		var (
+			watches struct {
+				Repos []RepoConfig `mapstructure:"repos"`
+			}
+			md mapstructure.Metadata
+		)
+		if err := v.Unmarshal(&watches, decodeOptions(dir, &md)); err != nil {
+			return fmt.Errorf("unable to decode %s: %w", path, err)
+		}
+		for field, pos := range findPositions(path, data, len(c.Repos)) {
+			c.positions[field] = pos
+		}
+		for _, key := range md.Unused {
+			c.unknownKeys = append(c.unknownKeys, renumberRepo(key, len(c.Repos)))
+		}
+		c.Repos = append(c.Repos, watches.Repos...)
+	}
+	return nil
+}
+
+// repoIndexPattern matches the index of a watch at the start of a field path
+var repoIndexPattern = regexp.MustCompile(`^repos\[(\d+)\]`)
+
+// renumberRepo adds offset to the index of the watch in a field path like repos[0].file_path
+func renumberRepo(field string, offset int) string {
+	return repoIndexPattern.ReplaceAllStringFunc(field, func(m string) string {
+		n, _ := strconv.Atoi(repoIndexPattern.FindStringSubmatch(m)[1])
+		return fmt.Sprintf("repos[%d]", n+offset)
+	})
+}
+
+// readFile reads a configuration file, in the format given by its extension.
+// The contents are returned as well, to find the positions of the keys.
+func readFile(path string) (*viper.Viper, []byte, error) {
+	if ext := strings.TrimPrefix(filepath.Ext(path), "."); !slices.Contains(Extensions, ext) {
+		return nil, nil, fmt.Errorf("%s: unsupported configuration format %q, must be one of %s", path, ext, strings.Join(Extensions, ", "))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	v := viper.New()
+	v.SetConfigType(strings.TrimPrefix(filepath.Ext(path), "."))
+	if err := v.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, nil, fmt.Errorf("could not read %s: %w", path, err)
+	}
+	return v, data, nil
+}
+
+// decodeOptions returns the options for decoding a configuration file in dir, which interpolate
+// all string values, in addition to the conversions that viper does by default.
+// The keys that are not settings are collected in md.
+func decodeOptions(dir string, md *mapstructure.Metadata) viper.DecoderConfigOption {
+	interpolateStrings := func(from, _ reflect.Type, data any) (any, error) {
+		if from.Kind() != reflect.String {
+			return data, nil
+		}
+		return Interpolate(reflect.ValueOf(data).String(), dir)
+	}
+	return func(dc *mapstructure.DecoderConfig) {
+		dc.DecodeHook = mapstructure.ComposeDecodeHookFunc(
+			interpolateStrings,
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		)
+		dc.Metadata = md
+	}
+}
+
+// Interpolate replaces ${NAME} in s with the value of the environment variable NAME, and ${NAME:-default}
+// with default if NAME is unset or empty. $${ gives a literal ${. If s starts with file:, the rest is the
+// path of a file, relative to dir, and the contents of the file without trailing newlines are returned instead.
+func Interpolate(s, dir string) (string, error) {
+	path, isFile := strings.CutPrefix(s, "file:")
+	if isFile {
+		s = path
+	}
+
+	var err error
+	s = envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$${" {
+			return "${"
+		}
+		match := envPattern.FindStringSubmatch(m)
+		name, hasDefault, fallback := match[1], match[2] != "", match[3]
+		if value, ok := os.LookupEnv(name); ok && (value != "" || !hasDefault) {
+			return value
+		}
+		if hasDefault {
+			return fallback
+		}
+		if err == nil {
+			err = fmt.Errorf("the environment variable %s is not set", name)
+		}
+		return m
+	})
+	if err != nil || !isFile {
+		return s, err
+	}
+
+	if !filepath.IsAbs(s) {
+		s = filepath.Join(dir, s)
+	}
+	data, err := os.ReadFile(s)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFile writes a file in dir, creating the directories that are needed
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.toml": `poll_interval = 10
+
+[[repos]]
+source_repo_name = "upstream/tool"
+file_path = "src/main.c"
+target_repo_name = "distro/packages"
+pull_request_base_branch = "main"
+labels = ["upstream"]
+`,
+		"config.yaml": `poll_interval: 10
+repos:
+  - source_repo_name: upstream/tool
+    file_path: src/main.c
+    target_repo_name: distro/packages
+    pull_request_base_branch: main
+    labels: [upstream]
+`,
+		"config.json": `{
+  "poll_interval": 10,
+  "repos": [{
+    "source_repo_name": "upstream/tool",
+    "file_path": "src/main.c",
+    "target_repo_name": "distro/packages",
+    "pull_request_base_branch": "main",
+    "labels": ["upstream"]
+  }]
+}
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeFile(t, t.TempDir(), name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.PollInterval != 10 || cfg.Workers != 4 || len(cfg.Repos) != 1 {
+				t.Fatalf("unexpected config %+v", cfg)
+			}
+			if repo := cfg.Repos[0]; repo.SourceRepoName != "upstream/tool" || strings.Join(repo.Labels, ",") != "upstream" {
+				t.Errorf("unexpected watch %+v", repo)
+			}
+		})
+	}
+}
+
+func TestLoadUnsupportedFormat(t *testing.T) {
+	if _, err := Load(writeFile(t, t.TempDir(), "config.ini", "poll_interval = 10\n")); err == nil {
+		t.Error("expected an error for an ini file")
+	}
+}
+
+func TestLoadConfDir(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "config.toml", `poll_interval = 10
+
+[[repos]]
+source_repo_name = "upstream/tool"
+file_path = "src/main.c"
+target_repo_name = "distro/packages"
+pull_request_base_branch = "main"
+`)
+	writeFile(t, dir, "conf.d/20-web.yaml", `repos:
+  - source_repo_name: upstream/web
+    file_path: index.html
+    target_repo_name: distro/packages
+    pull_request_base_branch: main
+`)
+	writeFile(t, dir, "conf.d/10-lib.json", `{"repos": [{"source_repo_name": "upstream/lib", "file_path": "lib.c", "target_repo_name": "distro/packages", "pull_request_base_branch": "main"}]}`)
+	writeFile(t, dir, "conf.d/README.md", "Not a configuration file\n")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sources []string
+	for _, repo := range cfg.Repos {
+		sources = append(sources, repo.SourceRepoName)
+	}
+	if got := strings.Join(sources, ","); got != "upstream/tool,upstream/lib,upstream/web" {
+		t.Errorf("unexpected watches %s", got)
+	}
+
+	// Global settings can only be in the main configuration file
+	writeFile(t, dir, "conf.d/30-bad.toml", "poll_interval = 1\n")
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "poll_interval") {
+		t.Errorf("expected an error for a global setting in conf.d, got %v", err)
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "passphrase", "secret\n")
+	t.Setenv("VIGILANT_TEST_OWNER", "upstream")
+	t.Setenv("VIGILANT_TEST_EMPTY", "")
+	t.Setenv("VIGILANT_TEST_DIR", dir)
+
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${VIGILANT_TEST_OWNER}/tool", "upstream/tool"},
+		{"${VIGILANT_TEST_UNSET:-main}", "main"},
+		{"${VIGILANT_TEST_EMPTY:-main}", "main"},
+		{"${VIGILANT_TEST_EMPTY}", ""},
+		{"$${VIGILANT_TEST_OWNER}", "${VIGILANT_TEST_OWNER}"},
+		{"{{ .Watch.FilePath }}", "{{ .Watch.FilePath }}"},
+		{"file:passphrase", "secret"},
+		{"file:${VIGILANT_TEST_DIR}/passphrase", "secret"},
+	}
+	for _, test := range tests {
+		got, err := Interpolate(test.in, dir)
+		if err != nil {
+			t.Errorf("Interpolate(%q): %v", test.in, err)
+		} else if got != test.want {
+			t.Errorf("Interpolate(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	if _, err := Interpolate("${VIGILANT_TEST_UNSET}", dir); err == nil {
+		t.Error("expected an error for an unset environment variable")
+	}
+	if _, err := Interpolate("file:missing", dir); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestLoadInterpolates(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "passphrase", "secret\n")
+	t.Setenv("VIGILANT_TEST_INTERVAL", "15")
+	t.Setenv("VIGILANT_TEST_TARGET", "distro/packages")
+	cfg, err := Load(writeFile(t, dir, "config.yaml", `poll_interval: ${VIGILANT_TEST_INTERVAL}
+commit:
+  signing_key_passphrase: file:passphrase
+repos:
+  - source_repo_name: upstream/tool
+    file_path: src/main.c
+    target_repo_name: ${VIGILANT_TEST_TARGET}
+    pull_request_base_branch: ${VIGILANT_TEST_BRANCH:-main}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PollInterval != 15 || cfg.Commit.SigningKeyPassphrase != "secret" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if repo := cfg.Repos[0]; repo.TargetRepoName != "distro/packages" || repo.PullRequestBaseBranch != "main" {
+		t.Errorf("unexpected watch %+v", repo)
+	}
+}
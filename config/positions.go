@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// findPositions returns the line of every key in a configuration file, by the path of its field,
+// like repos[0].file_path. The watches are numbered from firstRepo. If the file can not be parsed,
+// the error is reported when it is decoded, so no positions are returned.
+func findPositions(file string, data []byte, firstRepo int) map[string]Position {
+	positions := make(map[string]Position)
+	if strings.HasSuffix(file, ".toml") {
+		tomlPositions(positions, file, data, firstRepo)
+	} else {
+		// JSON is a subset of YAML
+		var root yaml.Node
+		if yaml.Unmarshal(data, &root) == nil && len(root.Content) > 0 {
+			yamlPositions(positions, file, root.Content[0], "", firstRepo)
+		}
+	}
+	return positions
+}
+
+// fieldPath returns the path of the field with the given keys, where the first key of a
+// field in an array table is followed by its index, like repos[2].templates.title
+func fieldPath(keys []string, arrayTable string, index int) string {
+	path := strings.ToLower(strings.Join(keys, "."))
+	if arrayTable != "" && len(keys) > 0 && strings.EqualFold(keys[0], arrayTable) {
+		path = fmt.Sprintf("%s[%d]", arrayTable, index) + strings.TrimPrefix(path, arrayTable)
+	}
+	return path
+}
+
+// tomlPositions finds the keys in a TOML file. The arrays of tables are [[repos]], and those in a watch,
+// like [[repos.targets]] and [[repos.transforms]].
+func tomlPositions(positions map[string]Position, file string, data []byte, firstRepo int) {
+	var p unstable.Parser
+	p.Reset(data)
+	var table []string
+	repo := firstRepo - 1
+	counts := make(map[string]int) // the number of tables in every array of tables of the watch
+	// path returns the path of the field with the given keys, with the indices of the watch and its array of tables
+	path := func(keys []string) string {
+		path := fieldPath(keys, "repos", repo)
+		if len(table) < 2 {
+			return path
+		}
+		name := strings.ToLower(table[1])
+		prefix := fmt.Sprintf("repos[%d].%s", repo, name)
+		if n, ok := counts[name]; ok && strings.HasPrefix(path, prefix) {
+			path = fmt.Sprintf("%s[%d]", prefix, n-1) + strings.TrimPrefix(path, prefix)
+		}
+		return path
+	}
+	for p.NextExpression() {
+		e := p.Expression()
+		if e.Kind != unstable.Table && e.Kind != unstable.ArrayTable && e.Kind != unstable.KeyValue {
+			continue
+		}
+		var keys []string
+		line := 0
+		for it := e.Key(); it.Next(); {
+			keys = append(keys, string(it.Node().Data))
+			if line == 0 {
+				line = p.Shape(it.Node().Raw).Start.Line
+			}
+		}
+		switch e.Kind {
+		case unstable.ArrayTable:
+			if len(keys) == 1 && keys[0] == "repos" {
+				repo, counts = repo+1, make(map[string]int)
+			} else if len(keys) == 2 && keys[0] == "repos" {
+				counts[strings.ToLower(keys[1])]++
+			}
+			table = keys
+			positions[path(keys)] = Position{File: file, Line: line}
+		case unstable.Table:
+			table = keys
+			positions[path(keys)] = Position{File: file, Line: line}
+		case unstable.KeyValue:
+			positions[path(append(append([]string(nil), table...), keys...))] = Position{File: file, Line: line}
+		}
+	}
+}
+
+// yamlPositions finds the keys in a YAML or JSON node, and in the nodes below it
+func yamlPositions(positions map[string]Position, file string, node *yaml.Node, path string, firstRepo int) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := strings.ToLower(key.Value)
+			if path != "" {
+				keyPath = path + "." + keyPath
+			}
+			positions[keyPath] = Position{File: file, Line: key.Line}
+			yamlPositions(positions, file, value, keyPath, firstRepo)
+		}
+	case yaml.SequenceNode:
+		offset := 0
+		if path == "repos" {
+			offset = firstRepo
+		}
+		for i, item := range node.Content {
+			itemPath := fmt.Sprintf("%s[%d]", path, offset+i)
+			positions[itemPath] = Position{File: file, Line: item.Line}
+			yamlPositions(positions, file, item, itemPath, firstRepo)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is a location in a configuration file
+type Position struct {
+	File string
+	Line int // 0 if the line is not known
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return p.File
+	}
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// Problem is something that is wrong with the configuration
+type Problem struct {
+	Pos     Position
+	Field   string // like repos[0].source_repo_name, or empty if the problem is not about a single field
+	Message string
+}
+
+// Error formats the problem like a compiler error, as file:line: field: message
+func (p Problem) Error() string {
+	var parts []string
+	if pos := p.Pos.String(); pos != "" {
+		parts = append(parts, pos)
+	}
+	if p.Field != "" {
+		parts = append(parts, p.Field)
+	}
+	return strings.Join(append(parts, p.Message), ": ")
+}
+
+// File returns the path of the configuration file that the configuration was read from
+func (c *Config) File() string {
+	return c.file
+}
+
+// Problemf returns a problem with the given field, at the position of the field in the configuration files
+func (c *Config) Problemf(field, format string, args ...any) Problem {
+	return Problem{Pos: c.Position(field), Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+// Position returns where the given field is set. If it is not set in a file, the position of the
+// closest enclosing field that is set is returned, like the watch of a field that has a default.
+func (c *Config) Position(field string) Position {
+	for field != "" {
+		if pos, ok := c.positions[field]; ok {
+			return pos
+		}
+		if i := strings.LastIndexAny(field, ".["); i >= 0 {
+			field = field[:i]
+		} else {
+			field = ""
+		}
+	}
+	return Position{File: c.file}
+}
@@ -0,0 +1,186 @@
+package vigilant
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// CheckConfig finds the problems that Config.Problems finds, and then checks every watch against the GitHub API:
+// that the repositories, the watched path and the base branch exist, and that the token can push to the
+// repository that pull request branches are pushed to. All problems are returned at once, with their positions
+// in the configuration files. Of the options, only WithClient and WithToken are used.
+func CheckConfig(ctx context.Context, cfg *config.Config, opts ...Option) []config.Problem {
+	problems := cfg.Problems()
+	for i, repo := range cfg.Repos {
+		if _, err := pullrequest.ParseTemplates(repo.Templates.Merge(cfg.Templates)); err != nil {
+			problems = append(problems, cfg.Problemf(fmt.Sprintf("repos[%d].templates", i), "%v", err))
+		}
+	}
+	if len(problems) == 0 {
+		// Check that the signing keys can be decrypted, now that they are known to exist
+		if err := pullrequest.New(nil, nil, cfg).LoadSigningKeys(); err != nil {
+			problems = append(problems, cfg.Problemf("commit.signing_key", "%v", err))
+		}
+	}
+
+	e := &Engine{apiTimeout: time.Duration(cfg.APITimeout) * time.Second}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if err := e.setupClient(); err != nil {
+		return append(problems, cfg.Problemf("", "%v", err))
+	}
+	c := &configChecker{
+		client: e.githubClient,
+		cfg:    cfg,
+		repos:  make(map[string]repoLookup),
+	}
+	if problem, ok := c.checkToken(ctx); !ok {
+		return append(problems, problem)
+	} else if problem.Message != "" {
+		problems = append(problems, problem)
+	}
+	for i, repo := range cfg.Repos {
+		for j, watch := range repo.Expand() {
+			problems = append(problems, c.checkWatch(ctx, i, j, watch)...)
+		}
+	}
+	return problems
+}
+
+// configChecker checks watches against the GitHub API, and remembers the repositories it has looked up
+type configChecker struct {
+	client *github.Client
+	cfg    *config.Config
+	repos  map[string]repoLookup
+}
+
+// repoLookup is the result of getting a repository
+type repoLookup struct {
+	repo *github.Repository
+	err  error
+}
+
+// repo gets a repository by its owner/name, once
+func (c *configChecker) repo(ctx context.Context, name string) (*github.Repository, error) {
+	if lookup, ok := c.repos[name]; ok {
+		return lookup.repo, lookup.err
+	}
+	owner, repoName := config.SplitRepoName(name)
+	repo, _, err := c.client.Repositories.Get(ctx, owner, repoName)
+	c.repos[name] = repoLookup{repo: repo, err: err}
+	return repo, err
+}
+
+// checkToken checks that the token is valid, and that a classic token has a scope that gives access to repositories.
+// Returns false if the token is not valid, since nothing else can be checked then.
+func (c *configChecker) checkToken(ctx context.Context) (config.Problem, bool) {
+	_, resp, err := c.client.Users.Get(ctx, "")
+	if err != nil {
+		return c.cfg.Problemf("", "the GitHub token does not work: %v", err), false
+	}
+	// Only classic tokens have scopes, fine-grained tokens are checked by the permissions of each repository
+	header := resp.Header.Get("X-OAuth-Scopes")
+	if header == "" {
+		return config.Problem{}, true
+	}
+	scopes := strings.Split(header, ",")
+	for i := range scopes {
+		scopes[i] = strings.TrimSpace(scopes[i])
+	}
+	if !slices.Contains(scopes, "repo") && !slices.Contains(scopes, "public_repo") {
+		return c.cfg.Problemf("", "the GitHub token has the scopes %q, but needs repo, or public_repo for public repositories", header), true
+	}
+	return config.Problem{}, true
+}
+
+// checkWatch checks that the repositories, path and branch of a watch exist, and that the token can push the branch.
+// The watch is target j of the watch at index i, if that watch has targets.
+func (c *configChecker) checkWatch(ctx context.Context, i, j int, watch config.RepoConfig) []config.Problem {
+	var problems []config.Problem
+	repo := c.cfg.Repos[i]
+	field := func(name string) string {
+		// The target and the base branch of a target are set in the target
+		if len(repo.Targets) > 0 {
+			switch {
+			case name == "target_repo_name":
+				return fmt.Sprintf("repos[%d].targets[%d].repo_name", i, j)
+			case name == "pull_request_base_branch" && repo.Targets[j].BaseBranch != "":
+				return fmt.Sprintf("repos[%d].targets[%d].base_branch", i, j)
+			case name == "target_path" && repo.Targets[j].Path != "":
+				return fmt.Sprintf("repos[%d].targets[%d].path", i, j)
+			}
+		}
+		return fmt.Sprintf("repos[%d].%s", i, name)
+	}
+	// getRepo gets a repository, and adds a problem if it does not exist. Invalid names are reported by Problems.
+	getRepo := func(name, fieldName string) *github.Repository {
+		if _, _, err := config.ParseRepoName(name); err != nil {
+			return nil
+		}
+		repo, err := c.repo(ctx, name)
+		if pullrequest.IsNotFound(err) {
+			problems = append(problems, c.cfg.Problemf(field(fieldName), "the repository %s does not exist, or the token can not read it", name))
+		} else if err != nil {
+			problems = append(problems, c.cfg.Problemf(field(fieldName), "could not get %s: %v", name, err))
+		}
+		return repo
+	}
+
+	// The targets of a watch have the same source, which is only checked with the first target
+	var source *github.Repository
+	if j == 0 {
+		source = getRepo(watch.SourceRepoName, "source_repo_name")
+	}
+	if source != nil && watch.FilePath != "" {
+		owner, repo := config.SplitRepoName(watch.SourceRepoName)
+		branch := source.GetDefaultBranch()
+		_, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, watch.WatchedPath(), &github.RepositoryContentGetOptions{Ref: branch})
+		if pullrequest.IsNotFound(err) {
+			problems = append(problems, c.cfg.Problemf(field("file_path"), "%s does not exist on the %s branch of %s", watch.FilePath, branch, watch.SourceRepoName))
+		} else if err != nil {
+			problems = append(problems, c.cfg.Problemf(field("file_path"), "could not get %s from %s: %v", watch.FilePath, watch.SourceRepoName, err))
+		}
+	}
+
+	target := getRepo(watch.TargetRepoName, "target_repo_name")
+	if target == nil {
+		return problems
+	}
+	if watch.PullRequestBaseBranch != "" {
+		owner, repo := config.SplitRepoName(watch.TargetRepoName)
+		_, _, err := c.client.Git.GetRef(ctx, owner, repo, "heads/"+watch.PullRequestBaseBranch)
+		if pullrequest.IsNotFound(err) {
+			problems = append(problems, c.cfg.Problemf(field("pull_request_base_branch"), "the branch %s does not exist in %s", watch.PullRequestBaseBranch, watch.TargetRepoName))
+		} else if err != nil {
+			problems = append(problems, c.cfg.Problemf(field("pull_request_base_branch"), "could not get the branch %s of %s: %v", watch.PullRequestBaseBranch, watch.TargetRepoName, err))
+		} else if watch.Mode == config.ModePKGBUILD || watch.Mode == config.ModeGoMod || watch.Mode == config.ModeSubmodule {
+			// The PKGBUILD, go.mod or submodule that is updated must already be there
+			path := watch.DestinationPath()
+			_, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: watch.PullRequestBaseBranch})
+			if pullrequest.IsNotFound(err) {
+				problems = append(problems, c.cfg.Problemf(field("target_path"), "%s does not exist on the %s branch of %s", path, watch.PullRequestBaseBranch, watch.TargetRepoName))
+			} else if err != nil {
+				problems = append(problems, c.cfg.Problemf(field("target_path"), "could not get %s from %s: %v", path, watch.TargetRepoName, err))
+			}
+		}
+	}
+
+	// The branch is pushed to the target, unless a fork is used. A fork that vigilant creates is owned by the token owner.
+	switch {
+	case watch.ForkRepoName != "":
+		if fork := getRepo(watch.ForkRepoName, "fork_repo_name"); fork != nil && !fork.GetPermissions()["push"] {
+			problems = append(problems, c.cfg.Problemf(field("fork_repo_name"), "the token can not push to %s", watch.ForkRepoName))
+		}
+	case !watch.Fork && !target.GetPermissions()["push"]:
+		problems = append(problems, c.cfg.Problemf(field("target_repo_name"), "the token can not push to %s, set fork = true to open pull requests from a fork", watch.TargetRepoName))
+	}
+	return problems
+}
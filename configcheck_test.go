@@ -0,0 +1,77 @@
+package vigilant
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+)
+
+func TestCheckConfig(t *testing.T) {
+	gh := githubfake.New()
+	t.Cleanup(gh.Close)
+	gh.AddRepo("upstream/tool", "main").Commit("main", githubfake.Commit{
+		Message: "Initial commit",
+		Files:   map[string]string{"src/main.c": "int main(void) {}\n"},
+	})
+	gh.AddRepo("distro/packages", "main").Commit("main", githubfake.Commit{Message: "Initial commit"})
+	readOnly := gh.AddRepo("distro/readonly", "main")
+	readOnly.Commit("main", githubfake.Commit{Message: "Initial commit"})
+	readOnly.SetReadOnly(true)
+
+	watch := config.RepoConfig{
+		SourceRepoName:        "upstream/tool",
+		FilePath:              "src/main.c",
+		TargetRepoName:        "distro/packages",
+		PullRequestBaseBranch: "main",
+	}
+	cfg := &config.Config{
+		PollInterval: 60,
+		Workers:      1,
+		APITimeout:   30,
+		MaxAttempts:  1,
+		Repos:        []config.RepoConfig{watch},
+	}
+	ctx := context.Background()
+	if problems := CheckConfig(ctx, cfg, WithClient(gh.Client())); len(problems) != 0 {
+		t.Fatalf("unexpected problems: %v", problems)
+	}
+
+	missingSource, missingPath, missingBranch, noPush, fromFork := watch, watch, watch, watch, watch
+	missingSource.SourceRepoName = "upstream/missing"
+	missingPath.FilePath = "src/missing.c"
+	missingBranch.PullRequestBaseBranch = "develop"
+	noPush.TargetRepoName = "distro/readonly"
+	fromFork.TargetRepoName = "distro/readonly"
+	fromFork.Fork = true
+	cfg.Repos = []config.RepoConfig{missingSource, missingPath, missingBranch, noPush, fromFork}
+	gh.Scopes = "gist, read:org"
+
+	var got []string
+	for _, problem := range CheckConfig(ctx, cfg, WithClient(gh.Client())) {
+		got = append(got, problem.Error())
+	}
+	want := []string{
+		`the GitHub token has the scopes "gist, read:org", but needs repo, or public_repo for public repositories`,
+		"repos[0].source_repo_name: the repository upstream/missing does not exist, or the token can not read it",
+		"repos[1].file_path: src/missing.c does not exist on the main branch of upstream/tool",
+		"repos[2].pull_request_base_branch: the branch develop does not exist in distro/packages",
+		"repos[3].target_repo_name: the token can not push to distro/readonly, set fork = true to open pull requests from a fork",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got the problems\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Each repository is only looked up once
+	n := 0
+	for _, request := range gh.Requests() {
+		if request == "GET /repos/distro/readonly" {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("distro/readonly was looked up %d times", n)
+	}
+}
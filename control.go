@@ -0,0 +1,177 @@
+package vigilant
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+)
+
+// maxWebhookCommits is the number of commits that GitHub includes in a push event at most.
+// If a push has this many, there may be more, so the watches are checked without looking at the files.
+const maxWebhookCommits = 20
+
+// Handler returns the handler of the control endpoint. POST /check queues a check of all watches,
+// GET /status returns the result of the last check of every watch, and POST /webhook queues a check
+// of the watches of the repository of a GitHub push event, if a webhook secret is configured.
+// Checks are only run while Run is running.
+func (e *Engine) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /check", func(w http.ResponseWriter, r *http.Request) {
+		if !e.authorized(r) {
+			e.logger.Warn("Rejected an unauthorized check", "remote", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		n := e.triggerWatches(func(config.RepoConfig) bool { return true })
+		e.logger.Info("Triggered a check of all watches", "remote", r.RemoteAddr, "queued", n)
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "checks queued: %d\n", n)
+	})
+	mux.HandleFunc("GET /status", e.serveStatus)
+	if e.webhookSecret != "" {
+		mux.HandleFunc("POST /webhook", e.serveWebhook)
+	}
+	return mux
+}
+
+// authorized checks that a request to trigger checks has the control token as a bearer token,
+// or, if no token is configured, that it comes from a loopback address or a Unix socket
+func (e *Engine) authorized(r *http.Request) bool {
+	if e.controlToken != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		return ok && subtle.ConstantTimeCompare([]byte(token), []byte(e.controlToken)) == 1
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && addr.Network() == "unix" {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// watchStatus is the status of a watch, as returned by the status endpoint
+type watchStatus struct {
+	Source string `json:"source"`
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Result string `json:"result"`
+}
+
+func (e *Engine) serveStatus(w http.ResponseWriter, _ *http.Request) {
+	status := struct {
+		Status  string        `json:"status"`
+		Watches []watchStatus `json:"watches"`
+	}{Status: e.status.String()}
+	for i, watch := range e.repoConfigs {
+		status.Watches = append(status.Watches, watchStatus{
+			Source: watch.SourceRepoName,
+			Path:   watch.FilePath,
+			Target: watch.TargetRepoName,
+			Result: e.status.result(i).String(),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// serveWebhook queues a check of the watches that a push to the default branch of their source repository touches,
+// and of the watches of releases or tags when a release is published or a tag is pushed
+func (e *Engine) serveWebhook(w http.ResponseWriter, r *http.Request) {
+	payload, err := github.ValidatePayload(r, []byte(e.webhookSecret))
+	if err != nil {
+		e.logger.Warn("Rejected webhook", "remote", r.RemoteAddr, "error", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var (
+		repo  string
+		match func(config.RepoConfig) bool
+	)
+	switch event := event.(type) {
+	case *github.PushEvent:
+		repo = event.GetRepo().GetFullName()
+		if tag, ok := strings.CutPrefix(event.GetRef(), "refs/tags/"); ok && !event.GetDeleted() {
+			match = func(watch config.RepoConfig) bool {
+				_, ok := watch.MatchTag(tag)
+				return watch.Trigger == config.TriggerTags && ok
+			}
+		} else if event.GetRef() == "refs/heads/"+event.GetRepo().GetDefaultBranch() {
+			match = func(watch config.RepoConfig) bool {
+				return !watch.WatchesReleases() && pushTouches(event, watch)
+			}
+		}
+	case *github.ReleaseEvent:
+		repo = event.GetRepo().GetFullName()
+		if event.GetAction() == "published" {
+			match = func(watch config.RepoConfig) bool {
+				return watch.Trigger == config.TriggerReleases
+			}
+		}
+	}
+	if match == nil {
+		// Like the ping event that GitHub sends when the webhook is created
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	n := e.triggerWatches(func(watch config.RepoConfig) bool {
+		return strings.EqualFold(watch.SourceRepoName, repo) && match(watch)
+	})
+	e.logger.Info("Received webhook", "event", github.WebHookType(r), "repo", repo, "queued", n)
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintf(w, "checks queued: %d\n", n)
+}
+
+// pushTouches checks if a push changes the watched path. If the push event does not list
+// all commits and files, it is assumed that it does.
+func pushTouches(push *github.PushEvent, watch config.RepoConfig) bool {
+	if len(push.Commits) == 0 || len(push.Commits) >= maxWebhookCommits {
+		return true
+	}
+	for _, commit := range push.Commits {
+		for _, files := range [][]string{commit.Added, commit.Modified, commit.Removed} {
+			for _, file := range files {
+				if watch.Watches(file) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Serve serves the control endpoint on ln until ctx is cancelled
+func (e *Engine) Serve(ctx context.Context, ln net.Listener) error {
+	srv := &http.Server{
+		Handler:           e.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	e.logger.Info("Serving the control endpoint", "address", ln.Addr().String())
+	if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
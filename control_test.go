@@ -0,0 +1,215 @@
+package vigilant
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+)
+
+// notifications listens on a fake systemd notification socket, and returns the messages that are sent to it
+func notifications(t *testing.T) <-chan string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+
+	messages := make(chan string, 100)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				close(messages)
+				return
+			}
+			messages <- string(buf[:n])
+		}
+	}()
+	return messages
+}
+
+// waitFor waits for a notification that contains the given text
+func waitFor(t *testing.T, messages <-chan string, text string) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if strings.Contains(msg, text) {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no notification with %q", text)
+		}
+	}
+}
+
+// postWebhook sends a GitHub webhook, signed with the given secret, and returns the status code and body of the response
+func postWebhook(t *testing.T, url, event, secret string, payload any) (int, string) {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	req, err := http.NewRequest("POST", url+"/webhook", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	text, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(text))
+}
+
+// pushEvent returns a push to the main branch of upstream/tool that changes the given files
+func pushEvent(files ...string) map[string]any {
+	return map[string]any{
+		"ref":        "refs/heads/main",
+		"repository": map[string]any{"full_name": "upstream/tool", "default_branch": "main"},
+		"commits":    []map[string]any{{"id": "abc", "modified": files}},
+	}
+}
+
+func TestSystemdNotificationsAndWebhook(t *testing.T) {
+	messages := notifications(t)
+	t.Setenv("WATCHDOG_USEC", "20000")
+	env := newTestEnv(t, func(cfg *config.Config) {
+		cfg.Control.WebhookSecret = "webhook secret"
+	})
+	srv := httptest.NewServer(env.engine.Handler())
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		env.engine.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, messages, "READY=1")
+	waitFor(t, messages, "WATCHDOG=1")
+
+	// A push that does not touch the watched file is ignored
+	env.upstreamCommit("Fix the build", map[string]string{"src/main.c": "int main(void)\n{\n    return 0;\n}\n"})
+	if status, body := postWebhook(t, srv.URL, "push", "webhook secret", pushEvent("README")); status != http.StatusAccepted || body != "checks queued: 0" {
+		t.Fatalf("unexpected response %d %s", status, body)
+	}
+	if status, _ := postWebhook(t, srv.URL, "push", "wrong secret", pushEvent("src/main.c")); status != http.StatusUnauthorized {
+		t.Errorf("a webhook with the wrong signature got %d", status)
+	}
+	if status, _ := postWebhook(t, srv.URL, "ping", "webhook secret", map[string]any{"zen": "Keep it simple"}); status != http.StatusNoContent {
+		t.Errorf("a ping got %d", status)
+	}
+	if status, body := postWebhook(t, srv.URL, "push", "webhook secret", pushEvent("src/main.c")); status != http.StatusAccepted || body != "checks queued: 1" {
+		t.Fatalf("unexpected response %d %s", status, body)
+	}
+	waitFor(t, messages, "STATUS=Last check at 2024-03-01 12:01 UTC: 1 with a new pull request")
+	if prs := env.pullRequests(); len(prs) != 1 {
+		t.Fatalf("expected one pull request, got %d", len(prs))
+	}
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status struct {
+		Watches []watchStatus `json:"watches"`
+	}
+	json.NewDecoder(resp.Body).Decode(&status)
+	resp.Body.Close()
+	if len(status.Watches) != 1 || status.Watches[0].Result != "pull request created" {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	cancel()
+	waitFor(t, messages, "STOPPING=1")
+	<-done
+}
+
+func TestCheckAuthorization(t *testing.T) {
+	post := func(e *testEnv, remote string, local net.Addr, token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/check", nil)
+		req.RemoteAddr = remote
+		if local != nil {
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, local))
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		e.engine.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Without a token, only local requests can trigger checks
+	e := newTestEnv(t, nil)
+	for _, c := range []struct {
+		remote string
+		local  net.Addr
+		want   int
+	}{
+		{"127.0.0.1:40000", nil, http.StatusAccepted},
+		{"[::1]:40000", nil, http.StatusAccepted},
+		{"@", &net.UnixAddr{Name: "/run/vigilant.sock", Net: "unix"}, http.StatusAccepted},
+		{"203.0.113.7:40000", nil, http.StatusUnauthorized},
+	} {
+		if got := post(e, c.remote, c.local, ""); got != c.want {
+			t.Errorf("a check from %s got %d, expected %d", c.remote, got, c.want)
+		}
+	}
+
+	// With a token, every request needs it
+	e = newTestEnv(t, func(cfg *config.Config) {
+		cfg.Control.Token = "control token"
+	})
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "control token": http.StatusAccepted} {
+		if got := post(e, "127.0.0.1:40000", nil, token); got != want {
+			t.Errorf("a check with the token %q got %d, expected %d", token, got, want)
+		}
+	}
+}
+
+func TestCheckIsNotQueuedWithoutRun(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+
+	// Nothing takes a queued check from the queue until Run is started
+	req := httptest.NewRequest(http.MethodPost, "/check", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	w := httptest.NewRecorder()
+	e.engine.Handler().ServeHTTP(w, req)
+	if got := strings.TrimSpace(w.Body.String()); got != "checks queued: 0" {
+		t.Errorf("expected no checks to be queued without Run, got %q", got)
+	}
+	e.engine.TriggerCheck()
+
+	if err := e.check(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(e.pullRequests()); n != 1 {
+		t.Errorf("expected the check to not be skipped, got %d pull requests", n)
+	}
+}
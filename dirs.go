@@ -0,0 +1,114 @@
+package vigilant
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// stateFiles are the files in the state directory. Older versions kept them in the cache directory.
+var stateFiles = []string{"state.json", "since.timestamp"}
+
+// DefaultStateDir returns the directory that the state is kept in, unless another one is configured.
+// It is the first of $STATE_DIRECTORY, which systemd sets for StateDirectory=, $XDG_STATE_HOME/vigilant,
+// and ~/.local/state/vigilant, or ~/Library/Application Support/vigilant on macOS.
+func DefaultStateDir() (string, error) {
+	if dir := systemdDirectory("STATE_DIRECTORY"); dir != "" {
+		return dir, nil
+	}
+	switch runtime.GOOS {
+	case "darwin", "ios", "windows", "plan9":
+		// These have no state directory of their own, so use the configuration directory
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("could not find a state directory, set state_dir or --state-dir: %w", err)
+		}
+		return filepath.Join(dir, "vigilant"), nil
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, "vigilant"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find a state directory, set state_dir or --state-dir: %w", err)
+	}
+	return filepath.Join(home, ".local", "state", "vigilant"), nil
+}
+
+// DefaultCacheDir returns the directory that disposable data is kept in, unless another one is configured.
+// It is $CACHE_DIRECTORY, which systemd sets for CacheDirectory=, or the vigilant directory in the
+// cache directory of the user, which is $XDG_CACHE_HOME or ~/.cache on Linux.
+func DefaultCacheDir() (string, error) {
+	if dir := systemdDirectory("CACHE_DIRECTORY"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find a cache directory, set cache_dir or --cache-dir: %w", err)
+	}
+	return filepath.Join(dir, "vigilant"), nil
+}
+
+// systemdDirectory returns the first directory in an environment variable that systemd sets,
+// which is a colon separated list if more than one directory is configured
+func systemdDirectory(name string) string {
+	dir, _, _ := strings.Cut(os.Getenv(name), ":")
+	return dir
+}
+
+// migrateState moves the state files from the directories that older versions used to stateDir,
+// unless stateDir already has them
+func (e *Engine) migrateState(stateDir string, oldDirs ...string) error {
+	for _, name := range stateFiles {
+		dest := filepath.Join(stateDir, name)
+		if _, err := os.Stat(dest); err == nil {
+			continue
+		}
+		for _, dir := range oldDirs {
+			src := filepath.Join(dir, name)
+			if dir == "" || src == dest {
+				continue
+			}
+			if _, err := os.Stat(src); err != nil {
+				continue
+			}
+			if err := moveFile(src, dest); err != nil {
+				return fmt.Errorf("could not move %s to the state directory: %w", src, err)
+			}
+			e.logger.Info("Moved state file to the state directory", "from", src, "to", dest)
+			break
+		}
+	}
+	return nil
+}
+
+// moveFile renames a file, or copies and removes it if it is on another file system
+func moveFile(src, dest string) error {
+	if err := os.Rename(src, dest); !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dest)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dest)
+		return err
+	}
+	return os.Remove(src)
+}
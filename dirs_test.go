@@ -0,0 +1,74 @@
+package vigilant
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+)
+
+func TestDefaultDirs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the XDG directories are only used on Linux")
+	}
+	t.Setenv("HOME", "/home/user")
+	t.Setenv("STATE_DIRECTORY", "")
+	t.Setenv("CACHE_DIRECTORY", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	t.Setenv("XDG_CACHE_HOME", "")
+
+	tests := []struct {
+		env             map[string]string
+		state, cacheDir string
+	}{
+		{nil, "/home/user/.local/state/vigilant", "/home/user/.cache/vigilant"},
+		{map[string]string{"XDG_STATE_HOME": "/xdg/state", "XDG_CACHE_HOME": "/xdg/cache"}, "/xdg/state/vigilant", "/xdg/cache/vigilant"},
+		{map[string]string{"STATE_DIRECTORY": "/var/lib/vigilant:/var/lib/other", "CACHE_DIRECTORY": "/var/cache/vigilant"}, "/var/lib/vigilant", "/var/cache/vigilant"},
+		{map[string]string{"HOME": "", "STATE_DIRECTORY": "/var/lib/vigilant", "CACHE_DIRECTORY": "/var/cache/vigilant"}, "/var/lib/vigilant", "/var/cache/vigilant"},
+	}
+	for _, test := range tests {
+		for name, value := range test.env {
+			t.Setenv(name, value)
+		}
+		if dir, err := DefaultStateDir(); err != nil || dir != test.state {
+			t.Errorf("DefaultStateDir() with %v = %q, %v, want %q", test.env, dir, err, test.state)
+		}
+		if dir, err := DefaultCacheDir(); err != nil || dir != test.cacheDir {
+			t.Errorf("DefaultCacheDir() with %v = %q, %v, want %q", test.env, dir, err, test.cacheDir)
+		}
+	}
+
+	// Without a home directory, a directory has to be configured
+	t.Setenv("HOME", "")
+	t.Setenv("STATE_DIRECTORY", "")
+	t.Setenv("XDG_STATE_HOME", "")
+	if _, err := DefaultStateDir(); err == nil {
+		t.Error("expected an error without a home directory")
+	}
+}
+
+func TestStateIsMigratedFromCacheDir(t *testing.T) {
+	stateDir, cacheDir := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(cacheDir, "since.timestamp"), []byte("2024-03-01T12:00:00Z"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "state.json"), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	e := &Engine{stateDir: stateDir, cacheDir: cacheDir, logger: slog.Default()}
+	if err := e.setupDirs(&config.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range stateFiles {
+		if _, err := os.Stat(filepath.Join(stateDir, name)); err != nil {
+			t.Errorf("%s was not moved to the state directory: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(cacheDir, name)); err == nil {
+			t.Errorf("%s is still in the cache directory", name)
+		}
+	}
+}
@@ -0,0 +1,509 @@
+package vigilant
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+	"github.com/xyproto/vigilant/state"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// testEnv is a vigilant engine that talks to a fake GitHub, with one watch of upstream/tool:src/main.c
+type testEnv struct {
+	t      *testing.T
+	clock  *fakeClock
+	gh     *githubfake.Server
+	source *githubfake.Repo
+	target *githubfake.Repo
+	engine *Engine
+}
+
+// newTestEnv sets up a fake GitHub with a source and a target repository, and an engine that watches the source.
+// The configuration can be changed by configure before the engine is created.
+func newTestEnv(t *testing.T, configure func(*config.Config)) *testEnv {
+	t.Helper()
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	gh := githubfake.New()
+	t.Cleanup(gh.Close)
+	gh.Now = clock.Now
+
+	source := gh.AddRepo("upstream/tool", "main")
+	source.Commit("main", githubfake.Commit{
+		Message: "Initial commit",
+		Author:  "Upstream Author",
+		Email:   "author@example.com",
+		Date:    clock.Now().Add(-48 * time.Hour),
+		Files:   map[string]string{"src/main.c": "int main(void)\n{\n    return 1;\n}\n", "README": "Tool\n"},
+	})
+	target := gh.AddRepo("distro/packages", "main")
+	target.Commit("main", githubfake.Commit{
+		Message: "Add the tool package",
+		Date:    clock.Now().Add(-24 * time.Hour),
+		Files:   map[string]string{"tool/PKGBUILD": "pkgname=tool\n"},
+	})
+
+	cfg := &config.Config{
+		PollInterval:      60,
+		BranchGracePeriod: 24,
+		Workers:           2,
+		APITimeout:        30,
+		ShutdownTimeout:   1,
+		MaxAttempts:       3,
+		Repos: []config.RepoConfig{{
+			SourceRepoName:        "upstream/tool",
+			FilePath:              "src/main.c",
+			TargetRepoName:        "distro/packages",
+			PullRequestBaseBranch: "main",
+		}},
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+
+	engine, err := New(cfg, WithStateDir(t.TempDir()), WithCacheDir(t.TempDir()), WithClient(gh.Client()), WithClock(clock.Now))
+	if err != nil {
+		t.Fatalf("could not create engine: %v", err)
+	}
+	t.Cleanup(func() { engine.Close() })
+
+	return &testEnv{t: t, clock: clock, gh: gh, source: source, target: target, engine: engine}
+}
+
+// upstreamCommit adds a commit to the source repository, one minute after the current time
+func (e *testEnv) upstreamCommit(message string, files map[string]string) string {
+	e.clock.Advance(time.Minute)
+	return e.source.Commit("main", githubfake.Commit{
+		Message: message,
+		Author:  "Upstream Author",
+		Email:   "author@example.com",
+		Files:   files,
+	})
+}
+
+// check checks all watches once, one minute after the current time
+func (e *testEnv) check() error {
+	e.clock.Advance(time.Minute)
+	return e.engine.CheckOnce(context.Background())
+}
+
+// pullRequests returns the pull requests in the target repository
+func (e *testEnv) pullRequests() []githubfake.PullRequest {
+	return e.target.PullRequests()
+}
+
+// updateBranches returns the branches in the target repository that vigilant created
+func (e *testEnv) updateBranches() []string {
+	var branches []string
+	for _, branch := range e.target.Branches() {
+		if branch != "main" {
+			branches = append(branches, branch)
+		}
+	}
+	return branches
+}
+
+func TestCheckCreatesPullRequest(t *testing.T) {
+	e := newTestEnv(t, nil)
+	sha := e.upstreamCommit("Return 0 from main, thanks @someone\n\nFixes #12", map[string]string{
+		"src/main.c": "int main(void)\n{\n    return 0;\n}\n",
+	})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if want := "src-main.c-update-" + sha[:7]; pr.Head != want {
+		t.Errorf("expected branch %q, got %q", want, pr.Head)
+	}
+	if pr.Title != "Update: Changes in src/main.c" {
+		t.Errorf("unexpected title %q", pr.Title)
+	}
+	if pr.State != "open" || pr.Base != "main" || pr.HeadRepo != "distro/packages" {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+	if !strings.Contains(pr.Body, "@\u200bsomeone") {
+		t.Errorf("expected the mention to be neutralized in the body:\n%s", pr.Body)
+	}
+	if !strings.Contains(pr.Body, "-    return 1;\n+    return 0;") {
+		t.Errorf("expected the diff in the body:\n%s", pr.Body)
+	}
+
+	content, ok := e.target.File(pr.Head, "src-main.c-updates.md")
+	if !ok || content != pr.Body {
+		t.Errorf("expected the body to be committed to the branch, got %q", content)
+	}
+	if message, _, _ := e.target.CommitMessage(pr.Head); message != "Notify about changes to src/main.c" {
+		t.Errorf("unexpected commit message %q", message)
+	}
+
+	if got := e.engine.state.Watch(e.engine.repoConfigs[0].Key()).LastSHA; got != sha {
+		t.Errorf("expected the last synced commit to be %s, got %s", sha, got)
+	}
+	if ops := e.engine.state.Operations(); len(ops) != 0 {
+		t.Errorf("expected an empty outbox, got %+v", ops)
+	}
+
+	// Nothing new upstream, so nothing happens
+	e.check()
+	if n := len(e.pullRequests()); n != 1 {
+		t.Errorf("expected still 1 pull request, got %d", n)
+	}
+}
+
+func TestCheckIgnoresOtherPaths(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Update the README", map[string]string{"README": "A tool\n"})
+	e.check()
+	if n := len(e.pullRequests()); n != 0 {
+		t.Errorf("expected no pull requests, got %d", n)
+	}
+	if branches := e.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected no branches, got %v", branches)
+	}
+}
+
+func TestCheckPaginatesCommits(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.gh.MaxPerPage = 2
+	for i := 0; i < 5; i++ {
+		e.upstreamCommit("Change number "+string(rune('A'+i)), map[string]string{
+			"src/main.c": strings.Repeat("// change\n", i+1),
+		})
+	}
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	for i := 0; i < 5; i++ {
+		if subject := "Change number " + string(rune('A'+i)); !strings.Contains(prs[0].Body, subject) {
+			t.Errorf("expected %q in the body:\n%s", subject, prs[0].Body)
+		}
+	}
+	if n := e.gh.CountRequests(http.MethodGet, "/repos/upstream/tool/commits"); n != 3 {
+		t.Errorf("expected 3 pages of commits to be fetched, got %d", n)
+	}
+}
+
+func TestListCommitsErrorIsRetried(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.gh.Fail(http.MethodGet, "/repos/upstream/tool/commits", http.StatusBadGateway, 1)
+	if err := e.check(); err == nil {
+		t.Error("expected the failed check to be reported")
+	}
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull requests, got %d", n)
+	}
+	if ops := e.engine.state.Operations(); len(ops) != 0 {
+		t.Fatalf("expected an empty outbox, got %+v", ops)
+	}
+
+	if err := e.check(); err != nil {
+		t.Errorf("expected the next check to succeed, got %v", err)
+	}
+	if n := len(e.pullRequests()); n != 1 {
+		t.Errorf("expected the next check to create a pull request, got %d", n)
+	}
+}
+
+func TestPullRequestFailureIsResumed(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.gh.Fail(http.MethodPost, "/repos/distro/packages/pulls", http.StatusInternalServerError, 1)
+	e.check()
+
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull requests, got %d", n)
+	}
+	ops := e.engine.state.Operations()
+	if len(ops) != 1 || ops[0].Step != state.StepBranchCreated || ops[0].Attempts != 1 {
+		t.Fatalf("expected an operation at step %q after 1 attempt, got %+v", state.StepBranchCreated, ops)
+	}
+	branches := e.updateBranches()
+	if len(branches) != 1 {
+		t.Fatalf("expected the branch to be kept for the retry, got %v", branches)
+	}
+
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 || prs[0].Head != branches[0] {
+		t.Fatalf("expected 1 pull request for %s, got %+v", branches[0], prs)
+	}
+	if got := e.updateBranches(); len(got) != 1 {
+		t.Errorf("expected the branch to be reused, got %v", got)
+	}
+	if n := e.gh.CountRequests(http.MethodPost, "/git/commits"); n != 1 {
+		t.Errorf("expected the commit to be created once, got %d", n)
+	}
+	if ops := e.engine.state.Operations(); len(ops) != 0 {
+		t.Errorf("expected an empty outbox, got %+v", ops)
+	}
+}
+
+func TestExistingPullRequestIsAdopted(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+	if n := len(e.pullRequests()); n != 1 {
+		t.Fatalf("expected 1 pull request, got %d", n)
+	}
+
+	// If the response to creating the pull request was lost, resuming finds the existing one, instead of failing
+	op := state.Operation{
+		ID:    "adopt",
+		Watch: e.engine.repoConfigs[0].Key(),
+		Step:  state.StepBranchCreated,
+		Repo:  "distro/packages", HeadRepo: "distro/packages", Base: "main",
+		Branch: e.pullRequests()[0].Head,
+		Title:  "Duplicate",
+	}
+	if err := e.engine.creator.Run(context.Background(), &op); err != nil {
+		t.Fatalf("expected the existing pull request to be adopted, got %v", err)
+	}
+	if op.Number != e.pullRequests()[0].Number {
+		t.Errorf("expected pull request #%d to be adopted, got #%d", e.pullRequests()[0].Number, op.Number)
+	}
+	if n := len(e.pullRequests()); n != 1 {
+		t.Errorf("expected no new pull request, got %d", n)
+	}
+}
+
+func TestOperationIsAbandonedAfterMaxAttempts(t *testing.T) {
+	e := newTestEnv(t, nil)
+	head := e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.gh.Fail(http.MethodPost, "/repos/distro/packages/pulls", http.StatusInternalServerError, -1)
+	for i := 0; i < 3; i++ {
+		e.check()
+	}
+
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull requests, got %d", n)
+	}
+	if branches := e.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected the branch to be rolled back, got %v", branches)
+	}
+	if ops := e.engine.state.Operations(); len(ops) != 0 {
+		t.Errorf("expected an empty outbox, got %+v", ops)
+	}
+	if records := e.engine.state.PullRequests(); len(records) != 0 {
+		t.Errorf("expected no tracked branches, got %+v", records)
+	}
+
+	if sha := e.engine.state.Watch(e.engine.repoConfigs[0].Key()).AbandonedSHA; sha != head {
+		t.Errorf("expected the upstream commit to be recorded as abandoned, got %q", sha)
+	}
+
+	// The abandoned upstream commit is not tried again, but the commits are picked up again with a newer one
+	e.gh.ClearFailures()
+	e.check()
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull request for the abandoned commit, got %d", n)
+	}
+	if result := e.engine.status.result(0); result != resultSkipped {
+		t.Errorf("expected the watch to be skipped, got %s", result)
+	}
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected a pull request for the newer commit, got %d", len(prs))
+	}
+	if !strings.Contains(prs[0].Body, "Return 0") || !strings.Contains(prs[0].Body, "Return 2") {
+		t.Errorf("expected both commits in the body:\n%s", prs[0].Body)
+	}
+	if sha := e.engine.state.Watch(e.engine.repoConfigs[0].Key()).AbandonedSHA; sha != "" {
+		t.Errorf("expected the abandoned commit to be forgotten, got %q", sha)
+	}
+}
+
+func TestInterruptedStepIsNotAnAttempt(t *testing.T) {
+	e := newTestEnv(t, nil)
+	held, release := e.gh.Hold(http.MethodPost, "/repos/distro/packages/pulls")
+	defer release()
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+
+	// Shutting down while the pull request is being opened
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.engine.CheckOnce(ctx)
+		close(done)
+	}()
+	select {
+	case <-held:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the pull request to be opened")
+	}
+	cancel()
+	<-done
+
+	ops := e.engine.state.Operations()
+	if len(ops) != 1 || ops[0].Step != state.StepCommitted || ops[0].Attempts != 0 {
+		t.Fatalf("expected the operation to be kept without a failed attempt, got %+v", ops)
+	}
+	if branches := e.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected the branch to be rolled back, got %v", branches)
+	}
+}
+
+func TestSupersededPullRequestIsClosed(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	if prs[0].State != "closed" || len(prs[0].Comments) != 1 || prs[0].Comments[0] != "Superseded by #2." {
+		t.Errorf("expected #1 to be closed as superseded, got %+v", prs[0])
+	}
+	if prs[1].State != "open" {
+		t.Errorf("expected #2 to be open, got %+v", prs[1])
+	}
+	if !strings.Contains(prs[1].Body, "Return 2") || strings.Contains(prs[1].Body, "Return 0") {
+		t.Errorf("expected only the new commit in the body:\n%s", prs[1].Body)
+	}
+}
+
+func TestMetadataIsApplied(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Labels = []string{"dependencies", "upstream"}
+		c.Repos[0].Assignees = []string{"maintainer"}
+		c.Repos[0].Reviewers = []string{"reviewer"}
+		c.Repos[0].Milestone = "1.0"
+		c.Repos[0].Draft = true
+	})
+	e.target.AddLabel("dependencies")
+	milestone := e.target.AddMilestone("1.0")
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if strings.Join(pr.Labels, ",") != "dependencies,upstream" {
+		t.Errorf("unexpected labels %v", pr.Labels)
+	}
+	if strings.Join(e.target.Labels(), ",") != "dependencies,upstream" {
+		t.Errorf("expected the missing label to be created, got %v", e.target.Labels())
+	}
+	if strings.Join(pr.Assignees, ",") != "maintainer" || strings.Join(pr.Reviewers, ",") != "reviewer" {
+		t.Errorf("unexpected assignees %v or reviewers %v", pr.Assignees, pr.Reviewers)
+	}
+	if pr.Milestone != milestone || !pr.Draft {
+		t.Errorf("expected a draft in milestone %d, got %+v", milestone, pr)
+	}
+}
+
+func TestPullRequestFromFork(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Fork = true
+	})
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 || prs[0].HeadRepo != "vigilant-bot/packages" {
+		t.Fatalf("expected 1 pull request from the fork, got %+v", prs)
+	}
+	if branches := e.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected no branches in the target, got %v", branches)
+	}
+	fork := e.gh.Repo("vigilant-bot/packages")
+	if _, ok := fork.Branch(prs[0].Head); !ok {
+		t.Errorf("expected the branch %s in the fork", prs[0].Head)
+	}
+}
+
+func TestBranchIsDeletedAfterGracePeriod(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+
+	e.target.ClosePullRequest(prs[0].Number)
+	e.check()
+	if branches := e.updateBranches(); len(branches) != 1 {
+		t.Fatalf("expected the branch to be kept during the grace period, got %v", branches)
+	}
+
+	e.clock.Advance(25 * time.Hour)
+	e.check()
+	if branches := e.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected the branch to be deleted, got %v", branches)
+	}
+	if records := e.engine.state.PullRequests(); len(records) != 0 {
+		t.Errorf("expected no tracked branches, got %+v", records)
+	}
+}
+
+func TestLegacyBranchIsDeletedAfterGracePeriod(t *testing.T) {
+	e := newTestEnv(t, nil)
+	ctx := context.Background()
+	const branch = "tool-update-20240229-120000"
+	e.target.Commit(branch, githubfake.Commit{Message: "Update tool", Files: map[string]string{"tool/PKGBUILD": "pkgver=2\n"}})
+	pr, _, err := e.gh.Client().PullRequests.Create(ctx, "distro", "packages", &github.NewPullRequest{
+		Title: github.String("Update tool"),
+		Head:  github.String(branch),
+		Base:  github.String("main"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.target.ClosePullRequest(pr.GetNumber())
+
+	// The grace period is measured with the clock of the engine
+	if err := e.engine.CollectLegacyBranches(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.target.Branch(branch); !ok {
+		t.Fatal("expected the branch to be kept during the grace period")
+	}
+
+	e.clock.Advance(25 * time.Hour)
+	if err := e.engine.CollectLegacyBranches(ctx, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.target.Branch(branch); ok {
+		t.Error("expected the branch to be deleted")
+	}
+}
@@ -0,0 +1,139 @@
+package vigilant
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+)
+
+// legacyBranchPattern matches the branches created by versions of vigilant that did not keep track of them
+var legacyBranchPattern = regexp.MustCompile(`-update-\d{8}-\d{6}$`)
+
+// CollectGarbage deletes the branches of merged or closed pull requests once the grace period is over.
+// Branches that never got a pull request are deleted when the grace period has passed since they were created.
+// If dryRun is true, only log what would be deleted.
+func (e *Engine) CollectGarbage(ctx context.Context, dryRun bool) {
+	now := e.now()
+	for _, record := range e.state.PullRequests() {
+		owner, repo := config.SplitRepoName(record.Repo)
+		if record.ClosedAt.IsZero() {
+			if record.Number == 0 {
+				record.ClosedAt = record.CreatedAt
+			} else {
+				pr, _, err := e.githubClient.PullRequests.Get(ctx, owner, repo, record.Number)
+				if err != nil {
+					e.logger.Warn("Could not check the state of a pull request", "pr", record.URL, "error", err)
+					continue
+				}
+				if pr.GetState() != "closed" {
+					continue
+				}
+				record.ClosedAt = pr.GetClosedAt().Time
+				if record.ClosedAt.IsZero() {
+					record.ClosedAt = now
+				}
+				if !dryRun {
+					if err := e.state.UpdatePullRequest(record); err != nil {
+						e.logger.Error("Could not save state", "error", err)
+					}
+				}
+			}
+		}
+		if now.Sub(record.ClosedAt) < e.branchGracePeriod {
+			continue
+		}
+		if dryRun {
+			e.logger.Info("Would delete branch", "branch", record.Branch, "repo", record.BranchRepo())
+			continue
+		}
+		branchOwner, branchRepo := config.SplitRepoName(record.BranchRepo())
+		if err := e.creator.DeleteBranch(ctx, branchOwner, branchRepo, record.Branch); err != nil {
+			e.logger.Error("Could not delete branch", "branch", record.Branch, "repo", record.BranchRepo(), "error", err)
+			continue
+		}
+		e.logger.Info("Deleted branch", "branch", record.Branch, "repo", record.BranchRepo())
+		if err := e.state.RemovePullRequest(record.Repo, record.Branch); err != nil {
+			e.logger.Error("Could not save state", "error", err)
+		}
+	}
+}
+
+// CollectLegacyBranches deletes untracked branches that look like they were created by vigilant,
+// if they have no open pull request and any closed pull request was closed before the grace period.
+func (e *Engine) CollectLegacyBranches(ctx context.Context, dryRun bool) error {
+	now := e.now()
+	tracked := make(map[string]bool)
+	for _, record := range e.state.PullRequests() {
+		tracked[record.Repo+":"+record.Branch] = true
+	}
+	seen := make(map[string]bool)
+	for _, watch := range e.repoConfigs {
+		if seen[watch.TargetRepoName] {
+			continue
+		}
+		seen[watch.TargetRepoName] = true
+		owner, repo := config.SplitRepoName(watch.TargetRepoName)
+
+		opts := &github.ReferenceListOptions{
+			Ref:         "heads/",
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		var branches []string
+		for {
+			refs, resp, err := e.githubClient.Git.ListMatchingRefs(ctx, owner, repo, opts)
+			if err != nil {
+				return fmt.Errorf("could not list branches in %s: %w", watch.TargetRepoName, err)
+			}
+			for _, ref := range refs {
+				branch := strings.TrimPrefix(ref.GetRef(), "refs/heads/")
+				if legacyBranchPattern.MatchString(branch) && !tracked[watch.TargetRepoName+":"+branch] {
+					branches = append(branches, branch)
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+
+		for _, branch := range branches {
+			prs, _, err := e.githubClient.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+				Head:  owner + ":" + branch,
+				State: "all",
+			})
+			if err != nil {
+				e.logger.Warn("Could not list the pull requests of a branch", "branch", branch, "repo", watch.TargetRepoName, "error", err)
+				continue
+			}
+			keep := false
+			for _, pr := range prs {
+				closedAt := pr.GetClosedAt().Time
+				if closedAt.IsZero() {
+					// Like in CollectGarbage, a closed pull request without a closing time was closed just now
+					closedAt = now
+				}
+				if pr.GetState() == "open" || now.Sub(closedAt) < e.branchGracePeriod {
+					keep = true
+					break
+				}
+			}
+			if keep {
+				continue
+			}
+			if dryRun {
+				e.logger.Info("Would delete untracked branch", "branch", branch, "repo", watch.TargetRepoName)
+				continue
+			}
+			if err := e.creator.DeleteBranch(ctx, owner, repo, branch); err != nil {
+				e.logger.Error("Could not delete branch", "branch", branch, "repo", watch.TargetRepoName, "error", err)
+				continue
+			}
+			e.logger.Info("Deleted untracked branch", "branch", branch, "repo", watch.TargetRepoName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+// Package githubfake is an in-memory fake of the parts of the GitHub REST API that vigilant uses:
+// the authenticated user, repositories, commits, compare, git objects and refs, contents, tarballs,
+// forks, pull requests, issues and labels. It also serves the modules in its repositories
+// as a Go module proxy, under /goproxy/.
+// It runs on an httptest server, so that a real go-github client can talk to it.
+package githubfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+)
+
+// Server is a fake GitHub API server
+type Server struct {
+	// User is the login of the owner of the token, which is the owner of new forks
+	User string
+
+	// Scopes is the X-OAuth-Scopes header of responses, as for a classic token.
+	// It is not sent if it is empty, as for a fine-grained token.
+	Scopes string
+
+	// MaxPerPage limits the page size of list endpoints, regardless of the requested page size.
+	// Set it to a small number to test pagination.
+	MaxPerPage int
+
+	// Now returns the current time, used for new commits and pull requests
+	Now func() time.Time
+
+	mu       sync.Mutex
+	srv      *httptest.Server
+	repos    map[string]*Repo
+	failures []*failure
+	holds    []*hold
+	requests []string
+}
+
+// hold makes requests wait until they are released
+type hold struct {
+	method  string
+	path    string
+	held    chan struct{} // closed when the first request waits
+	release chan struct{}
+	once    sync.Once // closes held
+}
+
+// failure is an injected error response
+type failure struct {
+	method string
+	path   string
+	status int
+	times  int // the number of requests left to fail, or negative to fail all of them
+}
+
+// New starts a fake GitHub API server. Close it when done.
+func New() *Server {
+	s := &Server{
+		User:  "vigilant-bot",
+		Now:   time.Now,
+		repos: make(map[string]*Repo),
+	}
+	s.srv = httptest.NewServer(s.routes())
+	return s
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// URL returns the base URL of the API, with a trailing slash
+func (s *Server) URL() string {
+	return s.srv.URL + "/"
+}
+
+// Client returns a go-github client that talks to the fake
+func (s *Server) Client() *github.Client {
+	client := github.NewClient(s.srv.Client())
+	client.BaseURL, _ = url.Parse(s.URL())
+	return client
+}
+
+// Fail makes the next requests with the given method, and a path that contains the given string,
+// fail with the given status code. If times is negative, all matching requests fail.
+func (s *Server) Fail(method, path string, status, times int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &failure{method: method, path: path, status: status, times: times})
+}
+
+// Hold makes the requests with the given method, and a path that contains the given string, wait until release
+// is called, or until the client gives up, which fails the request. The held channel is closed when the first
+// request starts waiting. Release can be called more than once.
+func (s *Server) Hold(method, path string) (held <-chan struct{}, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := &hold{method: method, path: path, held: make(chan struct{}), release: make(chan struct{})}
+	s.holds = append(s.holds, h)
+	var released sync.Once
+	return h.held, func() {
+		released.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.holds = slices.DeleteFunc(s.holds, func(other *hold) bool { return other == h })
+			close(h.release)
+		})
+	}
+}
+
+// wait waits until the holds of a request are released, and returns false if the client gave up first
+func (s *Server) wait(r *http.Request) bool {
+	s.mu.Lock()
+	var holds []*hold
+	for _, h := range s.holds {
+		if h.method == r.Method && strings.Contains(r.URL.Path, h.path) {
+			holds = append(holds, h)
+		}
+	}
+	s.mu.Unlock()
+	for _, h := range holds {
+		h.once.Do(func() { close(h.held) })
+		select {
+		case <-h.release:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	return true
+}
+
+// ClearFailures removes all injected errors
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = nil
+}
+
+// Requests returns all requests that have been made, as "METHOD /path"
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// CountRequests returns how many requests were made with the given method and a path that contains the given string
+func (s *Server) CountRequests(method, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, r := range s.requests {
+		m, p, _ := strings.Cut(r, " ")
+		if m == method && strings.Contains(p, path) {
+			n++
+		}
+	}
+	return n
+}
+
+// AddRepo adds an empty repository with the given owner/name and default branch
+func (s *Server) AddRepo(fullName, defaultBranch string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	owner, name, _ := strings.Cut(fullName, "/")
+	repo := newRepo(s, owner, name, defaultBranch, newObjects())
+	s.repos[fullName] = repo
+	return repo
+}
+
+// Repo returns the repository with the given owner/name, or nil
+func (s *Server) Repo(fullName string) *Repo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos[fullName]
+}
+
+// repoHandler handles a request for a repository that exists
+type repoHandler func(w http.ResponseWriter, r *http.Request, repo *Repo)
+
+// routes returns the handler for all supported endpoints
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := func(pattern string, h repoHandler) {
+		mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+			if !s.wait(r) {
+				return
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+			if s.injectFailure(w, r) {
+				return
+			}
+			repo := s.repos[r.PathValue("owner")+"/"+r.PathValue("repo")]
+			if repo == nil {
+				writeError(w, http.StatusNotFound, "Not Found")
+				return
+			}
+			h(w, r, repo)
+		})
+	}
+
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		if s.injectFailure(w, r) {
+			return
+		}
+		if s.Scopes != "" {
+			w.Header().Set("X-OAuth-Scopes", s.Scopes)
+		}
+		writeJSON(w, http.StatusOK, &github.User{Login: github.String(s.User)})
+	})
+
+	mux.HandleFunc("GET /goproxy/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		if s.injectFailure(w, r) {
+			return
+		}
+		s.goproxy(w, r)
+	})
+
+	handle("GET /repos/{owner}/{repo}", s.getRepo)
+	handle("POST /repos/{owner}/{repo}/forks", s.createFork)
+	handle("POST /repos/{owner}/{repo}/merge-upstream", s.mergeUpstream)
+
+	handle("GET /repos/{owner}/{repo}/commits", s.listCommits)
+	handle("GET /repos/{owner}/{repo}/commits/{ref}", s.getCommit)
+	handle("GET /repos/{owner}/{repo}/compare/{basehead}", s.compareCommits)
+	handle("GET /repos/{owner}/{repo}/contents/{path...}", s.getContents)
+	handle("GET /repos/{owner}/{repo}/tags", s.listTags)
+	handle("GET /repos/{owner}/{repo}/releases", s.listReleases)
+	handle("GET /repos/{owner}/{repo}/tarball/{ref...}", s.tarball)
+
+	handle("GET /repos/{owner}/{repo}/git/commits/{sha}", s.getGitCommit)
+	handle("POST /repos/{owner}/{repo}/git/commits", s.createGitCommit)
+	handle("GET /repos/{owner}/{repo}/git/blobs/{sha}", s.getBlob)
+	handle("POST /repos/{owner}/{repo}/git/blobs", s.createBlob)
+	handle("GET /repos/{owner}/{repo}/git/trees/{sha}", s.getTree)
+	handle("POST /repos/{owner}/{repo}/git/trees", s.createTree)
+	handle("GET /repos/{owner}/{repo}/git/ref/{ref...}", s.getRef)
+	handle("GET /repos/{owner}/{repo}/git/matching-refs/{ref...}", s.listMatchingRefs)
+	handle("POST /repos/{owner}/{repo}/git/refs", s.createRef)
+	handle("PATCH /repos/{owner}/{repo}/git/refs/{ref...}", s.updateRef)
+	handle("DELETE /repos/{owner}/{repo}/git/refs/{ref...}", s.deleteRef)
+
+	handle("GET /repos/{owner}/{repo}/pulls", s.listPullRequests)
+	handle("POST /repos/{owner}/{repo}/pulls", s.createPullRequest)
+	handle("GET /repos/{owner}/{repo}/pulls/{number}", s.getPullRequest)
+	handle("PATCH /repos/{owner}/{repo}/pulls/{number}", s.editPullRequest)
+	handle("POST /repos/{owner}/{repo}/pulls/{number}/requested_reviewers", s.requestReviewers)
+
+	handle("PATCH /repos/{owner}/{repo}/issues/{number}", s.editIssue)
+	handle("POST /repos/{owner}/{repo}/issues/{number}/comments", s.createComment)
+	handle("POST /repos/{owner}/{repo}/issues/{number}/labels", s.addLabels)
+	handle("POST /repos/{owner}/{repo}/issues/{number}/assignees", s.addAssignees)
+	handle("GET /repos/{owner}/{repo}/labels/{name}", s.getLabel)
+	handle("POST /repos/{owner}/{repo}/labels", s.createLabel)
+	handle("GET /repos/{owner}/{repo}/milestones", s.listMilestones)
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		s.mu.Unlock()
+		writeError(w, http.StatusNotImplemented, "githubfake does not support "+r.Method+" "+r.URL.Path)
+	})
+	return mux
+}
+
+// injectFailure writes an injected error response, if one matches the request
+func (s *Server) injectFailure(w http.ResponseWriter, r *http.Request) bool {
+	for i, f := range s.failures {
+		if f.method != r.Method || !strings.Contains(r.URL.Path, f.path) {
+			continue
+		}
+		if f.times > 0 {
+			f.times--
+			if f.times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		writeError(w, f.status, "injected failure")
+		return true
+	}
+	return false
+}
+
+// paginate returns the range of the items on the requested page, out of n items,
+// and adds a Link header that points to the next page if there is one
+func (s *Server) paginate(w http.ResponseWriter, r *http.Request, n int) (start, end int) {
+	q := r.URL.Query()
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	if s.MaxPerPage > 0 && perPage > s.MaxPerPage {
+		perPage = s.MaxPerPage
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	start = min((page-1)*perPage, n)
+	end = min(start+perPage, n)
+	if end < n {
+		q.Set("page", strconv.Itoa(page+1))
+		next := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="next"`, s.srv.URL, next.String()))
+	}
+	return start, end
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a GitHub style error response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"message": message})
+}
+
+// readJSON decodes the request body into v, and writes an error response if that fails
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "Problems parsing JSON")
+		return false
+	}
+	return true
+}
+
+// pathNumber returns the number in the given path segment, and writes an error response if it is not a number
+func pathNumber(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	n, err := strconv.Atoi(r.PathValue(name))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return 0, false
+	}
+	return n, true
+}
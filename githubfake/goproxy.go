@@ -0,0 +1,131 @@
+package githubfake
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// majorSuffix matches the major version suffix of a module path, like /v2
+var majorSuffix = regexp.MustCompile(`/v([2-9]|[1-9][0-9]+)$`)
+
+// pseudoVersion matches a pseudo-version that the proxy makes, like v0.0.0-20240301120000-abcdef123456
+var pseudoVersion = regexp.MustCompile(`^v[0-9]+\.0\.0-[0-9]{14}-([0-9a-f]{12})$`)
+
+// goproxy serves the modules of the repositories like a Go module proxy, where github.com/owner/repo/dir is the module
+// in the directory dir of the repository owner/repo. A version is a tag of the module, like dir/v1.2.3, and a commit
+// is the pseudo-version vN.0.0-yyyymmddhhmmss-abcdef123456, without looking for an earlier tag.
+// Only the .info, .mod and .zip files are supported.
+func (s *Server) goproxy(w http.ResponseWriter, r *http.Request) {
+	modulePath, file, ok := strings.Cut(r.PathValue("path"), "/@v/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	modulePath, file = unescapeModule(modulePath), unescapeModule(file)
+	repoPath, ok := strings.CutPrefix(modulePath, "github.com/")
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found: "+modulePath+" is not on github.com")
+		return
+	}
+	major := "v0"
+	if m := majorSuffix.FindStringSubmatch(repoPath); m != nil {
+		major = "v" + m[1]
+		repoPath = strings.TrimSuffix(repoPath, m[0])
+	}
+	parts := strings.SplitN(repoPath, "/", 3)
+	if len(parts) < 2 || s.repos[parts[0]+"/"+parts[1]] == nil {
+		writeError(w, http.StatusNotFound, "not found: "+modulePath)
+		return
+	}
+	repo := s.repos[parts[0]+"/"+parts[1]]
+	dir := ""
+	if len(parts) == 3 {
+		dir = parts[2]
+	}
+
+	ext := file[strings.LastIndexByte(file, '.')+1:]
+	query := strings.TrimSuffix(file, "."+ext)
+	version, sha, ok := repo.moduleVersion(dir, major, query)
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("not found: %s@%s: unknown revision", modulePath, query))
+		return
+	}
+	files := repo.objects.files(sha)
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	goMod, ok := files[prefix+"go.mod"]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("not found: %s@%s: no go.mod in %s", modulePath, version, dir))
+		return
+	}
+
+	switch ext {
+	case "info":
+		writeJSON(w, http.StatusOK, map[string]any{"Version": version, "Time": repo.objects.commits[sha].date.UTC()})
+	case "mod":
+		w.Write([]byte(goMod))
+	case "zip":
+		names := make([]string, 0, len(files))
+		for name := range files {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for _, name := range names {
+			f, _ := zw.Create(modulePath + "@" + version + "/" + strings.TrimPrefix(name, prefix))
+			f.Write([]byte(files[name]))
+		}
+		zw.Close()
+		w.Header().Set("Content-Type", "application/zip")
+		w.Write(buf.Bytes())
+	default:
+		writeError(w, http.StatusNotFound, "not found: githubfake does not serve @v/"+file)
+	}
+}
+
+// moduleVersion resolves a version, a tag or a commit of the module in dir to a version and a commit
+func (r *Repo) moduleVersion(dir, major, query string) (version, sha string, ok bool) {
+	tag := query
+	if dir != "" {
+		tag = dir + "/" + query
+	}
+	if sha, ok := r.refs["tags/"+tag]; ok && strings.HasPrefix(query, "v") {
+		return query, sha, true
+	}
+	if m := pseudoVersion.FindStringSubmatch(query); m != nil {
+		query = m[1]
+	}
+	if sha, ok = r.resolve(query); !ok {
+		return "", "", false
+	}
+	date := r.objects.commits[sha].date.UTC().Format("20060102150405")
+	return fmt.Sprintf("%s.0.0-%s-%s", major, date, sha[:12]), sha, true
+}
+
+// unescapeModule reverses the escaping of a module path or version, where !x is X
+func unescapeModule(s string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range s {
+		if c == '!' {
+			upper = true
+			continue
+		}
+		if upper {
+			c -= 'a' - 'A'
+			upper = false
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
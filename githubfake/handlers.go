@@ -0,0 +1,1072 @@
+package githubfake
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+)
+
+// htmlURL returns the URL of something in the repository on github.com
+func (r *Repo) htmlURL(format string, args ...any) string {
+	return "https://github.com/" + r.FullName() + "/" + fmt.Sprintf(format, args...)
+}
+
+func (s *Server) getRepo(w http.ResponseWriter, _ *http.Request, repo *Repo) {
+	result := &github.Repository{
+		Name:          github.String(repo.name),
+		FullName:      github.String(repo.FullName()),
+		DefaultBranch: github.String(repo.defaultBranch),
+		Fork:          github.Bool(repo.parent != nil),
+		HTMLURL:       github.String("https://github.com/" + repo.FullName()),
+		Permissions:   map[string]bool{"pull": true, "push": !repo.readOnly},
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// createFork forks the repository into the account of s.User. The fork shares the objects of the repository.
+func (s *Server) createFork(w http.ResponseWriter, _ *http.Request, repo *Repo) {
+	name := s.User + "/" + repo.name
+	fork := s.repos[name]
+	if fork == nil {
+		fork = newRepo(s, s.User, repo.name, repo.defaultBranch, repo.objects)
+		fork.parent = repo
+		for ref, sha := range repo.refs {
+			fork.refs[ref] = sha
+		}
+		s.repos[name] = fork
+	}
+	writeJSON(w, http.StatusAccepted, &github.Repository{
+		Name:     github.String(fork.name),
+		FullName: github.String(fork.FullName()),
+		Fork:     github.Bool(true),
+	})
+}
+
+// mergeUpstream fast-forwards a branch of a fork to the same branch in the parent repository
+func (s *Server) mergeUpstream(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		Branch string `json:"branch"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if repo.parent == nil {
+		writeError(w, http.StatusUnprocessableEntity, "This repository is not a fork")
+		return
+	}
+	upstream, ok := repo.parent.refs["heads/"+body.Branch]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Branch not found")
+		return
+	}
+	current, ok := repo.refs["heads/"+body.Branch]
+	if ok && current != upstream && !repo.isAncestor(current, upstream) {
+		writeError(w, http.StatusConflict, "There are merge conflicts")
+		return
+	}
+	repo.refs["heads/"+body.Branch] = upstream
+	writeJSON(w, http.StatusOK, &github.RepoMergeUpstreamResult{
+		MergeType:  github.String("fast-forward"),
+		BaseBranch: github.String(repo.parent.owner + ":" + body.Branch),
+	})
+}
+
+// repositoryCommit converts a commit to the format of the commits and compare endpoints
+func (r *Repo) repositoryCommit(c *commit) *github.RepositoryCommit {
+	author := &github.CommitAuthor{
+		Name:  github.String(c.author),
+		Email: github.String(c.email),
+		Date:  &github.Timestamp{Time: c.date},
+	}
+	result := &github.RepositoryCommit{
+		SHA:     github.String(c.sha),
+		HTMLURL: github.String(r.htmlURL("commit/%s", c.sha)),
+		Commit: &github.Commit{
+			SHA:       github.String(c.sha),
+			Message:   github.String(c.message),
+			Author:    author,
+			Committer: author,
+			Tree:      &github.Tree{SHA: github.String(c.tree)},
+		},
+	}
+	for _, parent := range c.parents {
+		result.Parents = append(result.Parents, &github.Commit{SHA: github.String(parent)})
+	}
+	return result
+}
+
+// listCommits lists the commits of a branch or SHA, newest first, optionally filtered by path and date
+func (s *Server) listCommits(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	q := r.URL.Query()
+	head, ok := repo.resolve(q.Get("sha"))
+	if !ok {
+		if len(repo.refs) == 0 {
+			writeError(w, http.StatusConflict, "Git Repository is empty.")
+			return
+		}
+		writeError(w, http.StatusNotFound, "No commit found for SHA: "+q.Get("sha"))
+		return
+	}
+	var since, until time.Time
+	if v := q.Get("since"); v != "" {
+		since, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("until"); v != "" {
+		until, _ = time.Parse(time.RFC3339, v)
+	}
+	var commits []*github.RepositoryCommit
+	for _, c := range repo.firstParents(head) {
+		if !since.IsZero() && c.date.Before(since) {
+			continue
+		}
+		if !until.IsZero() && c.date.After(until) {
+			continue
+		}
+		if p := q.Get("path"); p != "" && !repo.touches(c, p) {
+			continue
+		}
+		commits = append(commits, repo.repositoryCommit(c))
+	}
+	start, end := s.paginate(w, r, len(commits))
+	writeJSON(w, http.StatusOK, commits[start:end])
+}
+
+// getCommit returns a commit of a branch, tag or SHA
+func (s *Server) getCommit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	sha, ok := repo.resolve(r.PathValue("ref"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for SHA: "+r.PathValue("ref"))
+		return
+	}
+	writeJSON(w, http.StatusOK, repo.repositoryCommit(repo.objects.commits[sha]))
+}
+
+// compareCommits compares two commits, given as BASE...HEAD
+func (s *Server) compareCommits(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	baseRef, headRef, ok := strings.Cut(r.PathValue("basehead"), "...")
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	base, ok := repo.resolve(baseRef)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for "+baseRef)
+		return
+	}
+	head, ok := repo.resolve(headRef)
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for "+headRef)
+		return
+	}
+
+	// The commits from base to head, oldest first, which are none if head is behind base
+	behind := base != head && repo.isAncestor(head, base)
+	var commits []*github.RepositoryCommit
+	for _, c := range repo.firstParents(head) {
+		if c.sha == base || behind {
+			break
+		}
+		commits = append([]*github.RepositoryCommit{repo.repositoryCommit(c)}, commits...)
+	}
+
+	before, after := repo.objects.files(base), repo.objects.files(head)
+	var paths []string
+	for p := range before {
+		if _, ok := after[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	for p, content := range after {
+		if old, ok := before[p]; !ok || old != content {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	var files []*github.CommitFile
+	for _, p := range paths {
+		old, inBefore := before[p]
+		new, inAfter := after[p]
+		status := "modified"
+		switch {
+		case !inBefore:
+			status = "added"
+		case !inAfter:
+			status = "removed"
+		}
+		patch, additions, deletions := unifiedPatch(old, new)
+		files = append(files, &github.CommitFile{
+			SHA:       github.String(blobSHA([]byte(new))),
+			Filename:  github.String(p),
+			Status:    github.String(status),
+			Additions: github.Int(additions),
+			Deletions: github.Int(deletions),
+			Changes:   github.Int(additions + deletions),
+			Patch:     github.String(patch),
+		})
+	}
+
+	status := "ahead"
+	switch {
+	case base == head:
+		status = "identical"
+	case behind:
+		status = "behind"
+	case !repo.isAncestor(base, head):
+		status = "diverged"
+	}
+	writeJSON(w, http.StatusOK, &github.CommitsComparison{
+		BaseCommit:   repo.repositoryCommit(repo.objects.commits[base]),
+		Status:       github.String(status),
+		AheadBy:      github.Int(len(commits)),
+		TotalCommits: github.Int(len(commits)),
+		Commits:      commits,
+		Files:        files,
+		HTMLURL:      github.String(repo.htmlURL("compare/%s...%s", baseRef, headRef)),
+	})
+}
+
+// listTags lists the tags, newest first
+func (s *Server) listTags(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var tags []*github.RepositoryTag
+	for i := len(repo.tags) - 1; i >= 0; i-- {
+		name := repo.tags[i]
+		tags = append(tags, &github.RepositoryTag{
+			Name:   github.String(name),
+			Commit: &github.Commit{SHA: github.String(repo.refs["tags/"+name])},
+		})
+	}
+	start, end := s.paginate(w, r, len(tags))
+	writeJSON(w, http.StatusOK, tags[start:end])
+}
+
+// listReleases lists the releases, newest first
+func (s *Server) listReleases(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var releases []*github.RepositoryRelease
+	for i := len(repo.releases) - 1; i >= 0; i-- {
+		release := repo.releases[i]
+		releases = append(releases, &github.RepositoryRelease{
+			ID:         github.Int64(int64(i + 1)),
+			TagName:    github.String(release.Tag),
+			Name:       github.String(release.Name),
+			Draft:      github.Bool(release.Draft),
+			Prerelease: github.Bool(release.Prerelease),
+			HTMLURL:    github.String(repo.htmlURL("releases/tag/%s", release.Tag)),
+		})
+	}
+	start, end := s.paginate(w, r, len(releases))
+	writeJSON(w, http.StatusOK, releases[start:end])
+}
+
+// tarball returns a gzipped tar archive of the files at a ref, in a directory named after the repository and the commit.
+// Unlike GitHub, which redirects to a download server, the archive is returned right away. It is the same for the same commit.
+func (s *Server) tarball(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	sha, ok := repo.resolve(r.PathValue("ref"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	c := repo.objects.commits[sha]
+	files := repo.objects.files(sha)
+	paths := make([]string, 0, len(files))
+	for file := range files {
+		paths = append(paths, file)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	prefix := fmt.Sprintf("%s-%s-%s/", repo.owner, repo.name, sha[:7])
+	for _, file := range paths {
+		tw.WriteHeader(&tar.Header{Name: prefix + file, Mode: 0o644, Size: int64(len(files[file])), ModTime: c.date, Format: tar.FormatPAX})
+		tw.Write([]byte(files[file]))
+	}
+	tw.Close()
+	gz.Close()
+	w.Header().Set("Content-Type", "application/x-gzip")
+	w.Write(buf.Bytes())
+}
+
+// getContents returns a file, or the entries of a directory
+func (s *Server) getContents(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	sha, ok := repo.resolve(r.URL.Query().Get("ref"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "No commit found for the ref "+r.URL.Query().Get("ref"))
+		return
+	}
+	name := strings.Trim(r.PathValue("path"), "/")
+	tree := repo.objects.trees[repo.objects.commits[sha].tree]
+	if commit, ok := strings.CutPrefix(tree[name], gitlinkPrefix); ok {
+		writeJSON(w, http.StatusOK, &github.RepositoryContent{
+			Type: github.String("submodule"),
+			Name: github.String(path.Base(name)),
+			Path: github.String(name),
+			SHA:  github.String(commit),
+			Size: github.Int(0),
+		})
+		return
+	}
+	if blob, ok := tree[name]; ok {
+		writeJSON(w, http.StatusOK, &github.RepositoryContent{
+			Type:     github.String("file"),
+			Name:     github.String(path.Base(name)),
+			Path:     github.String(name),
+			SHA:      github.String(blob),
+			Size:     github.Int(len(repo.objects.blobs[blob])),
+			Encoding: github.String("base64"),
+			Content:  github.String(base64.StdEncoding.EncodeToString(repo.objects.blobs[blob])),
+		})
+		return
+	}
+
+	// List the files and directories right below the directory
+	prefix := ""
+	if name != "" {
+		prefix = name + "/"
+	}
+	entries := make(map[string]*github.RepositoryContent)
+	for file, blob := range tree {
+		rest, ok := strings.CutPrefix(file, prefix)
+		if !ok {
+			continue
+		}
+		if dir, _, isDir := strings.Cut(rest, "/"); isDir {
+			entries[dir] = &github.RepositoryContent{
+				Type: github.String("dir"),
+				Name: github.String(dir),
+				Path: github.String(prefix + dir),
+			}
+			continue
+		}
+		entries[rest] = &github.RepositoryContent{
+			Type: github.String("file"),
+			Name: github.String(rest),
+			Path: github.String(file),
+			SHA:  github.String(blob),
+			Size: github.Int(len(repo.objects.blobs[blob])),
+		}
+		if commit, ok := strings.CutPrefix(blob, gitlinkPrefix); ok {
+			entries[rest].Type, entries[rest].SHA, entries[rest].Size = github.String("submodule"), github.String(commit), github.Int(0)
+		}
+	}
+	if len(entries) == 0 {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	names := make([]string, 0, len(entries))
+	for entry := range entries {
+		names = append(names, entry)
+	}
+	sort.Strings(names)
+	list := make([]*github.RepositoryContent, 0, len(names))
+	for _, entry := range names {
+		list = append(list, entries[entry])
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// gitCommit converts a commit to the format of the Git Data API
+func gitCommit(c *commit) *github.Commit {
+	author := &github.CommitAuthor{
+		Name:  github.String(c.author),
+		Email: github.String(c.email),
+		Date:  &github.Timestamp{Time: c.date},
+	}
+	result := &github.Commit{
+		SHA:          github.String(c.sha),
+		Message:      github.String(c.message),
+		Author:       author,
+		Committer:    author,
+		Tree:         &github.Tree{SHA: github.String(c.tree)},
+		Verification: &github.SignatureVerification{Verified: github.Bool(c.signed)},
+	}
+	for _, parent := range c.parents {
+		result.Parents = append(result.Parents, &github.Commit{SHA: github.String(parent)})
+	}
+	return result
+}
+
+func (s *Server) getGitCommit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	c, ok := repo.objects.commits[r.PathValue("sha")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, gitCommit(c))
+}
+
+func (s *Server) createGitCommit(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		Message   string               `json:"message"`
+		Tree      string               `json:"tree"`
+		Parents   []string             `json:"parents"`
+		Author    *github.CommitAuthor `json:"author"`
+		Signature string               `json:"signature"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if _, ok := repo.objects.trees[body.Tree]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Tree SHA does not exist")
+		return
+	}
+	for _, parent := range body.Parents {
+		if _, ok := repo.objects.commits[parent]; !ok {
+			writeError(w, http.StatusUnprocessableEntity, "Parent SHA does not exist or is not a commit object")
+			return
+		}
+	}
+	c := &commit{
+		tree:    body.Tree,
+		parents: body.Parents,
+		message: body.Message,
+		author:  s.User,
+		date:    s.Now(),
+		signed:  body.Signature != "",
+	}
+	if body.Author != nil {
+		c.author, c.email = body.Author.GetName(), body.Author.GetEmail()
+		if !body.Author.GetDate().IsZero() {
+			c.date = body.Author.GetDate().Time
+		}
+	}
+	repo.objects.addCommit(c)
+	writeJSON(w, http.StatusCreated, gitCommit(c))
+}
+
+func (s *Server) getBlob(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	content, ok := repo.objects.blobs[r.PathValue("sha")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Blob{
+		SHA:      github.String(r.PathValue("sha")),
+		Content:  github.String(base64.StdEncoding.EncodeToString(content)),
+		Encoding: github.String("base64"),
+		Size:     github.Int(len(content)),
+	})
+}
+
+func (s *Server) createBlob(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	content := []byte(body.Content)
+	if body.Encoding == "base64" {
+		var err error
+		if content, err = base64.StdEncoding.DecodeString(body.Content); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, "Invalid base64 content")
+			return
+		}
+	}
+	sha := repo.objects.addBlob(content)
+	writeJSON(w, http.StatusCreated, &github.Blob{SHA: github.String(sha)})
+}
+
+// treeResponse converts a tree to the format of the Git Data API, with only the blobs and submodules listed
+func treeResponse(sha string, files map[string]string, blobs map[string][]byte) *github.Tree {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	tree := &github.Tree{SHA: github.String(sha), Truncated: github.Bool(false)}
+	for _, p := range paths {
+		if commit, ok := strings.CutPrefix(files[p], gitlinkPrefix); ok {
+			tree.Entries = append(tree.Entries, &github.TreeEntry{
+				Path: github.String(p),
+				Mode: github.String("160000"),
+				Type: github.String("commit"),
+				SHA:  github.String(commit),
+			})
+			continue
+		}
+		tree.Entries = append(tree.Entries, &github.TreeEntry{
+			Path: github.String(p),
+			Mode: github.String("100644"),
+			Type: github.String("blob"),
+			SHA:  github.String(files[p]),
+			Size: github.Int(len(blobs[files[p]])),
+		})
+	}
+	return tree
+}
+
+func (s *Server) getTree(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	// The tree of a commit can also be given by the commit, or a branch or tag
+	sha := r.PathValue("sha")
+	if _, ok := repo.objects.trees[sha]; !ok {
+		if commit, ok := repo.resolve(sha); ok {
+			sha = repo.objects.commits[commit].tree
+		}
+	}
+	files, ok := repo.objects.trees[sha]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, treeResponse(sha, files, repo.objects.blobs))
+}
+
+func (s *Server) createTree(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		BaseTree string `json:"base_tree"`
+		Tree     []struct {
+			Path    string  `json:"path"`
+			Mode    string  `json:"mode"`
+			Type    string  `json:"type"`
+			SHA     *string `json:"sha"`
+			Content *string `json:"content"`
+		} `json:"tree"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	files := make(map[string]string)
+	if body.BaseTree != "" {
+		base, ok := repo.objects.trees[body.BaseTree]
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, "base_tree is not a valid tree")
+			return
+		}
+		for p, blob := range base {
+			files[p] = blob
+		}
+	}
+	for _, entry := range body.Tree {
+		switch {
+		case entry.Type == "commit" && entry.SHA != nil:
+			if entry.Mode != "160000" {
+				writeError(w, http.StatusUnprocessableEntity, "tree.mode of a commit must be 160000")
+				return
+			}
+			files[entry.Path] = gitlinkPrefix + *entry.SHA
+		case entry.Content != nil:
+			files[entry.Path] = repo.objects.addBlob([]byte(*entry.Content))
+		case entry.SHA != nil:
+			if _, ok := repo.objects.blobs[*entry.SHA]; !ok {
+				writeError(w, http.StatusUnprocessableEntity, "tree.sha "+*entry.SHA+" is not a valid blob")
+				return
+			}
+			files[entry.Path] = *entry.SHA
+		default:
+			delete(files, entry.Path)
+		}
+	}
+	sha := repo.objects.addTree(files)
+	writeJSON(w, http.StatusCreated, treeResponse(sha, files, repo.objects.blobs))
+}
+
+// reference converts a ref to the format of the Git Data API
+func (r *Repo) reference(ref, sha string) *github.Reference {
+	return &github.Reference{
+		Ref: github.String("refs/" + ref),
+		Object: &github.GitObject{
+			Type: github.String("commit"),
+			SHA:  github.String(sha),
+		},
+	}
+}
+
+func (s *Server) getRef(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	ref := r.PathValue("ref")
+	sha, ok := repo.refs[ref]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, repo.reference(ref, sha))
+}
+
+func (s *Server) listMatchingRefs(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	prefix := r.PathValue("ref")
+	var names []string
+	for ref := range repo.refs {
+		if strings.HasPrefix(ref, prefix) {
+			names = append(names, ref)
+		}
+	}
+	sort.Strings(names)
+	start, end := s.paginate(w, r, len(names))
+	refs := make([]*github.Reference, 0, end-start)
+	for _, ref := range names[start:end] {
+		refs = append(refs, repo.reference(ref, repo.refs[ref]))
+	}
+	writeJSON(w, http.StatusOK, refs)
+}
+
+func (s *Server) createRef(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	ref, ok := strings.CutPrefix(body.Ref, "refs/")
+	if !ok || strings.Count(body.Ref, "/") < 2 {
+		writeError(w, http.StatusUnprocessableEntity, "Reference name must start with 'refs/' and have at least two slashes")
+		return
+	}
+	if !ValidRefName(body.Ref) {
+		writeError(w, http.StatusUnprocessableEntity, "Reference name is invalid")
+		return
+	}
+	if _, ok := repo.refs[ref]; ok {
+		writeError(w, http.StatusUnprocessableEntity, "Reference already exists")
+		return
+	}
+	if _, ok := repo.objects.commits[body.SHA]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+		return
+	}
+	repo.refs[ref] = body.SHA
+	writeJSON(w, http.StatusCreated, repo.reference(ref, body.SHA))
+}
+
+func (s *Server) updateRef(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		SHA   string `json:"sha"`
+		Force bool   `json:"force"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	ref := r.PathValue("ref")
+	current, ok := repo.refs[ref]
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Reference does not exist")
+		return
+	}
+	if _, ok := repo.objects.commits[body.SHA]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Object does not exist")
+		return
+	}
+	if !body.Force && !repo.isAncestor(current, body.SHA) {
+		writeError(w, http.StatusUnprocessableEntity, "Update is not a fast forward")
+		return
+	}
+	repo.refs[ref] = body.SHA
+	writeJSON(w, http.StatusOK, repo.reference(ref, body.SHA))
+}
+
+func (s *Server) deleteRef(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	ref := r.PathValue("ref")
+	if _, ok := repo.refs[ref]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Reference does not exist")
+		return
+	}
+	delete(repo.refs, ref)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pullRequest converts a pull request to the format of the API
+func (r *Repo) pullRequest(pr *PullRequest) *github.PullRequest {
+	headOwner, _, _ := strings.Cut(pr.HeadRepo, "/")
+	result := &github.PullRequest{
+		Number:    github.Int(pr.Number),
+		State:     github.String(pr.State),
+		Title:     github.String(pr.Title),
+		Body:      github.String(pr.Body),
+		Draft:     github.Bool(pr.Draft),
+		HTMLURL:   github.String(r.htmlURL("pull/%d", pr.Number)),
+		CreatedAt: &github.Timestamp{Time: pr.CreatedAt},
+		Head: &github.PullRequestBranch{
+			Label: github.String(headOwner + ":" + pr.Head),
+			Ref:   github.String(pr.Head),
+			Repo:  &github.Repository{FullName: github.String(pr.HeadRepo)},
+		},
+		Base: &github.PullRequestBranch{
+			Label: github.String(r.owner + ":" + pr.Base),
+			Ref:   github.String(pr.Base),
+			Repo:  &github.Repository{FullName: github.String(r.FullName())},
+		},
+	}
+	if !pr.ClosedAt.IsZero() {
+		result.ClosedAt = &github.Timestamp{Time: pr.ClosedAt}
+	}
+	for _, label := range pr.Labels {
+		result.Labels = append(result.Labels, &github.Label{Name: github.String(label)})
+	}
+	return result
+}
+
+func (s *Server) listPullRequests(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	q := r.URL.Query()
+	state := q.Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var prs []*github.PullRequest
+	for _, pr := range repo.pulls {
+		if state != "all" && pr.State != state {
+			continue
+		}
+		headOwner, _, _ := strings.Cut(pr.HeadRepo, "/")
+		if head := q.Get("head"); head != "" && head != headOwner+":"+pr.Head {
+			continue
+		}
+		if base := q.Get("base"); base != "" && base != pr.Base {
+			continue
+		}
+		prs = append(prs, repo.pullRequest(pr))
+	}
+	start, end := s.paginate(w, r, len(prs))
+	writeJSON(w, http.StatusOK, prs[start:end])
+}
+
+func (s *Server) createPullRequest(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var body struct {
+		Title string `json:"title"`
+		Head  string `json:"head"`
+		Base  string `json:"base"`
+		Body  string `json:"body"`
+		Draft bool   `json:"draft"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	// The head is either a branch in the repository, or owner:branch for a branch in a fork
+	headRepo, branch := repo, body.Head
+	if owner, b, ok := strings.Cut(body.Head, ":"); ok {
+		branch = b
+		headRepo = nil
+		for _, candidate := range s.repos {
+			if candidate.owner == owner && (candidate == repo || candidate.parent == repo) {
+				headRepo = candidate
+			}
+		}
+	}
+	if headRepo == nil {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: head repository not found")
+		return
+	}
+	if _, ok := headRepo.refs["heads/"+branch]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: head branch does not exist")
+		return
+	}
+	if _, ok := repo.refs["heads/"+body.Base]; !ok {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: base branch does not exist")
+		return
+	}
+	if body.Title == "" {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: title is missing")
+		return
+	}
+	for _, pr := range repo.pulls {
+		if pr.State == "open" && pr.HeadRepo == headRepo.FullName() && pr.Head == branch && pr.Base == body.Base {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: A pull request already exists for "+body.Head)
+			return
+		}
+	}
+	pr := &PullRequest{
+		Number:    repo.nextNumber,
+		Title:     body.Title,
+		Body:      body.Body,
+		HeadRepo:  headRepo.FullName(),
+		Head:      branch,
+		Base:      body.Base,
+		Draft:     body.Draft,
+		State:     "open",
+		CreatedAt: s.Now(),
+	}
+	repo.nextNumber++
+	repo.pulls = append(repo.pulls, pr)
+	writeJSON(w, http.StatusCreated, repo.pullRequest(pr))
+}
+
+// requestPull returns the pull request in the path, and writes an error response if there is none
+func requestPull(w http.ResponseWriter, r *http.Request, repo *Repo) *PullRequest {
+	number, ok := pathNumber(w, r, "number")
+	if !ok {
+		return nil
+	}
+	pr := repo.pull(number)
+	if pr == nil {
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+	return pr
+}
+
+func (s *Server) getPullRequest(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	if pr := requestPull(w, r, repo); pr != nil {
+		writeJSON(w, http.StatusOK, repo.pullRequest(pr))
+	}
+}
+
+func (s *Server) editPullRequest(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var body struct {
+		Title *string `json:"title"`
+		Body  *string `json:"body"`
+		State *string `json:"state"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Title != nil {
+		pr.Title = *body.Title
+	}
+	if body.Body != nil {
+		pr.Body = *body.Body
+	}
+	if body.State != nil && *body.State != pr.State {
+		pr.State = *body.State
+		pr.ClosedAt = time.Time{}
+		if pr.State == "closed" {
+			pr.ClosedAt = s.Now()
+		}
+	}
+	writeJSON(w, http.StatusOK, repo.pullRequest(pr))
+}
+
+func (s *Server) requestReviewers(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var body struct {
+		Reviewers     []string `json:"reviewers"`
+		TeamReviewers []string `json:"team_reviewers"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	pr.Reviewers = append(pr.Reviewers, body.Reviewers...)
+	pr.TeamReviewers = append(pr.TeamReviewers, body.TeamReviewers...)
+	writeJSON(w, http.StatusCreated, repo.pullRequest(pr))
+}
+
+// issue converts a pull request to the format of the issues API
+func (r *Repo) issue(pr *PullRequest) *github.Issue {
+	issue := &github.Issue{
+		Number:  github.Int(pr.Number),
+		State:   github.String(pr.State),
+		Title:   github.String(pr.Title),
+		HTMLURL: github.String(r.htmlURL("pull/%d", pr.Number)),
+	}
+	for _, label := range pr.Labels {
+		issue.Labels = append(issue.Labels, &github.Label{Name: github.String(label)})
+	}
+	for _, assignee := range pr.Assignees {
+		issue.Assignees = append(issue.Assignees, &github.User{Login: github.String(assignee)})
+	}
+	if pr.Milestone != 0 {
+		issue.Milestone = &github.Milestone{Number: github.Int(pr.Milestone)}
+	}
+	return issue
+}
+
+func (s *Server) editIssue(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var body struct {
+		Milestone *int `json:"milestone"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Milestone != nil {
+		if *body.Milestone < 1 || *body.Milestone > len(repo.milestones) {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: milestone does not exist")
+			return
+		}
+		pr.Milestone = *body.Milestone
+	}
+	writeJSON(w, http.StatusOK, repo.issue(pr))
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var body struct {
+		Body string `json:"body"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	pr.Comments = append(pr.Comments, body.Body)
+	writeJSON(w, http.StatusCreated, &github.IssueComment{
+		ID:   github.Int64(int64(len(pr.Comments))),
+		Body: github.String(body.Body),
+	})
+}
+
+func (s *Server) addLabels(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var labels []string
+	if !readJSON(w, r, &labels) {
+		return
+	}
+	var result []*github.Label
+	for _, label := range labels {
+		// GitHub creates missing labels, but vigilant creates them first, so be strict
+		if !repo.labels[label] {
+			writeError(w, http.StatusUnprocessableEntity, "Validation Failed: label "+label+" does not exist")
+			return
+		}
+	}
+	for _, label := range labels {
+		pr.Labels = append(pr.Labels, label)
+		result = append(result, &github.Label{Name: github.String(label)})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) addAssignees(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	pr := requestPull(w, r, repo)
+	if pr == nil {
+		return
+	}
+	var body struct {
+		Assignees []string `json:"assignees"`
+	}
+	if !readJSON(w, r, &body) {
+		return
+	}
+	pr.Assignees = append(pr.Assignees, body.Assignees...)
+	writeJSON(w, http.StatusCreated, repo.issue(pr))
+}
+
+func (s *Server) getLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	name := r.PathValue("name")
+	if !repo.labels[name] {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, http.StatusOK, &github.Label{Name: github.String(name)})
+}
+
+func (s *Server) createLabel(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	var label github.Label
+	if !readJSON(w, r, &label) {
+		return
+	}
+	if repo.labels[label.GetName()] {
+		writeError(w, http.StatusUnprocessableEntity, "Validation Failed: label already exists")
+		return
+	}
+	repo.labels[label.GetName()] = true
+	writeJSON(w, http.StatusCreated, &label)
+}
+
+func (s *Server) listMilestones(w http.ResponseWriter, r *http.Request, repo *Repo) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = "open"
+	}
+	var milestones []*github.Milestone
+	for _, m := range repo.milestones {
+		if state != "all" && m.State != state {
+			continue
+		}
+		milestones = append(milestones, &github.Milestone{
+			Number: github.Int(m.Number),
+			Title:  github.String(m.Title),
+			State:  github.String(m.State),
+		})
+	}
+	start, end := s.paginate(w, r, len(milestones))
+	writeJSON(w, http.StatusOK, milestones[start:end])
+}
+
+// unifiedPatch returns a unified diff hunk from old to new, in the format of the patch field of the API,
+// and the number of added and deleted lines
+func unifiedPatch(old, new string) (patch string, additions, deletions int) {
+	a, b := splitLines(old), splitLines(new)
+
+	// The longest common subsequence of lines, which is fine for the small files in tests
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			// Deletions come before additions, like in git
+			lines = append(lines, "-"+a[i])
+			deletions++
+			i++
+		default:
+			lines = append(lines, "+"+b[j])
+			additions++
+			j++
+		}
+	}
+	if additions == 0 && deletions == 0 {
+		return "", 0, 0
+	}
+	oldStart, newStart := min(1, len(a)), min(1, len(b))
+	header := fmt.Sprintf("@@ -%d,%d +%d,%d @@", oldStart, len(a), newStart, len(b))
+	return header + "\n" + strings.Join(lines, "\n"), additions, deletions
+}
+
+// splitLines splits text into lines, without a trailing empty line
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// ValidRefName checks if name is a valid full reference name, like git check-ref-format does: no component
+// starts with a dot or ends with .lock, and there are no double dots, @{, control characters, spaces,
+// or any of ~^:?*[\, and the name does not end with a slash or a dot
+func ValidRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") ||
+		strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.ContainsAny(name, " ~^:?*[\\\x7f") {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,445 @@
+package githubfake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objects is the object database of a repository, which is shared with its forks
+type objects struct {
+	blobs   map[string][]byte
+	trees   map[string]map[string]string // tree SHA -> path -> blob SHA, or gitlinkPrefix and a commit SHA
+	commits map[string]*commit
+	counter int
+}
+
+// commit is a commit in the object database
+type commit struct {
+	sha     string
+	tree    string
+	parents []string
+	message string
+	author  string
+	email   string
+	date    time.Time
+	signed  bool
+}
+
+func newObjects() *objects {
+	return &objects{
+		blobs:   make(map[string][]byte),
+		trees:   map[string]map[string]string{emptyTree: {}},
+		commits: make(map[string]*commit),
+	}
+}
+
+// gitlinkPrefix marks a tree entry that is a submodule, which is followed by the SHA of the commit that it points to
+const gitlinkPrefix = "commit:"
+
+// emptyTree is the SHA of the tree without any files
+var emptyTree = treeSHA(nil)
+
+// blobSHA returns the git object ID of a blob with the given content
+func blobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// treeSHA returns an ID for a tree with the given files
+func treeSHA(files map[string]string) string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	h := sha1.New()
+	fmt.Fprint(h, "tree")
+	for _, path := range paths {
+		fmt.Fprintf(h, "\x00%s\x00%s", path, files[path])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// addBlob stores content and returns its SHA
+func (o *objects) addBlob(content []byte) string {
+	sha := blobSHA(content)
+	o.blobs[sha] = append([]byte(nil), content...)
+	return sha
+}
+
+// addTree stores a tree and returns its SHA
+func (o *objects) addTree(files map[string]string) string {
+	sha := treeSHA(files)
+	o.trees[sha] = files
+	return sha
+}
+
+// addCommit stores a commit, and gives it a unique SHA
+func (o *objects) addCommit(c *commit) string {
+	o.counter++
+	h := sha1.New()
+	fmt.Fprintf(h, "commit %d\x00%s\x00%s\x00%s", o.counter, c.tree, strings.Join(c.parents, ","), c.message)
+	c.sha = hex.EncodeToString(h.Sum(nil))
+	o.commits[c.sha] = c
+	return c.sha
+}
+
+// files returns the files of a commit, as path -> content, without the submodules
+func (o *objects) files(sha string) map[string]string {
+	files := make(map[string]string)
+	if c, ok := o.commits[sha]; ok {
+		for path, blob := range o.trees[c.tree] {
+			if !strings.HasPrefix(blob, gitlinkPrefix) {
+				files[path] = string(o.blobs[blob])
+			}
+		}
+	}
+	return files
+}
+
+// Repo is a repository in the fake
+type Repo struct {
+	server        *Server
+	owner, name   string
+	defaultBranch string
+	parent        *Repo // the repository that this is a fork of
+	objects       *objects
+	refs          map[string]string // like "heads/main" -> commit SHA
+	pulls         []*PullRequest
+	labels        map[string]bool
+	milestones    []Milestone
+	tags          []string  // the names of the tags, in the order they were created
+	releases      []Release // in the order they were created
+	nextNumber    int
+	readOnly      bool // the token can not push to the repository
+}
+
+// Release is a GitHub release of a tag
+type Release struct {
+	Tag        string
+	Name       string
+	Draft      bool
+	Prerelease bool
+}
+
+// PullRequest is a pull request, with the metadata that vigilant sets
+type PullRequest struct {
+	Number        int
+	Title         string
+	Body          string
+	HeadRepo      string // the repository of the branch, as owner/name
+	Head          string // the branch
+	Base          string
+	Draft         bool
+	State         string // open or closed
+	Labels        []string
+	Assignees     []string
+	Reviewers     []string
+	TeamReviewers []string
+	Milestone     int
+	Comments      []string
+	CreatedAt     time.Time
+	ClosedAt      time.Time
+}
+
+// Milestone is a milestone of a repository
+type Milestone struct {
+	Number int
+	Title  string
+	State  string
+}
+
+// Commit describes a commit that is added to a repository by a test
+type Commit struct {
+	Message    string
+	Author     string
+	Email      string
+	Date       time.Time         // defaults to the current time of the server
+	Files      map[string]string // files to add or change, as path -> content
+	Submodules map[string]string // submodules to add or change, as path -> the SHA of the commit they point to
+	Delete     []string          // files or submodules to delete
+}
+
+func newRepo(s *Server, owner, name, defaultBranch string, o *objects) *Repo {
+	return &Repo{
+		server:        s,
+		owner:         owner,
+		name:          name,
+		defaultBranch: defaultBranch,
+		objects:       o,
+		refs:          make(map[string]string),
+		labels:        make(map[string]bool),
+		nextNumber:    1,
+	}
+}
+
+// FullName returns the name of the repository as owner/name
+func (r *Repo) FullName() string {
+	return r.owner + "/" + r.name
+}
+
+// Commit adds a commit to the given branch, which is created if it does not exist.
+// Returns the SHA of the new commit.
+func (r *Repo) Commit(branch string, c Commit) string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	parent, hasParent := r.refs["heads/"+branch]
+	files := make(map[string]string)
+	if hasParent {
+		for path, blob := range r.objects.trees[r.objects.commits[parent].tree] {
+			files[path] = blob
+		}
+	}
+	for path, content := range c.Files {
+		files[path] = r.objects.addBlob([]byte(content))
+	}
+	for path, sha := range c.Submodules {
+		files[path] = gitlinkPrefix + sha
+	}
+	for _, path := range c.Delete {
+		delete(files, path)
+	}
+	if c.Date.IsZero() {
+		c.Date = r.server.Now()
+	}
+	gc := &commit{
+		tree:    r.objects.addTree(files),
+		message: c.Message,
+		author:  c.Author,
+		email:   c.Email,
+		date:    c.Date,
+	}
+	if hasParent {
+		gc.parents = []string{parent}
+	}
+	sha := r.objects.addCommit(gc)
+	r.refs["heads/"+branch] = sha
+	return sha
+}
+
+// Tag creates a lightweight tag that points to the given branch or commit, and returns the SHA of the commit
+func (r *Repo) Tag(name, ref string) string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	sha, ok := r.resolve(ref)
+	if !ok {
+		panic("githubfake: no commit found for " + ref)
+	}
+	r.refs["tags/"+name] = sha
+	r.tags = append(r.tags, name)
+	return sha
+}
+
+// AddRelease adds a release of a tag, which is created at the given branch or commit
+func (r *Repo) AddRelease(release Release, ref string) string {
+	sha := r.Tag(release.Tag, ref)
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.releases = append(r.releases, release)
+	return sha
+}
+
+// Branch returns the commit SHA that a branch points to
+func (r *Repo) Branch(name string) (string, bool) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	sha, ok := r.refs["heads/"+name]
+	return sha, ok
+}
+
+// Branches returns the names of all branches, sorted
+func (r *Repo) Branches() []string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	var branches []string
+	for ref := range r.refs {
+		if name, ok := strings.CutPrefix(ref, "heads/"); ok {
+			branches = append(branches, name)
+		}
+	}
+	sort.Strings(branches)
+	return branches
+}
+
+// File returns the content of a file at the given branch or commit SHA
+func (r *Repo) File(ref, path string) (string, bool) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return "", false
+	}
+	content, ok := r.objects.files(sha)[path]
+	return content, ok
+}
+
+// Submodule returns the SHA of the commit that a submodule points to, at the given branch or commit SHA
+func (r *Repo) Submodule(ref, path string) (string, bool) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return "", false
+	}
+	return strings.CutPrefix(r.objects.trees[r.objects.commits[sha].tree][path], gitlinkPrefix)
+}
+
+// CommitMessage returns the message of the commit at the given branch or commit SHA,
+// and whether the commit was signed
+func (r *Repo) CommitMessage(ref string) (message string, signed bool, ok bool) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	sha, ok := r.resolve(ref)
+	if !ok {
+		return "", false, false
+	}
+	c := r.objects.commits[sha]
+	return c.message, c.signed, true
+}
+
+// PullRequests returns a copy of all pull requests, in the order they were created
+func (r *Repo) PullRequests() []PullRequest {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	prs := make([]PullRequest, 0, len(r.pulls))
+	for _, pr := range r.pulls {
+		prs = append(prs, *pr)
+	}
+	return prs
+}
+
+// ClosePullRequest closes a pull request, as if it was closed or merged by a maintainer
+func (r *Repo) ClosePullRequest(number int) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	if pr := r.pull(number); pr != nil {
+		pr.State = "closed"
+		pr.ClosedAt = r.server.Now()
+	}
+}
+
+// AddLabel adds a label to the repository
+func (r *Repo) AddLabel(name string) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.labels[name] = true
+}
+
+// Labels returns the names of the labels of the repository, sorted
+func (r *Repo) Labels() []string {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	var labels []string
+	for name := range r.labels {
+		labels = append(labels, name)
+	}
+	sort.Strings(labels)
+	return labels
+}
+
+// SetReadOnly sets whether the owner of the token can push to the repository
+func (r *Repo) SetReadOnly(readOnly bool) {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.readOnly = readOnly
+}
+
+// AddMilestone adds an open milestone to the repository, and returns its number
+func (r *Repo) AddMilestone(title string) int {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	number := len(r.milestones) + 1
+	r.milestones = append(r.milestones, Milestone{Number: number, Title: title, State: "open"})
+	return number
+}
+
+// resolve returns the commit SHA of a branch, tag, commit SHA, or an unambiguous prefix of at least 7 characters of a commit SHA
+func (r *Repo) resolve(ref string) (string, bool) {
+	if ref == "" {
+		ref = r.defaultBranch
+	}
+	ref = strings.TrimPrefix(ref, "refs/")
+	for _, name := range []string{ref, "heads/" + ref, "tags/" + ref} {
+		if sha, ok := r.refs[name]; ok {
+			return sha, true
+		}
+	}
+	if _, ok := r.objects.commits[ref]; ok {
+		return ref, true
+	}
+	if len(ref) < 7 {
+		return "", false
+	}
+	var found string
+	for sha := range r.objects.commits {
+		if strings.HasPrefix(sha, ref) {
+			if found != "" {
+				return "", false
+			}
+			found = sha
+		}
+	}
+	return found, found != ""
+}
+
+// pull returns the pull request with the given number, or nil
+func (r *Repo) pull(number int) *PullRequest {
+	for _, pr := range r.pulls {
+		if pr.Number == number {
+			return pr
+		}
+	}
+	return nil
+}
+
+// firstParents returns the commits from sha back to the root commit, following the first parents
+func (r *Repo) firstParents(sha string) []*commit {
+	var commits []*commit
+	for c, ok := r.objects.commits[sha]; ok; {
+		commits = append(commits, c)
+		if len(c.parents) == 0 {
+			break
+		}
+		c, ok = r.objects.commits[c.parents[0]]
+	}
+	return commits
+}
+
+// isAncestor checks if ancestor can be reached from sha, by following the first parents
+func (r *Repo) isAncestor(ancestor, sha string) bool {
+	for _, c := range r.firstParents(sha) {
+		if c.sha == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// touches checks if a commit changed the given file, or any file in the given directory
+func (r *Repo) touches(c *commit, path string) bool {
+	before := map[string]string{}
+	if len(c.parents) > 0 {
+		before = r.objects.trees[r.objects.commits[c.parents[0]].tree]
+	}
+	after := r.objects.trees[c.tree]
+	matches := func(file string) bool {
+		return path == "" || file == path || strings.HasPrefix(file, strings.TrimSuffix(path, "/")+"/")
+	}
+	for file, blob := range after {
+		if matches(file) && before[file] != blob {
+			return true
+		}
+	}
+	for file := range before {
+		if _, ok := after[file]; !ok && matches(file) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package vigilant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/gomod"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// requiredChanges replaces the commits in the data of a watch that updates a Go module requirement with the commits
+// that changed the watched path since the version that the target requires, which may be older than the last synced
+// commit or release. The data is kept as it is if the required version is not found in the source repository.
+func (e *Engine) requiredChanges(ctx context.Context, watch config.RepoConfig, data *pullrequest.TemplateData) (*pullrequest.TemplateData, error) {
+	logger := e.watchLogger(watch)
+	dir, required, err := e.creator.RequiredVersion(ctx, watch, data.HeadSHA)
+	if err != nil {
+		return nil, err
+	}
+
+	// A pseudo-version has the commit in it, and any other version is a tag of the module
+	previous := required
+	var baseSHA string
+	if rev, ok := gomod.PseudoRevision(required); ok {
+		owner, repo := config.SplitRepoName(watch.SourceRepoName)
+		var commit *github.RepositoryCommit
+		commit, _, err = e.githubClient.Repositories.GetCommit(ctx, owner, repo, rev, nil)
+		baseSHA = commit.GetSHA()
+	} else {
+		previous = gomod.Tag(dir, required)
+		baseSHA, err = e.tagCommit(ctx, watch.SourceRepoName, previous)
+	}
+	if pullrequest.IsNotFound(err) {
+		logger.Warn("The required version is not in the source repository, the commits are listed since the last check", "required", required)
+		return data, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not find the commit of %s: %w", required, err)
+	}
+	return e.changesSince(ctx, watch, data, baseSHA, previous)
+}
@@ -0,0 +1,205 @@
+// Package gomod reads and rewrites the requirements of go.mod and go.sum files, computes the checksums
+// that go.sum records, and gets versions, go.mod files and zips of modules from a Go module proxy.
+package gomod
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/xyproto/vigilant/semver"
+)
+
+// File is a parsed go.mod file
+type File struct {
+	Module   string    // the module path
+	Requires []Require // the required modules, in the order they are listed
+
+	lines []string
+}
+
+// Require is a required module
+type Require struct {
+	Path     string
+	Version  string
+	Indirect bool
+
+	line int // the index of the line in the file
+}
+
+// Parse parses the module path and requirements of a go.mod file
+func Parse(data []byte) (*File, error) {
+	f := &File{lines: strings.Split(string(data), "\n")}
+	inRequire := false
+	for i, line := range f.lines {
+		code, comment, _ := strings.Cut(line, "//")
+		fields := strings.Fields(code)
+		if len(fields) == 0 {
+			continue
+		}
+		switch {
+		case inRequire && fields[0] == ")":
+			inRequire = false
+			continue
+		case inRequire:
+		case fields[0] == "module" && len(fields) == 2:
+			f.Module = unquote(fields[1])
+			continue
+		case fields[0] == "require" && len(fields) == 2 && fields[1] == "(":
+			inRequire = true
+			continue
+		case fields[0] == "require":
+			fields = fields[1:]
+		default:
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: invalid requirement %q", i+1, strings.TrimSpace(line))
+		}
+		f.Requires = append(f.Requires, Require{
+			Path:     unquote(fields[0]),
+			Version:  fields[1],
+			Indirect: strings.TrimSpace(comment) == "indirect",
+			line:     i,
+		})
+	}
+	if f.Module == "" {
+		return nil, errors.New("no module directive found")
+	}
+	return f, nil
+}
+
+// unquote removes the quotes around a quoted module path
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '`') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Require returns the requirement of a module
+func (f *File) Require(modulePath string) (Require, bool) {
+	for _, r := range f.Requires {
+		if r.Path == modulePath {
+			return r, true
+		}
+	}
+	return Require{}, false
+}
+
+// SetRequire changes the required version of a module, and keeps the rest of the line as it is
+func (f *File) SetRequire(modulePath, version string) error {
+	for i, r := range f.Requires {
+		if r.Path != modulePath {
+			continue
+		}
+		line := f.lines[r.line]
+		pathAt := strings.Index(line, modulePath)
+		versionAt := pathAt + len(modulePath) + strings.Index(line[pathAt+len(modulePath):], r.Version)
+		f.lines[r.line] = line[:versionAt] + version + line[versionAt+len(r.Version):]
+		f.Requires[i].Version = version
+		return nil
+	}
+	return fmt.Errorf("%s is not required", modulePath)
+}
+
+// Bytes returns the go.mod file, with the changes made by SetRequire
+func (f *File) Bytes() []byte {
+	return []byte(strings.Join(f.lines, "\n"))
+}
+
+// FindModule finds the module that a path in a repository is part of, by looking for the go.mod file
+// in its directory and in the directories above it. Returns the module path, and the directory of the module,
+// which is empty for the root of the repository. The read function returns an error that wraps
+// fs.ErrNotExist for files that do not exist.
+func FindModule(filePath string, read func(name string) ([]byte, error)) (modulePath, dir string, err error) {
+	dir = path.Clean("/" + filePath)
+	if !strings.HasSuffix(filePath, "/") {
+		// The path may be a file, or a directory without a trailing slash
+		if data, err := read(path.Join(dir, "go.mod")[1:]); err == nil {
+			return moduleOf(data, dir)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+		dir = path.Dir(dir)
+	}
+	for {
+		data, err := read(strings.TrimPrefix(path.Join(dir, "go.mod"), "/"))
+		if err == nil {
+			return moduleOf(data, dir)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", "", err
+		}
+		if dir == "/" {
+			return "", "", fmt.Errorf("%s is not part of a Go module", filePath)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// moduleOf returns the module path in a go.mod file, and the directory of the module without the leading slash
+func moduleOf(data []byte, dir string) (string, string, error) {
+	f, err := Parse(data)
+	if err != nil {
+		return "", "", fmt.Errorf("could not parse %s: %w", path.Join(dir, "go.mod")[1:], err)
+	}
+	return f.Module, strings.TrimPrefix(dir, "/"), nil
+}
+
+// TagVersion returns the version of a module in a tag, which is the tag without the directory of the module,
+// like v1.2.3 for tools/v1.2.3, and false if the tag is not a version of the module
+func TagVersion(dir, tag string) (string, bool) {
+	if dir != "" {
+		var ok bool
+		if tag, ok = strings.CutPrefix(tag, dir+"/"); !ok {
+			return "", false
+		}
+	}
+	if !strings.HasPrefix(tag, "v") {
+		return "", false
+	}
+	if _, err := semver.Parse(tag); err != nil {
+		return "", false
+	}
+	return tag, true
+}
+
+// Tag returns the tag of a version of the module in a directory, like tools/v1.2.3 for v1.2.3 in tools
+func Tag(dir, version string) string {
+	version = strings.TrimSuffix(version, "+incompatible")
+	if dir == "" {
+		return version
+	}
+	return dir + "/" + version
+}
+
+// PseudoRevision returns the commit of a pseudo-version, like abcdef123456 for v0.0.0-20240301120000-abcdef123456
+func PseudoRevision(version string) (string, bool) {
+	version = strings.TrimSuffix(version, "+incompatible")
+	i := strings.LastIndexByte(version, '-')
+	if i < 0 {
+		return "", false
+	}
+	rev, rest := version[i+1:], version[:i]
+	j := strings.LastIndexAny(rest, "-.")
+	if j < 0 || len(rev) != 12 || strings.Trim(rev, "0123456789abcdef") != "" {
+		return "", false
+	}
+	if timestamp := rest[j+1:]; len(timestamp) != 14 || strings.Trim(timestamp, "0123456789") != "" {
+		return "", false
+	}
+	return rev, true
+}
+
+// Compare compares two module versions, like semver.Compare, but pseudo-versions and +incompatible are understood
+func Compare(a, b string) int {
+	va, errA := semver.Parse(a)
+	vb, errB := semver.Parse(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	return va.Compare(vb)
+}
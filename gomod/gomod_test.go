@@ -0,0 +1,155 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+const testGoMod = `module example.com/app
+
+go 1.23
+
+require github.com/upstream/lib v1.2.0
+
+require (
+	"github.com/upstream/tool" v0.0.0-20240301120000-abcdef123456 // indirect
+	golang.org/x/text v0.14.0
+)
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(testGoMod))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Module != "example.com/app" {
+		t.Errorf("unexpected module %q", f.Module)
+	}
+	if r, ok := f.Require("github.com/upstream/tool"); !ok || r.Version != "v0.0.0-20240301120000-abcdef123456" || !r.Indirect {
+		t.Errorf("unexpected requirement %+v", r)
+	}
+	if err := f.SetRequire("github.com/upstream/lib", "v1.3.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetRequire("github.com/upstream/tool", "v0.0.0-20240401120000-0123456789ab"); err != nil {
+		t.Fatal(err)
+	}
+	got := string(f.Bytes())
+	for _, want := range []string{
+		"require github.com/upstream/lib v1.3.0\n",
+		"\t\"github.com/upstream/tool\" v0.0.0-20240401120000-0123456789ab // indirect\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in go.mod:\n%s", want, got)
+		}
+	}
+	if err := f.SetRequire("github.com/other/lib", "v1.0.0"); err == nil {
+		t.Error("expected an error for a module that is not required")
+	}
+}
+
+func TestFindModule(t *testing.T) {
+	files := map[string]string{
+		"go.mod":       "module github.com/upstream/repo\n",
+		"tool/go.mod":  "module github.com/upstream/repo/tool/v2\n",
+		"tool/main.go": "package main\n",
+	}
+	read := func(name string) ([]byte, error) {
+		if content, ok := files[name]; ok {
+			return []byte(content), nil
+		}
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	for filePath, want := range map[string][2]string{
+		"tool/main.go": {"github.com/upstream/repo/tool/v2", "tool"},
+		"tool":         {"github.com/upstream/repo/tool/v2", "tool"},
+		"src/":         {"github.com/upstream/repo", ""},
+		"README.md":    {"github.com/upstream/repo", ""},
+	} {
+		modulePath, dir, err := FindModule(filePath, read)
+		if err != nil {
+			t.Errorf("%s: %v", filePath, err)
+		} else if modulePath != want[0] || dir != want[1] {
+			t.Errorf("%s: expected %q in %q, got %q in %q", filePath, want[0], want[1], modulePath, dir)
+		}
+	}
+	delete(files, "go.mod")
+	if _, _, err := FindModule("README.md", read); err == nil {
+		t.Error("expected an error outside of a module")
+	}
+}
+
+func TestVersions(t *testing.T) {
+	if v, ok := TagVersion("tool", "tool/v2.1.0"); !ok || v != "v2.1.0" {
+		t.Errorf("unexpected version %q", v)
+	}
+	if _, ok := TagVersion("", "tool/v2.1.0"); ok {
+		t.Error("expected a tag of another module to not be a version")
+	}
+	if rev, ok := PseudoRevision("v1.2.4-0.20240301120000-abcdef123456"); !ok || rev != "abcdef123456" {
+		t.Errorf("unexpected revision %q", rev)
+	}
+	if _, ok := PseudoRevision("v1.2.4-rc.1"); ok {
+		t.Error("expected a prerelease to not be a pseudo-version")
+	}
+	if Compare("v1.2.4-0.20240301120000-abcdef123456", "v1.2.3") <= 0 || Compare("v0.0.0-20240301120000-abcdef123456", "v0.0.0-20240401120000-0123456789ab") >= 0 {
+		t.Error("expected pseudo-versions to be ordered by base version and time")
+	}
+}
+
+func TestHash(t *testing.T) {
+	mod := "module github.com/ProtonMail/go-crypto\n\ngo 1.13\n\nrequire (\n\tgithub.com/cloudflare/circl v1.3.3\n\tgolang.org/x/crypto v0.7.0\n)\n"
+	if got, want := HashMod([]byte(mod)), "h1:EjAoLdwvbIOoOQr3ihjnSoLZRtE8azugULFRteWMNc0="; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// The hash of a zip is the hash of its files, so the order of the files does not matter
+	zips := make([][]byte, 2)
+	for i, names := range [][]string{{"m@v1.0.0/go.mod", "m@v1.0.0/a.go"}, {"m@v1.0.0/a.go", "m@v1.0.0/go.mod"}} {
+		var buf bytes.Buffer
+		w := zip.NewWriter(&buf)
+		for _, name := range names {
+			f, _ := w.Create(name)
+			f.Write([]byte(name))
+		}
+		w.Close()
+		zips[i] = buf.Bytes()
+	}
+	a, err := HashZip(zips[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := HashZip(zips[1]); a != b || !strings.HasPrefix(a, "h1:") {
+		t.Errorf("expected the same hash, got %s and %s", a, b)
+	}
+}
+
+func TestUpdateSum(t *testing.T) {
+	sum := `github.com/aaa/lib v1.0.0/go.mod h1:a=
+github.com/upstream/lib v1.1.0/go.mod h1:old=
+github.com/upstream/lib v1.2.0 h1:zip=
+github.com/upstream/lib v1.2.0/go.mod h1:mod=
+golang.org/x/text v0.14.0 h1:text=
+`
+	got := string(UpdateSum([]byte(sum), "github.com/upstream/lib", "v1.2.0", "v1.10.0", "h1:newzip=", "h1:newmod="))
+	want := `github.com/aaa/lib v1.0.0/go.mod h1:a=
+github.com/upstream/lib v1.1.0/go.mod h1:old=
+github.com/upstream/lib v1.2.0/go.mod h1:mod=
+github.com/upstream/lib v1.10.0 h1:newzip=
+github.com/upstream/lib v1.10.0/go.mod h1:newmod=
+golang.org/x/text v0.14.0 h1:text=
+`
+	if got != want {
+		t.Errorf("unexpected go.sum:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestEscapePath(t *testing.T) {
+	if got := EscapePath("github.com/ProtonMail/go-crypto"); got != "github.com/!proton!mail/go-crypto" {
+		t.Errorf("unexpected escaped path %q", got)
+	}
+}
@@ -0,0 +1,91 @@
+package gomod
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Proxy is a client of a Go module proxy, like https://proxy.golang.org
+type Proxy struct {
+	URL    string       // the URL of the proxy
+	Client *http.Client // defaults to http.DefaultClient
+}
+
+// Info is the version of a module that a query resolves to
+type Info struct {
+	Version string
+	Time    time.Time
+}
+
+// EscapePath escapes a module path or version for a proxy URL, where an uppercase letter is an exclamation mark
+// followed by the letter in lowercase
+func EscapePath(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if 'A' <= r && r <= 'Z' {
+			b.WriteByte('!')
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Info resolves a query, which is a version, a tag or a commit, to a version of a module
+func (p *Proxy) Info(ctx context.Context, modulePath, query string) (*Info, error) {
+	data, err := p.get(ctx, modulePath, query+".info")
+	if err != nil {
+		return nil, err
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid version info of %s@%s: %w", modulePath, query, err)
+	}
+	if info.Version == "" {
+		return nil, fmt.Errorf("the proxy has no version for %s@%s", modulePath, query)
+	}
+	return &info, nil
+}
+
+// Mod returns the go.mod file of a version of a module
+func (p *Proxy) Mod(ctx context.Context, modulePath, version string) ([]byte, error) {
+	return p.get(ctx, modulePath, version+".mod")
+}
+
+// Zip returns the zip of a version of a module
+func (p *Proxy) Zip(ctx context.Context, modulePath, version string) ([]byte, error) {
+	return p.get(ctx, modulePath, version+".zip")
+}
+
+// get downloads a file in the @v directory of a module
+func (p *Proxy) get(ctx context.Context, modulePath, name string) ([]byte, error) {
+	u := strings.TrimSuffix(p.URL, "/") + "/" + EscapePath(modulePath) + "/@v/" + url.PathEscape(EscapePath(name))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s: %w", u, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("could not get %s: %s %s", u, resp.Status, strings.TrimSpace(string(message)))
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not get %s: %w", u, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,99 @@
+package gomod
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// HashZip returns the hash of a module zip, as it is recorded in go.sum, like h1:...
+func HashZip(data []byte) (string, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("could not read the module zip: %w", err)
+	}
+	files := make(map[string]*zip.File)
+	names := make([]string, 0, len(z.File))
+	for _, file := range z.File {
+		files[file.Name] = file
+		names = append(names, file.Name)
+	}
+	return hash1(names, func(name string) ([]byte, error) {
+		r, err := files[name].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	})
+}
+
+// HashMod returns the hash of the go.mod file of a module, as it is recorded in go.sum
+func HashMod(data []byte) string {
+	h, _ := hash1([]string{"go.mod"}, func(string) ([]byte, error) { return data, nil })
+	return h
+}
+
+// hash1 is the h1 hash of the go command: a SHA-256 of a list of the SHA-256 of every file and its name, sorted by name
+func hash1(names []string, open func(name string) ([]byte, error)) (string, error) {
+	names = slices.Sorted(slices.Values(names))
+	h := sha256.New()
+	for _, name := range names {
+		if strings.Contains(name, "\n") {
+			return "", fmt.Errorf("the file name %q contains a newline", name)
+		}
+		data, err := open(name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%x  %s\n", sha256.Sum256(data), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// UpdateSum replaces the checksum of the old version of a module in a go.sum file with the checksums of the new version.
+// The checksum of the go.mod file of the old version is kept, since other modules may still need it for the module graph.
+// The new lines are inserted where the go command would sort them.
+func UpdateSum(sum []byte, modulePath, oldVersion, version, zipHash, modHash string) []byte {
+	var lines []string
+	for _, line := range strings.Split(string(sum), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) == 3 && fields[0] == modulePath && (fields[1] == oldVersion || fields[1] == version || fields[1] == version+"/go.mod") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for _, line := range []string{modulePath + " " + version + " " + zipHash, modulePath + " " + version + "/go.mod " + modHash} {
+		i := 0
+		for i < len(lines) && sumLess(lines[i], line) {
+			i++
+		}
+		lines = slices.Insert(lines, i, line)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// sumLess orders the lines of a go.sum file by module path and version, with the go.mod file after the module
+func sumLess(a, b string) bool {
+	fa, fb := strings.Fields(a), strings.Fields(b)
+	if len(fa) < 2 || len(fb) < 2 {
+		return a < b
+	}
+	if fa[0] != fb[0] {
+		return fa[0] < fb[0]
+	}
+	va, modA := strings.CutSuffix(fa[1], "/go.mod")
+	vb, modB := strings.CutSuffix(fb[1], "/go.mod")
+	if c := Compare(va, vb); c != 0 {
+		return c < 0
+	}
+	return !modA && modB
+}
@@ -0,0 +1,198 @@
+package vigilant
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+	"github.com/xyproto/vigilant/gomod"
+)
+
+// proxyFile downloads a file of a module version from the fake Go module proxy
+func (e *testEnv) proxyFile(name string) []byte {
+	e.t.Helper()
+	resp, err := http.Get(e.gh.URL() + "goproxy/github.com/upstream/tool/@v/" + name)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		e.t.Fatalf("could not get %s: %s %v", name, resp.Status, err)
+	}
+	return data
+}
+
+func TestGoModMode(t *testing.T) {
+	var cfg *config.Config
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Trigger = config.TriggerTags
+		c.Repos[0].TagPattern = "v*"
+		c.Repos[0].Mode = config.ModeGoMod
+		cfg = c
+	})
+	cfg.GoProxy = e.gh.URL() + "goproxy"
+	e.upstreamCommit("Add go.mod", map[string]string{"go.mod": "module github.com/upstream/tool\n\ngo 1.22\n\nrequire golang.org/x/text v0.15.0\n"})
+	e.source.Tag("v1.0.0", "main")
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Add the app",
+		Files: map[string]string{
+			"go.mod": "module example.com/app\n\ngo 1.22\n\nrequire (\n\tgithub.com/upstream/tool v1.0.0\n\tgolang.org/x/text v0.14.0\n)\n",
+			"go.sum": "github.com/upstream/tool v1.0.0 h1:old=\ngithub.com/upstream/tool v1.0.0/go.mod h1:oldmod=\ngolang.org/x/text v0.14.0 h1:text=\n",
+		},
+	})
+	e.check()
+
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.source.Tag("v1.1.0", "main")
+	e.check()
+	e.upstreamCommit("Update the README", map[string]string{"README": "A tool\n"})
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.source.Tag("v1.2.0", "main")
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	if prs[0].Title != "Update github.com/upstream/tool to v1.1.0" {
+		t.Errorf("unexpected title %q", prs[0].Title)
+	}
+
+	// The target still requires v1.0.0, so the second pull request lists the commits since then
+	pr := prs[1]
+	for _, want := range []string{
+		"updates github.com/upstream/tool in `go.mod` from v1.0.0 to v1.2.0",
+		"since v1.0.0",
+		"Return 0",
+		"Return 2",
+		"requires golang.org/x/text v0.15.0, which is newer than v0.14.0",
+	} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+	if strings.Contains(pr.Body, "Update the README") {
+		t.Errorf("expected only the commits that changed the watched path:\n%s", pr.Body)
+	}
+	if goMod, _ := e.target.File(pr.Head, "go.mod"); !strings.Contains(goMod, "\tgithub.com/upstream/tool v1.2.0\n\tgolang.org/x/text v0.14.0\n") {
+		t.Errorf("expected the requirement to be updated:\n%s", goMod)
+	}
+	zipHash, err := gomod.HashZip(e.proxyFile("v1.2.0.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSum := fmt.Sprintf("github.com/upstream/tool v1.0.0/go.mod h1:oldmod=\ngithub.com/upstream/tool v1.2.0 %s\ngithub.com/upstream/tool v1.2.0/go.mod %s\ngolang.org/x/text v0.14.0 h1:text=\n",
+		zipHash, gomod.HashMod(e.proxyFile("v1.2.0.mod")))
+	if goSum, _ := e.target.File(pr.Head, "go.sum"); goSum != wantSum {
+		t.Errorf("unexpected go.sum:\n%s\nexpected:\n%s", goSum, wantSum)
+	}
+	if _, ok := e.target.File(pr.Head, "src-main.c-updates.md"); ok {
+		t.Error("expected no notification file")
+	}
+
+	// A go.mod that already requires the new version is not updated again
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Update github.com/upstream/tool",
+		Files:   map[string]string{"go.mod": "module example.com/app\n\nrequire github.com/upstream/tool v1.3.0\n"},
+	})
+	e.upstreamCommit("Return 3", map[string]string{"src/main.c": "int main(void) { return 3; }\n"})
+	e.source.Tag("v1.3.0", "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 2 {
+		t.Errorf("expected still 2 pull requests, got %d", n)
+	}
+}
+
+func TestGoModModePseudoVersion(t *testing.T) {
+	var cfg *config.Config
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Mode = config.ModeGoMod
+		cfg = c
+	})
+	cfg.GoProxy = e.gh.URL() + "goproxy"
+	pseudoVersion := func(sha string) string {
+		return "v0.0.0-" + e.clock.Now().UTC().Format("20060102150405") + "-" + sha[:12]
+	}
+	required := pseudoVersion(e.upstreamCommit("Add go.mod", map[string]string{"go.mod": "module github.com/upstream/tool\n"}))
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Add the app",
+		Files:   map[string]string{"go.mod": "module example.com/app\n\nrequire github.com/upstream/tool " + required + "\n"},
+	})
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+	version := pseudoVersion(e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"}))
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	pr := prs[1]
+	if goMod, _ := e.target.File(pr.Head, "go.mod"); !strings.Contains(goMod, "require github.com/upstream/tool "+version+"\n") {
+		t.Errorf("expected the requirement of %s:\n%s", version, goMod)
+	}
+	// The commits are listed since the required commit, also those from before the last check
+	for _, want := range []string{"from " + required + " to " + version, "Return 0", "Return 2"} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+}
+
+func TestGoModModeGroup(t *testing.T) {
+	var cfg *config.Config
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Trigger = config.TriggerTags
+		c.Repos[0].Mode = config.ModeGoMod
+		c.Repos[0].Group = "deps"
+		lib := c.Repos[0]
+		lib.SourceRepoName = "upstream/lib"
+		lib.FilePath = "lib.go"
+		c.Repos = append(c.Repos, lib)
+		cfg = c
+	})
+	cfg.GoProxy = e.gh.URL() + "goproxy"
+	lib := e.gh.AddRepo("upstream/lib", "main")
+	lib.Commit("main", githubfake.Commit{Message: "Add the library", Files: map[string]string{"go.mod": "module github.com/upstream/lib\n", "lib.go": "package lib\n"}})
+	lib.Tag("v1.0.0", "main")
+	e.upstreamCommit("Add go.mod", map[string]string{"go.mod": "module github.com/upstream/tool\n"})
+	e.source.Tag("v1.0.0", "main")
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Add the app",
+		Files: map[string]string{
+			"go.mod": "module example.com/app\n\nrequire (\n\tgithub.com/upstream/lib v1.0.0\n\tgithub.com/upstream/tool v1.0.0\n)\n",
+			"go.sum": "github.com/upstream/lib v1.0.0 h1:lib=\ngithub.com/upstream/tool v1.0.0 h1:tool=\n",
+		},
+	})
+	e.check()
+
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.source.Tag("v1.1.0", "main")
+	lib.Commit("main", githubfake.Commit{Message: "Add a function", Files: map[string]string{"lib.go": "package lib\n\nfunc F() {}\n"}})
+	lib.Tag("v1.2.0", "main")
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 combined pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	// The second watch updates the go.mod and go.sum as the first watch left them
+	if goMod, _ := e.target.File(pr.Head, "go.mod"); goMod != "module example.com/app\n\nrequire (\n\tgithub.com/upstream/lib v1.2.0\n\tgithub.com/upstream/tool v1.1.0\n)\n" {
+		t.Errorf("expected both requirements to be updated:\n%s", goMod)
+	}
+	goSum, _ := e.target.File(pr.Head, "go.sum")
+	for _, want := range []string{"github.com/upstream/lib v1.2.0 h1:", "github.com/upstream/lib v1.2.0/go.mod h1:", "github.com/upstream/tool v1.1.0 h1:", "github.com/upstream/tool v1.1.0/go.mod h1:"} {
+		if strings.Count(goSum, want) != 1 {
+			t.Errorf("expected %q once in go.sum:\n%s", want, goSum)
+		}
+	}
+	if strings.Contains(goSum, "v1.0.0") {
+		t.Errorf("expected the old versions to be removed from go.sum:\n%s", goSum)
+	}
+}
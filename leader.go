@@ -0,0 +1,156 @@
+package vigilant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/xyproto/vigilant/state"
+	"github.com/xyproto/vigilant/systemd"
+)
+
+// ErrNotLeader is returned by TryLead when another instance holds the lease on the state directory
+var ErrNotLeader = errors.New("another vigilant instance is the leader")
+
+// errLostLease is the cause of the cancellation of the checks when this instance is no longer the leader.
+// It wraps state.ErrFenced, so that the pull request creator leaves the operations to the new leader.
+var errLostLease = fmt.Errorf("the lease was lost: %w", state.ErrFenced)
+
+// TryLead takes the lease on the shared state directory if leader election is enabled, and reloads the state
+// that the previous leader saved. Run waits for the lease by itself, but CheckOnce and CollectGarbage do not,
+// so TryLead has to be called before them. It does nothing if leader election is not enabled.
+func (e *Engine) TryLead() error {
+	if e.lease == nil {
+		return nil
+	}
+	ok, holder, err := e.lease.TryAcquire()
+	if err != nil {
+		return fmt.Errorf("could not acquire the lease: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotLeader, holder)
+	}
+	return e.takeOver()
+}
+
+// takeOver reloads the state, which the previous leader may have changed
+func (e *Engine) takeOver() error {
+	if err := e.state.Reload(); err != nil {
+		return fmt.Errorf("error loading state: %w", err)
+	}
+	e.initSinceFile()
+	return nil
+}
+
+// runElected waits until this instance holds the lease, and schedules the checks for as long as it does,
+// until ctx is cancelled. If the lease is lost, the checks are stopped, and it waits for the lease again.
+func (e *Engine) runElected(ctx context.Context) {
+	defer func() {
+		if err := e.lease.Release(); err != nil {
+			e.logger.Warn("Could not release the lease", "error", err)
+		}
+		e.notify(systemd.Stopping + "\n" + systemd.Status("Shutting down"))
+	}()
+	for {
+		if !e.waitForLease(ctx) {
+			return
+		}
+		if err := e.takeOver(); err != nil {
+			e.logger.Error("Could not take over as the leader", "error", err)
+			e.lease.Release()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.lease.Duration()):
+				continue
+			}
+		}
+		e.notify(systemd.Status(e.status.String()))
+
+		leaderCtx, cancel := context.WithCancelCause(ctx)
+		renewed := make(chan struct{})
+		go func() {
+			defer close(renewed)
+			e.renewLease(leaderCtx, cancel)
+		}()
+		e.schedule(leaderCtx)
+		cancel(nil)
+		<-renewed
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// leaseInterval returns how often the lease is renewed, or tried to be taken, which is often enough
+// for the lease to be renewed in time, and for the systemd watchdog
+func (e *Engine) leaseInterval() time.Duration {
+	interval := e.lease.Duration() / 3
+	if watchdog, ok := systemd.WatchdogInterval(); ok && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+	return interval
+}
+
+// waitForLease tries to take the lease until it succeeds, and returns false if ctx is cancelled first
+func (e *Engine) waitForLease(ctx context.Context) bool {
+	lastLeader := ""
+	for {
+		ok, holder, err := e.lease.TryAcquire()
+		switch {
+		case err != nil:
+			e.logger.Warn("Could not acquire the lease", "error", err)
+		case ok:
+			e.logger.Info("This instance is now the leader", "id", e.lease.Holder())
+			e.status.setLeader("")
+			e.notifyReady()
+			return true
+		case holder != lastLeader:
+			e.logger.Info("Waiting as a standby", "id", e.lease.Holder(), "leader", holder)
+			e.status.setLeader(holder)
+			e.notifyReady()
+			e.notify(systemd.Status(e.status.String()))
+			lastLeader = holder
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(e.leaseInterval()):
+			e.notify(systemd.Watchdog)
+		}
+	}
+}
+
+// renewLease renews the lease until ctx is cancelled, and cancels the checks with errLostLease
+// if another instance takes it over, or if it could not be renewed before it expired.
+// The state is fenced first, so that the running checks can not write it anymore.
+func (e *Engine) renewLease(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(e.leaseInterval())
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, holder, err := e.lease.TryAcquire()
+		switch {
+		case err != nil && time.Since(renewed) >= e.lease.Duration():
+			e.logger.Error("Could not renew the lease before it expired", "error", err)
+			e.state.Fence()
+			cancel(errLostLease)
+			return
+		case err != nil:
+			e.logger.Warn("Could not renew the lease", "error", err)
+		case !ok:
+			e.logger.Warn("Another instance took over the lease", "leader", holder)
+			e.state.Fence()
+			cancel(errLostLease)
+			return
+		default:
+			renewed = time.Now()
+		}
+	}
+}
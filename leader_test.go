@@ -0,0 +1,205 @@
+package vigilant
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/lock"
+)
+
+// eventually waits until cond is true, and fails the test if it does not become true within a few seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting until %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStateDirIsLocked(t *testing.T) {
+	env := newTestEnv(t, nil)
+	cfg := &config.Config{Workers: 1, Repos: env.engine.repoConfigs}
+	_, err := New(cfg, WithStateDir(env.engine.stateDir), WithCacheDir(t.TempDir()), WithClient(env.gh.Client()))
+	if !errors.Is(err, lock.ErrLocked) {
+		t.Fatalf("expected the state directory to be locked, got %v", err)
+	}
+
+	env.engine.Close()
+	e, err := New(cfg, WithStateDir(env.engine.stateDir), WithCacheDir(t.TempDir()), WithClient(env.gh.Client()))
+	if err != nil {
+		t.Fatalf("could not use the state directory after it was unlocked: %v", err)
+	}
+	e.Close()
+}
+
+func TestStandbyTakesOver(t *testing.T) {
+	var cfg config.Config
+	env := newTestEnv(t, func(c *config.Config) {
+		c.LeaderElection = config.LeaderConfig{Enabled: true, LeaseDuration: 1, ID: "a"}
+		cfg = *c
+	})
+	leader := env.engine
+	cfg.LeaderElection.ID = "b"
+	standby, err := New(&cfg, WithStateDir(leader.stateDir), WithCacheDir(t.TempDir()), WithClient(env.gh.Client()), WithClock(env.clock.Now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer standby.Close()
+
+	// The first instance becomes the leader, and creates a pull request
+	if err := leader.TryLead(); err != nil {
+		t.Fatal(err)
+	}
+	leaderCtx, stopLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan struct{})
+	go func() {
+		leader.Run(leaderCtx)
+		close(leaderDone)
+	}()
+	env.upstreamCommit("Fix the build", map[string]string{"src/main.c": "int main(void)\n{\n    return 0;\n}\n"})
+	eventually(t, "the leader is running", func() bool {
+		leader.TriggerCheck()
+		return len(env.pullRequests()) == 1
+	})
+
+	// The second instance waits as a standby
+	if err := standby.TryLead(); !errors.Is(err, ErrNotLeader) {
+		t.Fatalf("expected ErrNotLeader, got %v", err)
+	}
+	standbyCtx, stopStandby := context.WithCancel(context.Background())
+	standbyDone := make(chan struct{})
+	go func() {
+		standby.Run(standbyCtx)
+		close(standbyDone)
+	}()
+	eventually(t, "the second instance is a standby", func() bool {
+		return standby.status.String() == "Standby, a is the leader"
+	})
+
+	// When the leader stops, the standby takes over, with the state that the leader saved
+	stopLeader()
+	<-leaderDone
+	eventually(t, "the standby takes over", func() bool {
+		return standby.status.String() == "Waiting for the first check"
+	})
+	if records := standby.state.PullRequests(); len(records) != 1 {
+		t.Errorf("the new leader knows about %d pull requests, want 1", len(records))
+	}
+	stopStandby()
+	<-standbyDone
+}
+
+func TestLostLeaseCancelsJobs(t *testing.T) {
+	env := newTestEnv(t, func(c *config.Config) {
+		c.LeaderElection = config.LeaderConfig{Enabled: true, LeaseDuration: 1, ID: "a"}
+		c.ShutdownTimeout = 60
+	})
+	leader := env.engine
+	if err := leader.TryLead(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		leader.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	// The check is slow, since the branch is not created until the request is released
+	held, release := env.gh.Hold("POST", "/git/refs")
+	defer release()
+	env.upstreamCommit("Fix the build", map[string]string{"src/main.c": "int main(void)\n{\n    return 0;\n}\n"})
+	eventually(t, "the check starts to create a branch", func() bool {
+		leader.TriggerCheck()
+		select {
+		case <-held:
+			return true
+		default:
+			return false
+		}
+	})
+	statePath := filepath.Join(leader.stateDir, "state.json")
+	before, _ := os.ReadFile(statePath)
+
+	// Another instance takes over the lease while the check is running
+	other := lock.NewLease(leader.stateDir, "b", time.Second)
+	other.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if ok, _, err := other.TryAcquire(); err != nil || !ok {
+		t.Fatalf("could not take over the lease: %v", err)
+	}
+	eventually(t, "the old leader stops its checks", func() bool {
+		return leader.status.String() == "Standby, b is the leader"
+	})
+	release()
+
+	if prs := env.pullRequests(); len(prs) != 0 {
+		t.Errorf("expected no pull request after the lease was lost, got %d", len(prs))
+	}
+	if branches := env.updateBranches(); len(branches) != 0 {
+		t.Errorf("expected no branch after the lease was lost, got %v", branches)
+	}
+	if after, _ := os.ReadFile(statePath); string(after) != string(before) {
+		t.Errorf("expected the state to not be written after the lease was lost:\n%s\nbefore:\n%s", after, before)
+	}
+}
+
+func TestLostLeaseKeepsBranch(t *testing.T) {
+	env := newTestEnv(t, func(c *config.Config) {
+		c.LeaderElection = config.LeaderConfig{Enabled: true, LeaseDuration: 1, ID: "a"}
+	})
+	leader := env.engine
+	if err := leader.TryLead(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		leader.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		stop()
+		<-done
+	}()
+
+	// The branch is created, but the pull request is not opened until the request is released
+	held, release := env.gh.Hold("POST", "/repos/distro/packages/pulls")
+	defer release()
+	env.upstreamCommit("Fix the build", map[string]string{"src/main.c": "int main(void)\n{\n    return 0;\n}\n"})
+	eventually(t, "the check starts to open a pull request", func() bool {
+		leader.TriggerCheck()
+		select {
+		case <-held:
+			return true
+		default:
+			return false
+		}
+	})
+
+	// The new leader resumes the operation from the shared state, with the same branch
+	other := lock.NewLease(leader.stateDir, "b", time.Second)
+	other.Now = func() time.Time { return time.Now().Add(time.Hour) }
+	if ok, _, err := other.TryAcquire(); err != nil || !ok {
+		t.Fatalf("could not take over the lease: %v", err)
+	}
+	eventually(t, "the old leader stops its checks", func() bool {
+		return leader.status.String() == "Standby, b is the leader"
+	})
+	release()
+
+	if branches := env.updateBranches(); len(branches) != 1 {
+		t.Errorf("expected the branch to be left to the new leader, got %v", branches)
+	}
+}
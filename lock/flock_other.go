@@ -0,0 +1,10 @@
+//go:build !unix
+
+package lock
+
+import "os"
+
+// flock does nothing on systems without flock, where the state directory is not locked
+func flock(*os.File) error {
+	return nil
+}
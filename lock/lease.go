@@ -0,0 +1,191 @@
+package lock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leasePrefix is the start of the names of the lease files, which end with the generation of the lease
+const leasePrefix = "lease."
+
+// Lease is held by the leader of the instances that share a state directory. The leader renews it
+// before it expires. When it stops doing so, another instance takes over the lease, by creating the
+// file of the next generation, which only one instance can do. Every generation is a file, like lease.42,
+// and the highest generation is the current lease.
+type Lease struct {
+	// Now returns the current time, and can be replaced in tests
+	Now func() time.Time
+
+	dir      string
+	holder   string
+	duration time.Duration
+	gen      int // the generation of the lease that this instance holds, or 0
+}
+
+// leaseRecord is the content of a lease file
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// NewLease returns a lease on the given directory for the given instance, which lasts for duration after every renewal
+func NewLease(dir, holder string, duration time.Duration) *Lease {
+	return &Lease{Now: time.Now, dir: dir, holder: holder, duration: duration}
+}
+
+// DefaultHolder returns the name of this instance, which is the host name and process ID
+func DefaultHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// Holder returns the name of this instance
+func (l *Lease) Holder() string {
+	return l.holder
+}
+
+// Duration returns how long the lease lasts after every renewal
+func (l *Lease) Duration() time.Duration {
+	return l.duration
+}
+
+// TryAcquire renews the lease if this instance holds it, or takes it over if it is free or has expired.
+// Returns false, and the instance that holds the lease, if another instance holds it.
+func (l *Lease) TryAcquire() (bool, string, error) {
+	gen, record, err := l.current()
+	if err != nil {
+		return false, "", err
+	}
+	now := l.Now()
+	switch {
+	case gen == 0:
+		return l.create(1)
+	case record.Holder == l.holder && now.Before(record.Expires):
+		l.gen = gen
+		if err := l.write(gen, now.Add(l.duration)); err != nil {
+			return false, "", err
+		}
+		return true, l.holder, nil
+	case now.Before(record.Expires):
+		l.gen = 0
+		return false, record.Holder, nil
+	}
+	l.gen = 0
+	return l.create(gen + 1)
+}
+
+// Release lets the lease expire right away, if this instance holds it, so that another instance can take over
+func (l *Lease) Release() error {
+	if l.gen == 0 {
+		return nil
+	}
+	gen, record, err := l.current()
+	if err != nil {
+		return err
+	}
+	if gen != l.gen || record.Holder != l.holder {
+		return nil
+	}
+	l.gen = 0
+	return l.write(gen, time.Time{})
+}
+
+// path returns the path of the lease file of the given generation
+func (l *Lease) path(gen int) string {
+	return filepath.Join(l.dir, leasePrefix+strconv.Itoa(gen))
+}
+
+// current returns the generation and the record of the current lease, or 0 if there is none
+func (l *Lease) current() (int, leaseRecord, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return 0, leaseRecord{}, err
+	}
+	gen := 0
+	for _, entry := range entries {
+		if n, err := strconv.Atoi(strings.TrimPrefix(entry.Name(), leasePrefix)); err == nil && strings.HasPrefix(entry.Name(), leasePrefix) && n > gen {
+			gen = n
+		}
+	}
+	if gen == 0 {
+		return 0, leaseRecord{}, nil
+	}
+	record, err := l.read(gen)
+	return gen, record, err
+}
+
+// read reads the lease file of the given generation. A file that is being created by another instance
+// may still be empty, so a file that can not be parsed is held by an unknown instance, until it expires.
+func (l *Lease) read(gen int) (leaseRecord, error) {
+	var record leaseRecord
+	data, err := os.ReadFile(l.path(gen))
+	if err != nil {
+		return record, err
+	}
+	if json.Unmarshal(data, &record) != nil {
+		info, err := os.Stat(l.path(gen))
+		if err != nil {
+			return record, err
+		}
+		record = leaseRecord{Holder: "unknown", Expires: info.ModTime().Add(l.duration)}
+	}
+	return record, nil
+}
+
+// create takes the lease of the given generation, unless another instance already has
+func (l *Lease) create(gen int) (bool, string, error) {
+	f, err := os.OpenFile(l.path(gen), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, os.ErrExist) {
+		record, err := l.read(gen)
+		return false, record.Holder, err
+	} else if err != nil {
+		return false, "", err
+	}
+	data, _ := json.Marshal(leaseRecord{Holder: l.holder, Expires: l.Now().Add(l.duration)})
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, "", err
+	}
+	l.gen = gen
+
+	// Remove the leases of the earlier generations
+	for old := gen - 1; old > 0; old-- {
+		if err := os.Remove(l.path(old)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+	}
+	return true, l.holder, nil
+}
+
+// write replaces the lease file of the given generation, with a new expiry time
+func (l *Lease) write(gen int, expires time.Time) error {
+	data, err := json.Marshal(leaseRecord{Holder: l.holder, Expires: expires})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(l.dir, leasePrefix+"tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), l.path(gen))
+}
@@ -0,0 +1,53 @@
+// Package lock makes sure that only one vigilant instance uses a state directory at a time:
+// with an exclusive lock on the directory for a single instance, or with a lease that
+// instances that share the directory take turns holding, for high availability.
+package lock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned when the state directory is locked by another process
+var ErrLocked = errors.New("the state directory is in use by another vigilant process")
+
+// lockFile is the name of the lock file in the state directory
+const lockFile = "lock"
+
+// Lock is an exclusive lock on a directory, which is released when the process exits
+type Lock struct {
+	f *os.File
+}
+
+// Acquire locks the given directory, or returns an error that wraps ErrLocked if another process has locked it.
+// The process ID is written to the lock file, to be shown in the error message of other processes.
+func Acquire(dir string) (*Lock, error) {
+	path := filepath.Join(dir, lockFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the lock file: %w", err)
+	}
+	if err := flock(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			if data, _ := os.ReadFile(path); len(data) > 0 {
+				return nil, fmt.Errorf("%w (%s, pid %s)", ErrLocked, dir, strings.TrimSpace(string(data)))
+			}
+			return nil, fmt.Errorf("%w (%s)", ErrLocked, dir)
+		}
+		return nil, fmt.Errorf("could not lock %s: %w", path, err)
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	return l.f.Close()
+}
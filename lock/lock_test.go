@@ -0,0 +1,95 @@
+package lock
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestAcquire(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the state directory is not locked on Windows")
+	}
+	dir := t.TempDir()
+	l, err := Acquire(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Acquire(dir); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected ErrLocked, got %v", err)
+	}
+	if err := l.Release(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = Acquire(dir)
+	if err != nil {
+		t.Fatalf("could not lock after release: %v", err)
+	}
+	l.Release()
+}
+
+func TestLease(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a, b := NewLease(dir, "a", 30*time.Second), NewLease(dir, "b", 30*time.Second)
+	a.Now, b.Now = clock, clock
+
+	try := func(l *Lease, wantOK bool, wantHolder string) {
+		t.Helper()
+		ok, holder, err := l.TryAcquire()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok != wantOK || holder != wantHolder {
+			t.Fatalf("%s: TryAcquire() = %v, %s, want %v, %s", l.Holder(), ok, holder, wantOK, wantHolder)
+		}
+	}
+
+	try(a, true, "a")
+	try(b, false, "a")
+
+	// The leader renews the lease, so it does not expire
+	now = now.Add(20 * time.Second)
+	try(a, true, "a")
+	now = now.Add(20 * time.Second)
+	try(b, false, "a")
+
+	// The leader stops renewing, and the standby takes over
+	now = now.Add(20 * time.Second)
+	try(b, true, "b")
+	try(a, false, "b")
+
+	// Releasing the lease hands it over right away
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+	try(a, true, "a")
+}
+
+func TestLeaseTakeoverHasOneWinner(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	a, b, c := NewLease(dir, "a", time.Minute), NewLease(dir, "b", time.Minute), NewLease(dir, "c", time.Minute)
+	a.Now, b.Now, c.Now = clock, clock, clock
+	if ok, _, _ := a.TryAcquire(); !ok {
+		t.Fatal("a should get the lease")
+	}
+	now = now.Add(2 * time.Minute)
+
+	// Both standbys see the expired lease of the same generation, and try to create the next one
+	gen, _, err := b.current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	okB, _, errB := b.create(gen + 1)
+	okC, holder, errC := c.create(gen + 1)
+	if errB != nil || errC != nil {
+		t.Fatal(errB, errC)
+	}
+	if !okB || okC || holder != "b" {
+		t.Errorf("expected only b to get the lease, got %v and %v (%s)", okB, okC, holder)
+	}
+}
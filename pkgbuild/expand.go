@@ -0,0 +1,236 @@
+package pkgbuild
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// expandWord expands the quotes and parameters of a word. A word that is only the expansion
+// of all elements of an array, like "${source[@]}", expands to one word per element.
+// Command substitutions, arithmetic and brace expansions are not supported.
+func expandWord(word string, vars map[string][]string) ([]string, error) {
+	if name, ok := arrayWord(word); ok {
+		return vars[name], nil
+	}
+	var b strings.Builder
+	inDouble := false
+	for i := 0; i < len(word); {
+		c := word[i]
+		switch {
+		case c == '\'' && !inDouble:
+			end := strings.IndexByte(word[i+1:], '\'')
+			b.WriteString(word[i+1 : i+1+end])
+			i += end + 2
+		case c == '"':
+			inDouble = !inDouble
+			i++
+		case c == '\\' && i+1 < len(word):
+			next := word[i+1]
+			if next == '\n' {
+				// A line continuation
+			} else if inDouble && !strings.ContainsRune("$`\"\\", rune(next)) {
+				b.WriteByte(c)
+				b.WriteByte(next)
+			} else {
+				b.WriteByte(next)
+			}
+			i += 2
+		case c == '`':
+			return nil, errors.New("command substitutions are not supported")
+		case c == '$':
+			value, n, err := expandParameter(word[i:], vars)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(value)
+			i += n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return []string{b.String()}, nil
+}
+
+// arrayWord checks if a word is only the expansion of all elements of an array, and returns the name of the array
+func arrayWord(word string) (string, bool) {
+	word = strings.TrimSuffix(strings.TrimPrefix(word, `"`), `"`)
+	inner, ok := strings.CutPrefix(word, "${")
+	if !ok {
+		return "", false
+	}
+	name, ok := strings.CutSuffix(inner, "[@]}")
+	if !ok || !isName(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// expandParameter expands the parameter at the start of s, which starts with a $,
+// and returns its value and the length of the expansion in s
+func expandParameter(s string, vars map[string][]string) (string, int, error) {
+	if strings.HasPrefix(s, "$(") {
+		return "", 0, errors.New("command substitutions are not supported")
+	}
+	if !strings.HasPrefix(s, "${") {
+		n := 1
+		for n < len(s) && isNameChar(s[n]) {
+			n++
+		}
+		if n == 1 {
+			// A $ that is not followed by a name is literal
+			return "$", 1, nil
+		}
+		return lookup(vars, s[1:n], ""), n, nil
+	}
+
+	// Find the closing brace
+	depth, end := 0, -1
+	for i := 1; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				end = i
+			}
+		case '\\':
+			i++
+		}
+	}
+	if end < 0 {
+		return "", 0, errors.New("a parameter expansion is not closed")
+	}
+	inner := s[2:end]
+	n := 0
+	for n < len(inner) && isNameChar(inner[n]) {
+		n++
+	}
+	if n == 0 {
+		return "", 0, fmt.Errorf("unsupported parameter expansion ${%s}", inner)
+	}
+	name, op := inner[:n], inner[n:]
+	index := ""
+	if strings.HasPrefix(op, "[") {
+		close := strings.IndexByte(op, ']')
+		if close < 0 {
+			return "", 0, fmt.Errorf("unsupported parameter expansion ${%s}", inner)
+		}
+		index, op = op[1:close], op[close+1:]
+	}
+	value := lookup(vars, name, index)
+
+	// The operand of an operator may itself contain expansions
+	operand := func(s string) (string, error) {
+		words, err := expandWord(s, vars)
+		if err != nil || len(words) == 0 {
+			return "", err
+		}
+		return words[0], nil
+	}
+	var err error
+	switch {
+	case op == "":
+	case op == "^^":
+		value = strings.ToUpper(value)
+	case op == ",,":
+		value = strings.ToLower(value)
+	case strings.HasPrefix(op, ":-"):
+		if value == "" {
+			value, err = operand(op[2:])
+		}
+	case strings.HasPrefix(op, "##"), strings.HasPrefix(op, "#"):
+		longest := strings.HasPrefix(op, "##")
+		var pattern string
+		if pattern, err = operand(strings.TrimLeft(op, "#")); err == nil {
+			value = trimPattern(value, pattern, true, longest)
+		}
+	case strings.HasPrefix(op, "%%"), strings.HasPrefix(op, "%"):
+		longest := strings.HasPrefix(op, "%%")
+		var pattern string
+		if pattern, err = operand(strings.TrimLeft(op, "%")); err == nil {
+			value = trimPattern(value, pattern, false, longest)
+		}
+	case strings.HasPrefix(op, "/"):
+		all := strings.HasPrefix(op, "//")
+		rest := op[1:]
+		if all {
+			rest = op[2:]
+		}
+		pattern, replacement, _ := strings.Cut(rest, "/")
+		if pattern, err = operand(pattern); err != nil {
+			break
+		}
+		if replacement, err = operand(replacement); err != nil {
+			break
+		}
+		if strings.ContainsAny(pattern, "*?[") {
+			return "", 0, fmt.Errorf("unsupported pattern in ${%s}", inner)
+		}
+		if all {
+			value = strings.ReplaceAll(value, pattern, replacement)
+		} else {
+			value = strings.Replace(value, pattern, replacement, 1)
+		}
+	default:
+		return "", 0, fmt.Errorf("unsupported parameter expansion ${%s}", inner)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return value, end + 1, nil
+}
+
+// lookup returns the value of a variable, or of an element of an array. Unset variables are empty.
+func lookup(vars map[string][]string, name, index string) string {
+	values := vars[name]
+	switch index {
+	case "":
+		index = "0"
+	case "@", "*":
+		return strings.Join(values, " ")
+	}
+	i, err := strconv.Atoi(index)
+	if err != nil || i < 0 || i >= len(values) {
+		return ""
+	}
+	return values[i]
+}
+
+// trimPattern removes the shortest or longest prefix or suffix that matches a glob pattern
+func trimPattern(value, pattern string, prefix, longest bool) string {
+	for n := range len(value) + 1 {
+		if longest {
+			n = len(value) - n
+		}
+		if prefix {
+			if ok, _ := path.Match(pattern, value[:n]); ok {
+				return value[n:]
+			}
+		} else if ok, _ := path.Match(pattern, value[len(value)-n:]); ok {
+			return value[:len(value)-n]
+		}
+	}
+	return value
+}
+
+// isName checks if s is the name of a variable
+func isName(s string) bool {
+	if s == "" || (s[0] >= '0' && s[0] <= '9') {
+		return false
+	}
+	for i := range len(s) {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNameChar checks if c can be part of the name of a variable
+func isNameChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,473 @@
+// Package pkgbuild reads and rewrites the variables of Arch Linux PKGBUILD files, and generates .SRCINFO files,
+// without running bash. Only the assignments at the top level of a PKGBUILD are read, like pkgver=1.2 and
+// source=(...), with the parameter expansions that are common in PKGBUILDs. Functions and other commands
+// are kept as they are.
+package pkgbuild
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// File is a parsed PKGBUILD
+type File struct {
+	src         string
+	assignments []assignment
+	functions   []string
+}
+
+// assignment is a top level assignment, like pkgver=1.2 or source+=(a b)
+type assignment struct {
+	name       string
+	append     bool
+	array      bool
+	words      []string // the words of the value, as they are written
+	start, end int      // the offsets of the value in the source, for rewriting it
+}
+
+var (
+	assignmentPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(\+?)=`)
+	functionPattern   = regexp.MustCompile(`^(?:function[ \t]+([^\s(){}]+)(?:[ \t]*\(\))?|([A-Za-z_][-A-Za-z0-9_.+@]*)[ \t]*\(\))\s*\{`)
+)
+
+// Parse parses a PKGBUILD
+func Parse(src []byte) (*File, error) {
+	f := &File{src: string(src)}
+	p := &parser{src: f.src}
+	for p.skipBlank(true); p.pos < len(p.src); p.skipBlank(true) {
+		if err := p.statement(f); err != nil {
+			return nil, fmt.Errorf("line %d: %w", p.line(), err)
+		}
+	}
+	return f, nil
+}
+
+// Bytes returns the PKGBUILD, with the changes made by Set
+func (f *File) Bytes() []byte {
+	return []byte(f.src)
+}
+
+// Functions returns the names of the functions that the PKGBUILD defines, like build and package
+func (f *File) Functions() []string {
+	return f.functions
+}
+
+// Has checks if a variable is assigned at the top level of the PKGBUILD
+func (f *File) Has(name string) bool {
+	return f.last(name) >= 0
+}
+
+// Values returns the values of a variable, which is a single value for a variable that is not an array,
+// or nil if it is not set. Returns an error if the value uses an expansion that is not supported.
+func (f *File) Values(name string) ([]string, error) {
+	vars, errs := f.evaluate()
+	if err := errs[name]; err != nil {
+		return nil, err
+	}
+	return vars[name], nil
+}
+
+// Value returns the value of a variable, or the first value of an array
+func (f *File) Value(name string) (string, error) {
+	values, err := f.Values(name)
+	if err != nil || len(values) == 0 {
+		return "", err
+	}
+	return values[0], nil
+}
+
+// Set replaces the value of a variable. An array stays an array, with one value per line,
+// like updpkgsums writes checksums. The variable must already be set, and not be appended to.
+func (f *File) Set(name string, values ...string) error {
+	i := f.last(name)
+	if i < 0 {
+		return fmt.Errorf("%s is not set in the PKGBUILD", name)
+	}
+	a := f.assignments[i]
+	if a.append {
+		return fmt.Errorf("%s is appended to in the PKGBUILD, and can not be rewritten", name)
+	}
+
+	var value string
+	if !a.array && len(values) == 1 {
+		value = quote(values[0])
+	} else {
+		// Align the values with the first one
+		lineStart := strings.LastIndexByte(f.src[:a.start], '\n') + 1
+		indent := []byte(f.src[lineStart : a.start+1])
+		for j, c := range indent {
+			if c != '\t' {
+				indent[j] = ' '
+			}
+		}
+		quoted := make([]string, len(values))
+		for j, v := range values {
+			quoted[j] = singleQuote(v)
+		}
+		value = "(" + strings.Join(quoted, "\n"+string(indent)) + ")"
+	}
+	updated, err := Parse([]byte(f.src[:a.start] + value + f.src[a.end:]))
+	if err != nil {
+		return err
+	}
+	*f = *updated
+	return nil
+}
+
+// last returns the index of the last assignment to a variable, or -1
+func (f *File) last(name string) int {
+	for i := len(f.assignments) - 1; i >= 0; i-- {
+		if f.assignments[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// evaluate evaluates the assignments in order, and returns the values of the variables,
+// and the errors of the variables whose values could not be expanded
+func (f *File) evaluate() (map[string][]string, map[string]error) {
+	vars := make(map[string][]string)
+	errs := make(map[string]error)
+	for _, a := range f.assignments {
+		var values []string
+		var err error
+		for _, word := range a.words {
+			var expanded []string
+			if expanded, err = expandWord(word, vars); err != nil {
+				break
+			}
+			values = append(values, expanded...)
+		}
+		if err != nil {
+			errs[a.name] = fmt.Errorf("could not expand %s: %w", a.name, err)
+			continue
+		}
+		if a.append {
+			vars[a.name] = append(vars[a.name], values...)
+			continue
+		}
+		if values == nil {
+			values = []string{}
+		}
+		vars[a.name] = values
+		delete(errs, a.name)
+	}
+	return vars, errs
+}
+
+// quote quotes a value for bash, if needed
+func quote(s string) string {
+	if s != "" && strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789._+-:/@%,=") == "" {
+		return s
+	}
+	return singleQuote(s)
+}
+
+// singleQuote quotes a value for bash with single quotes
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// parser finds the assignments and functions at the top level of a PKGBUILD
+type parser struct {
+	src string
+	pos int
+}
+
+// line returns the line number of the current position
+func (p *parser) line() int {
+	return strings.Count(p.src[:p.pos], "\n") + 1
+}
+
+// skipBlank skips spaces, comments, line continuations and, if newlines is true, newlines and semicolons
+func (p *parser) skipBlank(newlines bool) {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == ' ' || c == '\t':
+			p.pos++
+		case (c == '\n' || c == ';') && newlines:
+			p.pos++
+		case c == '\\' && strings.HasPrefix(p.src[p.pos:], "\\\n"):
+			p.pos += 2
+		case c == '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine skips to the end of the line
+func (p *parser) skipLine() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+// statement parses an assignment or a function, or skips a command
+func (p *parser) statement(f *File) error {
+	rest := p.src[p.pos:]
+	if m := assignmentPattern.FindStringSubmatch(rest); m != nil {
+		a := assignment{name: m[1], append: m[2] == "+"}
+		p.pos += len(m[0])
+		a.start = p.pos
+		if strings.HasPrefix(p.src[p.pos:], "(") {
+			a.array = true
+			p.pos++
+			for {
+				p.skipBlank(true)
+				if p.pos >= len(p.src) {
+					return fmt.Errorf("the array %s is not closed", a.name)
+				}
+				if p.src[p.pos] == ')' {
+					p.pos++
+					break
+				}
+				word, err := p.word()
+				if err != nil {
+					return err
+				}
+				if word == "" {
+					return fmt.Errorf("unexpected %q in the array %s", p.src[p.pos], a.name)
+				}
+				a.words = append(a.words, word)
+			}
+		} else {
+			word, err := p.word()
+			if err != nil {
+				return err
+			}
+			a.words = []string{word}
+		}
+		a.end = p.pos
+		f.assignments = append(f.assignments, a)
+		return nil
+	}
+	if m := functionPattern.FindStringSubmatchIndex(rest); m != nil {
+		var name string
+		if m[2] >= 0 {
+			name = rest[m[2]:m[3]]
+		} else {
+			name = rest[m[4]:m[5]]
+		}
+		f.functions = append(f.functions, name)
+		p.pos += m[1] - 1
+		return p.skipBraces()
+	}
+
+	// Any other command is skipped, up to the end of the line
+	for p.pos < len(p.src) {
+		p.skipBlank(false)
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' || p.src[p.pos] == ';' {
+			return nil
+		}
+		word, err := p.word()
+		if err != nil {
+			return err
+		}
+		if word == "" {
+			// An operator, like ( or |
+			p.pos++
+		}
+	}
+	return nil
+}
+
+// word reads a word, up to an unquoted blank or operator, and returns it as it is written
+func (p *parser) word() (string, error) {
+	start := p.pos
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; c {
+		case ' ', '\t', '\n', ';', '(', ')', '&', '|', '<', '>':
+			return p.src[start:p.pos], nil
+		case '\\':
+			p.pos += 2
+		case '\'':
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return "", errors.New("a single quote is not closed")
+			}
+			p.pos += end + 2
+		case '"':
+			if err := p.skipDoubleQuoted(); err != nil {
+				return "", err
+			}
+		case '$', '`':
+			if err := p.skipSubstitution(); err != nil {
+				return "", err
+			}
+		default:
+			p.pos++
+		}
+	}
+	p.pos = min(p.pos, len(p.src))
+	return p.src[start:p.pos], nil
+}
+
+// skipDoubleQuoted skips a double quoted string, starting at the opening quote
+func (p *parser) skipDoubleQuoted() error {
+	p.pos++
+	for p.pos < len(p.src) {
+		switch p.src[p.pos] {
+		case '"':
+			p.pos++
+			return nil
+		case '\\':
+			p.pos += 2
+		case '$', '`':
+			if err := p.skipSubstitution(); err != nil {
+				return err
+			}
+		default:
+			p.pos++
+		}
+	}
+	return errors.New("a double quote is not closed")
+}
+
+// skipSubstitution skips a parameter expansion, command substitution or arithmetic expansion, starting at the $ or `
+func (p *parser) skipSubstitution() error {
+	rest := p.src[p.pos:]
+	var open, close byte
+	switch {
+	case strings.HasPrefix(rest, "${"):
+		open, close = '{', '}'
+	case strings.HasPrefix(rest, "$("):
+		open, close = '(', ')'
+	case rest[0] == '`':
+		end := strings.IndexByte(rest[1:], '`')
+		if end < 0 {
+			return errors.New("a command substitution is not closed")
+		}
+		p.pos += end + 2
+		return nil
+	default:
+		p.pos++
+		return nil
+	}
+	p.pos++
+	depth := 0
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; c {
+		case open:
+			depth++
+			p.pos++
+		case close:
+			depth--
+			p.pos++
+			if depth == 0 {
+				return nil
+			}
+		case '\\':
+			p.pos += 2
+		case '\'':
+			if open == '{' {
+				// Single quotes in a parameter expansion inside double quotes are literal
+				p.pos++
+				continue
+			}
+			end := strings.IndexByte(p.src[p.pos+1:], '\'')
+			if end < 0 {
+				return errors.New("a single quote is not closed")
+			}
+			p.pos += end + 2
+		case '"':
+			if err := p.skipDoubleQuoted(); err != nil {
+				return err
+			}
+		case '$', '`':
+			if err := p.skipSubstitution(); err != nil {
+				return err
+			}
+		default:
+			p.pos++
+		}
+	}
+	return fmt.Errorf("a %c is not closed", open)
+}
+
+// skipBraces skips the body of a function, starting at the opening brace, including here-documents
+func (p *parser) skipBraces() error {
+	depth := 0
+	atWordStart := true
+	var heredocs []string // the delimiters of the here-documents that start on the current line
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == '#' && atWordStart:
+			p.skipLine()
+			continue
+		case c == '\n':
+			p.pos++
+			for _, delimiter := range heredocs {
+				p.skipHeredoc(delimiter)
+			}
+			heredocs = nil
+		case c == '{' && atWordStart && (p.pos+1 == len(p.src) || strings.IndexByte(" \t\n", p.src[p.pos+1]) >= 0):
+			// A group of commands, unlike a brace expansion like {README,LICENSE}
+			depth++
+			p.pos++
+		case c == '}' && atWordStart:
+			depth--
+			p.pos++
+			if depth == 0 {
+				return nil
+			}
+		case c == '<' && strings.HasPrefix(p.src[p.pos:], "<<") && !strings.HasPrefix(p.src[p.pos:], "<<<"):
+			p.pos += 2
+			strip := strings.HasPrefix(p.src[p.pos:], "-")
+			if strip {
+				p.pos++
+			}
+			p.skipBlank(false)
+			word, err := p.word()
+			if err != nil {
+				return err
+			}
+			delimiter := strings.NewReplacer(`'`, "", `"`, "", `\`, "").Replace(word)
+			if strip {
+				delimiter = "\t" + delimiter
+			}
+			heredocs = append(heredocs, delimiter)
+		case c == ' ' || c == '\t' || c == ';' || c == '(' || c == ')' || c == '&' || c == '|' || c == '<' || c == '>':
+			p.pos++
+		default:
+			if _, err := p.word(); err != nil {
+				return err
+			}
+			if p.pos < len(p.src) && p.src[p.pos] == '<' {
+				// A redirection right after a word, like cat<<EOF
+				atWordStart = true
+				continue
+			}
+		}
+		atWordStart = c == ' ' || c == '\t' || c == '\n' || c == ';' || c == '{' || c == '}' || c == '(' || c == ')' || c == '&' || c == '|'
+	}
+	return errors.New("a function is not closed")
+}
+
+// skipHeredoc skips the lines of a here-document, up to and including the line with the delimiter.
+// A delimiter that starts with a tab is a <<- here-document, where leading tabs are ignored.
+func (p *parser) skipHeredoc(delimiter string) {
+	strip := strings.HasPrefix(delimiter, "\t")
+	delimiter = strings.TrimPrefix(delimiter, "\t")
+	for p.pos < len(p.src) {
+		end := strings.IndexByte(p.src[p.pos:], '\n')
+		if end < 0 {
+			end = len(p.src) - p.pos
+		}
+		line := p.src[p.pos : p.pos+end]
+		p.pos = min(p.pos+end+1, len(p.src))
+		if strip {
+			line = strings.TrimLeft(line, "\t")
+		}
+		if line == delimiter {
+			return
+		}
+	}
+}
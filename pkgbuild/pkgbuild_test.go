@@ -0,0 +1,176 @@
+package pkgbuild
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testPKGBUILD = `# Maintainer: Packager <packager@example.com>
+
+pkgname=tool
+pkgver=1.2.0
+pkgrel=3
+pkgdesc='A tool that does things,   well'
+arch=(x86_64 aarch64)
+url="https://github.com/upstream/$pkgname"
+license=(BSD-3-Clause)
+depends=(glibc)
+makedepends=(git cmake) # for building
+_tag=v${pkgver//_/-}
+source=("$pkgname-$pkgver.tar.gz::$url/archive/$_tag.tar.gz"
+        "git+https://github.com/upstream/docs.git#tag=$_tag"
+        fix-build.patch)
+sha256sums=('0000000000000000000000000000000000000000000000000000000000000000'
+            'SKIP'
+            'abcd')
+source_x86_64=("https://example.com/bin-${pkgver%.*}-x86_64.tar.gz")
+sha256sums_x86_64=('1111')
+
+prepare() {
+  cd "$pkgname-$pkgver"
+  patch -p1 < ../fix-build.patch
+  cat > config.h <<EOF
+#define VERSION "$pkgver"
+}
+EOF
+}
+
+package() {
+  cd "$pkgname-${pkgver}"
+  install -Dm644 {README,LICENSE} -t "$pkgdir/usr/share/doc/$pkgname/"
+}
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse([]byte(testPKGBUILD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"pkgver", []string{"1.2.0"}},
+		{"url", []string{"https://github.com/upstream/tool"}},
+		{"makedepends", []string{"git", "cmake"}},
+		{"source", []string{
+			"tool-1.2.0.tar.gz::https://github.com/upstream/tool/archive/v1.2.0.tar.gz",
+			"git+https://github.com/upstream/docs.git#tag=v1.2.0",
+			"fix-build.patch",
+		}},
+		{"source_x86_64", []string{"https://example.com/bin-1.2-x86_64.tar.gz"}},
+		{"b2sums", nil},
+	}
+	for _, tt := range tests {
+		got, err := f.Values(tt.name)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+	if want := []string{"prepare", "package"}; !slices.Equal(f.Functions(), want) {
+		t.Errorf("expected the functions %q, got %q", want, f.Functions())
+	}
+}
+
+func TestSet(t *testing.T) {
+	f, err := Parse([]byte(testPKGBUILD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, set := range []struct {
+		name   string
+		values []string
+	}{
+		{"pkgver", []string{"1.3.0_rc1"}},
+		{"pkgrel", []string{"1"}},
+		{"sha256sums", []string{"aaaa", "SKIP", "abcd"}},
+		{"sha256sums_x86_64", []string{"bbbb"}},
+	} {
+		if err := f.Set(set.name, set.values...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := string(f.Bytes())
+	for _, want := range []string{
+		"pkgver=1.3.0_rc1\npkgrel=1\n",
+		"sha256sums=('aaaa'\n            'SKIP'\n            'abcd')\n",
+		"sha256sums_x86_64=('bbbb')\n",
+		"#define VERSION \"$pkgver\"\n}\nEOF\n}\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the PKGBUILD:\n%s", want, got)
+		}
+	}
+	if source, _ := f.Values("source"); source[0] != "tool-1.3.0_rc1.tar.gz::https://github.com/upstream/tool/archive/v1.3.0-rc1.tar.gz" {
+		t.Errorf("expected the sources to use the new version, got %q", source[0])
+	}
+	if err := f.Set("b2sums", "cccc"); err == nil {
+		t.Error("expected an error for a variable that is not set")
+	}
+}
+
+func TestSrcInfo(t *testing.T) {
+	f, err := Parse([]byte(testPKGBUILD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.SrcInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `pkgbase = tool
+	pkgdesc = A tool that does things, well
+	pkgver = 1.2.0
+	pkgrel = 3
+	url = https://github.com/upstream/tool
+	arch = x86_64
+	arch = aarch64
+	license = BSD-3-Clause
+	makedepends = git
+	makedepends = cmake
+	depends = glibc
+	source = tool-1.2.0.tar.gz::https://github.com/upstream/tool/archive/v1.2.0.tar.gz
+	source = git+https://github.com/upstream/docs.git#tag=v1.2.0
+	source = fix-build.patch
+	sha256sums = 0000000000000000000000000000000000000000000000000000000000000000
+	sha256sums = SKIP
+	sha256sums = abcd
+	source_x86_64 = https://example.com/bin-1.2-x86_64.tar.gz
+	sha256sums_x86_64 = 1111
+
+pkgname = tool
+
+`
+	if string(got) != want {
+		t.Errorf("unexpected .SRCINFO:\n%s\nexpected:\n%s", got, want)
+	}
+}
+
+func TestUnsupportedExpansion(t *testing.T) {
+	f, err := Parse([]byte("pkgname=tool\npkgver=$(date +%Y)\npkgrel=1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Value("pkgver"); err == nil {
+		t.Error("expected an error for a command substitution")
+	}
+	if pkgrel, err := f.Value("pkgrel"); err != nil || pkgrel != "1" {
+		t.Errorf("expected the other variables to be read, got %q, %v", pkgrel, err)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	for version, want := range map[string]string{
+		"v1.2.3":      "1.2.3",
+		"9.1.0123":    "9.1.0123",
+		"1.0-rc1":     "1.0_rc1",
+		"2.0.0+build": "2.0.0+build",
+	} {
+		if got := Version(version); got != want {
+			t.Errorf("Version(%q): expected %q, got %q", version, want, got)
+		}
+	}
+}
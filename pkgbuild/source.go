@@ -0,0 +1,89 @@
+package pkgbuild
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Algorithms are the checksum algorithms of makepkg that can be computed, in the order of the .SRCINFO fields.
+// The checksums of an algorithm are in the array with the name of the algorithm followed by sums, like sha256sums.
+var Algorithms = []string{"md5", "sha1", "sha224", "sha256", "sha384", "sha512", "b2"}
+
+// hashAlgorithms are all checksum algorithms of makepkg, including ck, which can not be computed
+var hashAlgorithms = []string{"ck", "md5", "sha1", "sha224", "sha256", "sha384", "sha512", "b2"}
+
+// NewHash returns a hash for a checksum algorithm, or nil if it is not supported
+func NewHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha224":
+		return sha256.New224()
+	case "sha256":
+		return sha256.New()
+	case "sha384":
+		return sha512.New384()
+	case "sha512":
+		return sha512.New()
+	case "b2":
+		h, _ := blake2b.New512(nil)
+		return h
+	}
+	return nil
+}
+
+// Source is an entry of a source array, like name.tar.gz::https://example.com/file.tar.gz
+type Source struct {
+	Name string // the name of the file in $srcdir, if it is given
+	URL  string // the URL, or the name of a file next to the PKGBUILD
+}
+
+// ParseSource parses an entry of a source array
+func ParseSource(entry string) Source {
+	if name, url, ok := strings.Cut(entry, "::"); ok {
+		return Source{Name: name, URL: url}
+	}
+	return Source{URL: entry}
+}
+
+// IsLocal checks if the source is a file next to the PKGBUILD, like a patch
+func (s Source) IsLocal() bool {
+	return !strings.Contains(s.URL, "://")
+}
+
+// IsVCS checks if the source is a repository, like git+https://example.com/tool.git#tag=v1.2,
+// which makepkg does not check the checksums of
+func (s Source) IsVCS() bool {
+	scheme, _, ok := strings.Cut(s.URL, "://")
+	if !ok {
+		return false
+	}
+	if strings.Contains(scheme, "+") {
+		return true
+	}
+	switch scheme {
+	case "git", "svn", "hg", "bzr", "fossil":
+		return true
+	}
+	return false
+}
+
+// Version converts an upstream version to a pkgver, which can not contain hyphens, colons, slashes or whitespace,
+// so these are replaced with underscores, like 1.0_rc1 for 1.0-rc1. A leading v is removed.
+func Version(version string) string {
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ':' || r == '/' || r == ' ' || r == '\t' || r == '\n' {
+			return '_'
+		}
+		return r
+	}, version)
+}
@@ -0,0 +1,104 @@
+package pkgbuild
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The fields of a .SRCINFO, in the order that makepkg --printsrcinfo writes them
+var (
+	srcinfoSingle = []string{"pkgdesc", "pkgver", "pkgrel", "epoch", "url", "install", "changelog"}
+	srcinfoMulti  = []string{"arch", "groups", "license", "checkdepends", "makedepends", "depends", "optdepends",
+		"provides", "conflicts", "replaces", "noextract", "options", "backup", "source", "validpgpkeys"}
+	srcinfoArch = []string{"source", "provides", "conflicts", "depends", "replaces", "optdepends", "makedepends", "checkdepends"}
+)
+
+// SrcInfo generates the .SRCINFO of the PKGBUILD, like makepkg --printsrcinfo. Since the functions are not run,
+// the fields that the package functions of a split package override are not included in the package sections.
+func (f *File) SrcInfo() ([]byte, error) {
+	vars, errs := f.evaluate()
+	var b strings.Builder
+	write := func(name string, single bool) error {
+		if err := errs[name]; err != nil {
+			return err
+		}
+		values := vars[name]
+		if single && len(values) > 1 {
+			values = values[:1]
+		}
+		for _, value := range values {
+			// Whitespace is collapsed, like makepkg does
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				fmt.Fprintf(&b, "\t%s = %s\n", name, value)
+			}
+		}
+		return nil
+	}
+
+	names := vars["pkgname"]
+	if len(names) == 0 {
+		if err := errs["pkgname"]; err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("pkgname is not set in the PKGBUILD")
+	}
+	pkgbase := names[0]
+	if base := vars["pkgbase"]; len(base) > 0 && base[0] != "" {
+		pkgbase = base[0]
+	}
+	fmt.Fprintf(&b, "pkgbase = %s\n", pkgbase)
+	for _, name := range srcinfoSingle {
+		if err := write(name, true); err != nil {
+			return nil, err
+		}
+	}
+	multi := append([]string{}, srcinfoMulti...)
+	for _, algorithm := range hashAlgorithms {
+		multi = append(multi, algorithm+"sums")
+	}
+	for _, name := range multi {
+		if err := write(name, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, arch := range vars["arch"] {
+		if arch == "any" {
+			continue
+		}
+		fields := append([]string{}, srcinfoArch...)
+		for _, algorithm := range hashAlgorithms {
+			fields = append(fields, algorithm+"sums")
+		}
+		for _, name := range fields {
+			if err := write(name+"_"+arch, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	b.WriteString("\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "pkgname = %s\n\n", name)
+	}
+	return []byte(b.String()), nil
+}
+
+// FullVersion returns the version of the package, like 1:1.2.3-1, with the epoch if there is one
+func (f *File) FullVersion() (string, error) {
+	vars, errs := f.evaluate()
+	for _, name := range []string{"pkgver", "pkgrel", "epoch"} {
+		if err := errs[name]; err != nil {
+			return "", err
+		}
+	}
+	first := func(name string) string {
+		if len(vars[name]) == 0 {
+			return ""
+		}
+		return vars[name][0]
+	}
+	version := first("pkgver") + "-" + first("pkgrel")
+	if epoch := first("epoch"); epoch != "" && epoch != "0" {
+		version = epoch + ":" + version
+	}
+	return version, nil
+}
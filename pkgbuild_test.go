@@ -0,0 +1,116 @@
+package vigilant
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+	"golang.org/x/crypto/blake2b"
+)
+
+func TestPKGBUILDMode(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Trigger = config.TriggerTags
+		c.Repos[0].TagPattern = "v*"
+		c.Repos[0].Mode = config.ModePKGBUILD
+		c.Repos[0].TargetPath = "tool/PKGBUILD"
+	})
+	tarballs := e.gh.URL() + "repos/upstream/tool/tarball"
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Update tool to 1.0.0",
+		Files: map[string]string{
+			"tool/PKGBUILD": fmt.Sprintf(`pkgname=tool
+pkgver=1.0.0
+pkgrel=2
+pkgdesc='A tool'
+arch=(x86_64)
+url=https://github.com/upstream/tool
+license=(MIT)
+source=("$pkgname-$pkgver.tar.gz::%s/v$pkgver"
+        tool.sysusers)
+sha256sums=('0000'
+            'abcd')
+b2sums=('0000'
+        'ef01')
+
+package() {
+  cd upstream-tool-*
+  install -Dm755 tool "$pkgdir/usr/bin/tool"
+}
+`, tarballs),
+			"tool/.SRCINFO": "pkgbase = tool\n",
+		},
+	})
+
+	e.source.Tag("v1.0.0", "main")
+	e.check()
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.source.Tag("v1.1.0", "main")
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Title != "Update tool to 1.1.0-1" {
+		t.Errorf("unexpected title %q", pr.Title)
+	}
+	if !strings.Contains(pr.Body, "updates tool in `tool/PKGBUILD` from 1.0.0-2 to 1.1.0-1") || !strings.Contains(pr.Body, "Return 0") {
+		t.Errorf("expected the update and the commits in the body:\n%s", pr.Body)
+	}
+
+	// The checksums are those of the tarball of the new tag
+	resp, err := http.Get(tarballs + "/v1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tarball, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha256sum := sha256.Sum256(tarball)
+	b2sum := blake2b.Sum512(tarball)
+	updated, _ := e.target.File(pr.Head, "tool/PKGBUILD")
+	for _, want := range []string{
+		"pkgver=1.1.0\npkgrel=1\n",
+		fmt.Sprintf("sha256sums=('%s'\n            'abcd')\n", hex.EncodeToString(sha256sum[:])),
+		fmt.Sprintf("b2sums=('%s'\n        'ef01')\n", hex.EncodeToString(b2sum[:])),
+		"  install -Dm755 tool \"$pkgdir/usr/bin/tool\"\n",
+	} {
+		if !strings.Contains(updated, want) {
+			t.Errorf("expected %q in the PKGBUILD:\n%s", want, updated)
+		}
+	}
+	srcinfo, _ := e.target.File(pr.Head, "tool/.SRCINFO")
+	for _, want := range []string{"\tpkgver = 1.1.0\n", "\tsource = tool-1.1.0.tar.gz::" + tarballs + "/v1.1.0\n", "\tsha256sums = " + hex.EncodeToString(sha256sum[:]) + "\n"} {
+		if !strings.Contains(srcinfo, want) {
+			t.Errorf("expected %q in the .SRCINFO:\n%s", want, srcinfo)
+		}
+	}
+	if _, ok := e.target.File(pr.Head, "src-main.c-updates.md"); ok {
+		t.Error("expected no notification file")
+	}
+
+	// A PKGBUILD that already has the version of a new tag is not updated again
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Update tool to 1.2.0",
+		Files:   map[string]string{"tool/PKGBUILD": strings.Replace(updated, "pkgver=1.1.0", "pkgver=1.2.0", 1)},
+	})
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.source.Tag("v1.2.0", "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 1 {
+		t.Errorf("expected still 1 pull request, got %d", n)
+	}
+	if tag := e.engine.state.Watch(e.engine.repoConfigs[0].Key()).LastTag; tag != "v1.2.0" {
+		t.Errorf("expected v1.2.0 to be remembered, got %q", tag)
+	}
+}
@@ -0,0 +1,71 @@
+package pullrequest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+)
+
+// closeSuperseded closes all other open pull requests that were created for the same watch or group,
+// with a comment that points to the newer pull request that replaces them.
+func (c *Creator) closeSuperseded(ctx context.Context, watch config.RepoConfig, newer int) {
+	if watch.KeepSuperseded {
+		return
+	}
+	for _, record := range c.state.PullRequests() {
+		if record.Watch != watch.GroupKey() || record.Number == 0 || record.Number == newer || !record.ClosedAt.IsZero() {
+			continue
+		}
+		owner, repo := config.SplitRepoName(record.Repo)
+		pr, _, err := c.client.PullRequests.Get(ctx, owner, repo, record.Number)
+		if err != nil {
+			c.logger().Warn("Could not check if a superseded pull request is still open", "pr", record.URL, "error", err)
+			continue
+		}
+		if pr.GetState() == "open" {
+			comment := &github.IssueComment{
+				Body: github.String(fmt.Sprintf("Superseded by #%d.", newer)),
+			}
+			if _, _, err := c.client.Issues.CreateComment(ctx, owner, repo, record.Number, comment); err != nil {
+				c.logger().Warn("Could not comment on a superseded pull request", "pr", record.URL, "error", err)
+			}
+			if _, _, err := c.client.PullRequests.Edit(ctx, owner, repo, record.Number, &github.PullRequest{State: github.String("closed")}); err != nil {
+				c.logger().Error("Could not close a superseded pull request", "pr", record.URL, "error", err)
+				continue
+			}
+			c.logger().Info("Closed superseded pull request", "pr", record.URL, "superseded_by", newer)
+		}
+		record.ClosedAt = c.now()
+		if err := c.state.UpdatePullRequest(record); err != nil {
+			c.logger().Error("Could not save state", "error", err)
+		}
+	}
+}
+
+// rollbackBranch deletes a branch that was created for a pull request that could not be created.
+// A fresh context is used, since the context of the pull request may already be cancelled.
+func (c *Creator) rollbackBranch(record state.PullRequestRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.apiTimeout)
+	defer cancel()
+	owner, repo := config.SplitRepoName(record.BranchRepo())
+	if err := c.DeleteBranch(ctx, owner, repo, record.Branch); err != nil {
+		c.logger().Error("Could not roll back branch", "branch", record.Branch, "repo", record.BranchRepo(), "error", err)
+		return
+	}
+	c.logger().Info("Rolled back branch", "branch", record.Branch, "repo", record.BranchRepo())
+	if err := c.state.RemovePullRequest(record.Repo, record.Branch); err != nil {
+		c.logger().Error("Could not save state", "error", err)
+	}
+}
+
+// DeleteBranch deletes a branch. A branch that is already gone is not an error.
+func (c *Creator) DeleteBranch(ctx context.Context, owner, repo, branch string) error {
+	_, err := c.client.Git.DeleteRef(ctx, owner, repo, "heads/"+branch)
+	if err != nil && (IsNotFound(err) || IsUnprocessable(err)) {
+		return nil
+	}
+	return err
+}
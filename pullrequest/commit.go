@@ -0,0 +1,173 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+)
+
+// loadSigningKey reads an ASCII armored private PGP key and decrypts it with the given passphrase
+func loadSigningKey(path, passphrase string) (*openpgp.Entity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entities, err := openpgp.ReadArmoredKeyRing(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not read PGP key from %s: %w", path, err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("%s does not contain a private PGP key", path)
+	}
+	entity := entities[0]
+
+	if passphrase == "" {
+		passphrase = env.Str("VIGILANT_SIGNING_KEY_PASSPHRASE", "")
+	}
+	if entity.PrivateKey.Encrypted && passphrase == "" {
+		return nil, fmt.Errorf("the PGP key in %s is encrypted, but no passphrase is configured", path)
+	}
+	if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+		return nil, fmt.Errorf("could not decrypt the PGP key in %s: %w", path, err)
+	}
+	return entity, nil
+}
+
+// signingKey returns the decrypted signing key for the given commit configuration,
+// loading it the first time it is needed. Returns nil if no signing key is configured.
+func (c *Creator) signingKey(cc config.CommitConfig) (*openpgp.Entity, error) {
+	if cc.SigningKey == "" {
+		return nil, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entity, ok := c.signingKeys[cc.SigningKey]; ok {
+		return entity, nil
+	}
+	entity, err := loadSigningKey(cc.SigningKey, cc.SigningKeyPassphrase)
+	if err != nil {
+		return nil, err
+	}
+	if c.signingKeys == nil {
+		c.signingKeys = make(map[string]*openpgp.Entity)
+	}
+	c.signingKeys[cc.SigningKey] = entity
+	return entity, nil
+}
+
+// commitIdentities returns the author and committer for a commit.
+// If a signing key is given, its primary identity is used for any missing names or emails.
+// Both are nil if nothing is configured, which makes GitHub use the owner of the token.
+func commitIdentities(cc config.CommitConfig, key *openpgp.Entity, now time.Time) (author, committer *github.CommitAuthor) {
+	if key != nil {
+		if id := key.PrimaryIdentity(); id != nil && id.UserId != nil {
+			if cc.AuthorName == "" {
+				cc.AuthorName = id.UserId.Name
+			}
+			if cc.AuthorEmail == "" {
+				cc.AuthorEmail = id.UserId.Email
+			}
+		}
+	}
+	if cc.AuthorName == "" && cc.AuthorEmail == "" {
+		return nil, nil
+	}
+	date := &github.Timestamp{Time: now}
+	author = &github.CommitAuthor{
+		Name:  github.String(cc.AuthorName),
+		Email: github.String(cc.AuthorEmail),
+		Date:  date,
+	}
+	if cc.CommitterName == "" && cc.CommitterEmail == "" {
+		return author, author
+	}
+	committer = &github.CommitAuthor{
+		Name:  github.String(cc.CommitterName),
+		Email: github.String(cc.CommitterEmail),
+		Date:  date,
+	}
+	return author, committer
+}
+
+// createCommit builds a commit on top of parentSHA with the Git Data API, by creating blobs,
+// a tree and a commit, which is signed if a signing key is configured. Returns the SHA of the new commit.
+// No branch is modified.
+func (c *Creator) createCommit(ctx context.Context, owner, repo, parentSHA string, changes []state.FileChange, message string, cc config.CommitConfig) (string, error) {
+	if len(changes) == 0 {
+		return "", errors.New("a commit needs at least one change")
+	}
+
+	parent, _, err := c.client.Git.GetCommit(ctx, owner, repo, parentSHA)
+	if err != nil {
+		return "", fmt.Errorf("could not get commit %s: %w", parentSHA, err)
+	}
+
+	entries := make([]*github.TreeEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := &github.TreeEntry{
+			Path: github.String(change.Path),
+			Mode: github.String(change.Mode),
+			Type: github.String("blob"),
+		}
+		switch change.Mode {
+		case "":
+			entry.Mode = github.String("100644")
+		case gitlinkMode:
+			entry.Type = github.String("commit")
+		}
+		switch {
+		case change.Delete:
+			// A tree entry without SHA and content deletes the path
+		case change.Content != nil:
+			blob, _, err := c.client.Git.CreateBlob(ctx, owner, repo, &github.Blob{
+				Content:  github.String(base64.StdEncoding.EncodeToString(change.Content)),
+				Encoding: github.String("base64"),
+			})
+			if err != nil {
+				return "", fmt.Errorf("could not create blob for %s: %w", change.Path, err)
+			}
+			entry.SHA = blob.SHA
+		default:
+			entry.SHA = github.String(change.SHA)
+		}
+		entries = append(entries, entry)
+	}
+
+	tree, _, err := c.client.Git.CreateTree(ctx, owner, repo, parent.GetTree().GetSHA(), entries)
+	if err != nil {
+		return "", fmt.Errorf("could not create tree: %w", err)
+	}
+
+	key, err := c.signingKey(cc)
+	if err != nil {
+		return "", err
+	}
+	author, committer := commitIdentities(cc, key, c.now())
+	if key != nil && author == nil {
+		return "", errors.New("signed commits need an author name and email")
+	}
+
+	commit, _, err := c.client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message:    github.String(message),
+		Tree:       &github.Tree{SHA: tree.SHA},
+		Parents:    []*github.Commit{{SHA: github.String(parentSHA)}},
+		Author:     author,
+		Committer:  committer,
+		SigningKey: key,
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not create commit: %w", err)
+	}
+	return commit.GetSHA(), nil
+}
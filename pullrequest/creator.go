@@ -0,0 +1,602 @@
+// Package pullrequest renders and creates the pull requests that notify about upstream changes.
+// Every pull request is created as an operation in the outbox of the state store,
+// so that it can be resumed from where it stopped after a crash or a failed API call.
+package pullrequest
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+)
+
+// Creator creates pull requests for the watches of a configuration
+type Creator struct {
+	Now        func() time.Time // returns the current time, defaults to time.Now
+	Logger     *slog.Logger     // defaults to slog.Default()
+	HTTPClient *http.Client     // downloads the sources of packages, defaults to http.DefaultClient
+
+	client      *github.Client
+	state       *state.Store
+	config      *config.Config
+	apiTimeout  time.Duration
+	mu          sync.Mutex
+	signingKeys map[string]*openpgp.Entity
+}
+
+// ErrUpToDate is returned when the target of a watch already has the upstream changes,
+// like a PKGBUILD that already has the new version. The changes are recorded as handled.
+var ErrUpToDate = errors.New("the target is already up to date")
+
+// New returns a Creator that uses the given client, and keeps track of its work in the given store
+func New(client *github.Client, store *state.Store, cfg *config.Config) *Creator {
+	return &Creator{
+		client:     client,
+		state:      store,
+		config:     cfg,
+		apiTimeout: time.Duration(cfg.APITimeout) * time.Second,
+	}
+}
+
+// now returns the current time
+func (c *Creator) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// httpClient returns the client for downloads
+func (c *Creator) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// logger returns the logger to use
+func (c *Creator) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// opLogger returns a logger that adds the watch and the branch of the operation to every message
+func (c *Creator) opLogger(op *state.Operation) *slog.Logger {
+	return c.logger().With("watch", op.Watch, "target", op.Repo, "branch", op.Branch, "upstream_sha", op.UpstreamSHA)
+}
+
+// LoadSigningKeys loads and decrypts the signing keys of all watches, so that problems are found at startup
+func (c *Creator) LoadSigningKeys() error {
+	for _, watch := range c.config.Watches() {
+		if _, err := c.signingKey(watch.Commit.Merge(c.config.Commit)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchByKey returns the watch that the pull requests with the given key are created for.
+// For the key of a group, this is the first watch of the group, whose settings are used for the combined pull request.
+func (c *Creator) watchByKey(key string) (config.RepoConfig, bool) {
+	for _, watch := range c.config.Watches() {
+		if watch.GroupKey() == key {
+			return watch, true
+		}
+	}
+	return config.RepoConfig{}, false
+}
+
+// TemplateData collects the data that the pull request templates are rendered against.
+// The commits are listed newest first, as returned by the GitHub API. The diff of the watched paths
+// is fetched with the compare API, between the last synced commit and the newest commit,
+// and is left empty if that fails.
+func (c *Creator) TemplateData(ctx context.Context, watch config.RepoConfig, commits []*github.RepositoryCommit) *TemplateData {
+	if len(commits) == 0 {
+		return c.TemplateDataBetween(ctx, watch, commits, "", "")
+	}
+
+	// Without a last synced commit, compare with the parent of the oldest one
+	oldest, newest := commits[len(commits)-1], commits[0]
+	baseSHA := c.state.Watch(watch.Key()).LastSHA
+	if baseSHA == "" && len(oldest.Parents) > 0 {
+		baseSHA = oldest.Parents[0].GetSHA()
+	}
+	return c.TemplateDataBetween(ctx, watch, commits, baseSHA, newest.GetSHA())
+}
+
+// TemplateDataBetween collects the data that the pull request templates are rendered against,
+// with the diff between the given commits, like the commits of two releases
+func (c *Creator) TemplateDataBetween(ctx context.Context, watch config.RepoConfig, commits []*github.RepositoryCommit, baseSHA, headSHA string) *TemplateData {
+	data := &TemplateData{
+		Watch:   watch,
+		Now:     c.now(),
+		BaseSHA: baseSHA,
+		HeadSHA: headSHA,
+	}
+	for _, commit := range commits {
+		data.Commits = append(data.Commits, newCommitInfo(commit))
+	}
+	if data.BaseSHA == "" || data.HeadSHA == "" {
+		return data
+	}
+	owner, repo := config.SplitRepoName(watch.SourceRepoName)
+	comparison, _, err := c.client.Repositories.CompareCommits(ctx, owner, repo, data.BaseSHA, data.HeadSHA, nil)
+	if err != nil {
+		c.logger().Warn("Could not fetch the diff", "source", watch.SourceRepoName, "path", watch.FilePath, "target", watch.TargetRepoName,
+			"base_sha", data.BaseSHA, "head_sha", data.HeadSHA, "error", err)
+		return data
+	}
+	var files []*github.CommitFile
+	for _, file := range comparison.Files {
+		if !watch.Watches(file.GetFilename()) {
+			continue
+		}
+		files = append(files, file)
+		info := newFileInfo(file)
+		data.Files = append(data.Files, info)
+		data.Stats.Additions += info.Additions
+		data.Stats.Deletions += info.Deletions
+		data.Stats.Changes += info.Changes
+	}
+	data.Diff = unifiedDiff(files)
+	data.DiffStat = diffStat(data.Files)
+	return data
+}
+
+// Create renders the pull request for the given watch and data, and creates it as a tracked
+// operation in the outbox. If it fails, it is resumed by the next call to Resume for the watch.
+func (c *Creator) Create(ctx context.Context, watch config.RepoConfig, data *TemplateData) error {
+	text, changes, err := c.prepare(ctx, watch, data, maxBodyLength-bodySafetyMargin)
+	if errors.Is(err, ErrUpToDate) {
+		c.skip(watch, data)
+	}
+	if err != nil {
+		return err
+	}
+	return c.create(ctx, watch, text, changes, data.HeadSHA, data.tag(), nil)
+}
+
+// CreateCombined creates one pull request for watches of the same group that have new commits,
+// with the changes of all of them. It is rendered with the group templates of the first watch,
+// against data with the members and their rendered bodies, and created with the settings of the first watch.
+func (c *Creator) CreateCombined(ctx context.Context, watches []config.RepoConfig, data []*TemplateData) error {
+	if len(watches) == 1 {
+		return c.Create(ctx, watches[0], data[0])
+	}
+
+	// Every watch gets an equal share of the body
+	limit := (maxBodyLength - bodySafetyMargin) / len(watches)
+	var (
+		members []state.Member
+		changes []state.FileChange
+	)
+	combined := &TemplateData{Watch: watches[0], Group: watches[0].Group, Now: c.now()}
+	hash := sha1.New()
+	for i, watch := range watches {
+		data[i].base = changes
+		text, watchChanges, err := c.prepare(ctx, watch, data[i], limit-combinedHeaderLength)
+		if errors.Is(err, ErrUpToDate) {
+			c.skip(watch, data[i])
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		combined.Members = append(combined.Members, MemberInfo{TemplateData: data[i], Body: text.Body})
+		members = append(members, state.Member{Watch: watch.Key(), UpstreamSHA: data[i].HeadSHA, Tag: data[i].tag()})
+		fmt.Fprintf(hash, "%s@%s\n", watch.Key(), data[i].HeadSHA)
+		changes = mergeChanges(changes, watchChanges, notifies(watch))
+	}
+
+	if len(members) == 0 {
+		return ErrUpToDate
+	}
+
+	// The head is a hash of the upstream commits of all watches, so that a branch that is named after it is reused by a retry
+	combined.HeadSHA = hex.EncodeToString(hash.Sum(nil))
+	templates, err := ParseGroupTemplates(watches[0].Templates.Merge(c.config.Templates))
+	if err != nil {
+		return err
+	}
+	text, err := templates.Render(combined)
+	if err != nil {
+		return err
+	}
+	if limit := maxBodyLength - bodySafetyMargin; len(text.Body) > limit {
+		text.Body = truncateText(text.Body, limit) + "\n\n*The description was too long, and has been truncated.*\n"
+	}
+	return c.create(ctx, watches[0], text, changes, combined.HeadSHA, "", members)
+}
+
+// combinedHeaderLength leaves room for the heading of every watch in the body of a combined pull request
+const combinedHeaderLength = 256
+
+// mergeChanges adds the changes of a watch to the changes of the earlier watches of a combined pull request.
+// A notification file that is already in the list gets the new notification appended. Other files replace
+// the earlier change, since a watch that updates a file builds on the changes of the earlier watches.
+func mergeChanges(changes, more []state.FileChange, notification bool) []state.FileChange {
+	for _, change := range more {
+		i := slices.IndexFunc(changes, func(fc state.FileChange) bool { return fc.Path == change.Path })
+		switch {
+		case i < 0:
+			changes = append(changes, change)
+		case notification:
+			changes[i].Content = append(append(changes[i].Content, '\n'), change.Content...)
+		default:
+			changes[i] = change
+		}
+	}
+	return changes
+}
+
+// prepare makes the changes of the pull request for a watch, and renders its text, with a body of at most limit bytes.
+// A watch in notify mode adds the notification file, a watch in pkgbuild mode updates the PKGBUILD,
+// a watch in gomod mode updates the go.mod and go.sum, and a watch in submodule mode updates the submodule.
+func (c *Creator) prepare(ctx context.Context, watch config.RepoConfig, data *TemplateData, limit int) (*PullRequestText, []state.FileChange, error) {
+	var changes []state.FileChange
+	var err error
+	switch watch.Mode {
+	case config.ModePKGBUILD:
+		changes, err = c.updatePKGBUILD(ctx, watch, data)
+	case config.ModeGoMod:
+		changes, err = c.updateGoMod(ctx, watch, data)
+	case config.ModeSubmodule:
+		changes, err = c.updateSubmodule(ctx, watch, data)
+	case config.ModeSync:
+		changes, err = c.updateSync(ctx, watch, data)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	text, notification, err := c.render(watch, data, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return text, append(changes, notification...), nil
+}
+
+// notifies checks if the pull requests of a watch add a notification file
+func notifies(watch config.RepoConfig) bool {
+	return watch.Mode == "" || watch.Mode == config.ModeNotify
+}
+
+// render renders the pull request text of a watch, with a body of at most limit bytes,
+// and returns the notification file, and the full diff if it did not fit in the body, for a watch that notifies
+func (c *Creator) render(watch config.RepoConfig, data *TemplateData, limit int) (*PullRequestText, []state.FileChange, error) {
+	templates, err := ParseTemplates(watch.Templates.Merge(c.config.Templates))
+	if err != nil {
+		return nil, nil, err
+	}
+	text, err := templates.Render(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// If the diff makes the body too long, truncate it, and attach the full diff as a patch file instead
+	var fullDiff string
+	if len(text.Body) > limit && data.Diff != "" {
+		fullDiff = data.Diff
+		data.Diff = truncateText(fullDiff, max(0, len(fullDiff)-(len(text.Body)-limit)-bodySafetyMargin))
+		data.DiffTruncated = true
+		if notifies(watch) {
+			data.PatchFile = patchFilename(watch.FilePath)
+		}
+		if text, err = templates.Render(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(text.Body) > limit {
+		text.Body = truncateText(text.Body, limit) + "\n\n*The description was too long, and has been truncated.*\n"
+	}
+
+	if !notifies(watch) {
+		return text, nil, nil
+	}
+	changes := []state.FileChange{{Path: watch.DestinationPath(), Content: []byte(text.Body)}}
+	if data.DiffTruncated {
+		changes = append(changes, state.FileChange{Path: data.PatchFile, Content: []byte(fullDiff)})
+	}
+	return text, changes, nil
+}
+
+// create saves a rendered pull request to the outbox, and creates it. The members are the watches
+// of a combined pull request, and upstreamSHA is then a hash of the upstream commits of all of them.
+func (c *Creator) create(ctx context.Context, watch config.RepoConfig, text *PullRequestText, changes []state.FileChange, upstreamSHA, tag string, members []state.Member) error {
+	// Save the rendered pull request to the outbox before making any changes, so that it can be resumed
+	op := &state.Operation{
+		ID:            watch.GroupKey() + "@" + upstreamSHA,
+		Watch:         watch.GroupKey(),
+		Step:          state.StepPrepared,
+		UpstreamSHA:   upstreamSHA,
+		Members:       members,
+		Tag:           tag,
+		Repo:          watch.TargetRepoName,
+		HeadRepo:      watch.TargetRepoName,
+		Base:          watch.PullRequestBaseBranch,
+		Branch:        text.Branch,
+		Title:         text.Title,
+		Body:          text.Body,
+		CommitMessage: text.CommitMessage,
+		Changes:       changes,
+		CreatedAt:     c.now(),
+	}
+	if err := c.state.SaveOperation(*op); err != nil {
+		return fmt.Errorf("could not save the pull request to the outbox: %w", err)
+	}
+	if err := c.Run(ctx, op); err != nil {
+		return err
+	}
+	c.opLogger(op).Info("Created pull request", "pr", op.URL, "commit_sha", op.CommitSHA)
+	return nil
+}
+
+// Run performs the remaining steps of an operation. If a step fails, the operation is kept in
+// the outbox to be retried, unless it has failed too many times, in which case it is rolled back.
+// If ctx is cancelled, the branch is deleted again, but the operation is kept, so that it can be resumed.
+// If it is cancelled with state.ErrFenced as the cause, the branch is left to the instance that took over the state.
+func (c *Creator) Run(ctx context.Context, op *state.Operation) error {
+	watch, ok := c.watchByKey(op.Watch)
+	if !ok {
+		c.abandon(op)
+		return fmt.Errorf("the watch %s is no longer configured", op.Watch)
+	}
+
+	for {
+		var err error
+		switch op.Step {
+		case state.StepPrepared:
+			err = c.stepCommit(ctx, watch, op)
+		case state.StepCommitted:
+			err = c.stepBranch(ctx, op)
+		case state.StepBranchCreated:
+			err = c.stepPullRequest(ctx, watch, op)
+		case state.StepPullRequestCreated:
+			c.stepFinish(ctx, watch, op)
+			return nil
+		default:
+			err = fmt.Errorf("unknown step %q", op.Step)
+		}
+
+		if err != nil {
+			op.LastError = err.Error()
+			if errors.Is(context.Cause(ctx), state.ErrFenced) {
+				// This instance lost the lease, so the operation belongs to the new leader,
+				// which may already be opening the pull request from the branch
+				return err
+			} else if ctx.Err() != nil {
+				// An interrupted step is not counted as an attempt, but when shutting down,
+				// do not leave a branch without a pull request behind
+				if op.Step == state.StepBranchCreated {
+					c.rollbackBranch(op.Record())
+					op.Step = state.StepCommitted
+				}
+			} else if op.Attempts++; op.Attempts >= c.config.MaxAttempts {
+				c.abandon(op)
+				c.gaveUp(op)
+				return fmt.Errorf("giving up after %d attempts: %w", op.Attempts, err)
+			}
+			if err := c.state.SaveOperation(*op); err != nil {
+				c.opLogger(op).Error("Could not save state", "error", err)
+			}
+			return err
+		}
+
+		if err := c.state.SaveOperation(*op); err != nil {
+			c.opLogger(op).Error("Could not save state", "error", err)
+		}
+	}
+}
+
+// stepCommit creates the commit on top of the base branch, in a fork if the watch is configured to use one
+func (c *Creator) stepCommit(ctx context.Context, watch config.RepoConfig, op *state.Operation) error {
+	owner, repo := config.SplitRepoName(op.Repo)
+	ref, _, err := c.client.Git.GetRef(ctx, owner, repo, "refs/heads/"+op.Base)
+	if err != nil {
+		return err
+	}
+
+	// Find out where to push the branch, which is a fork if the token can not push to the target
+	op.HeadRepo, err = c.headRepo(ctx, watch)
+	if err != nil {
+		return err
+	}
+	headOwner, headRepo := config.SplitRepoName(op.HeadRepo)
+
+	op.CommitSHA, err = c.createCommit(ctx, headOwner, headRepo, ref.GetObject().GetSHA(), op.Changes, op.CommitMessage, watch.Commit.Merge(c.config.Commit))
+	if err != nil {
+		return err
+	}
+	op.Step = state.StepCommitted
+	return nil
+}
+
+// stepBranch points the branch to the commit. Since the branch name is derived from the upstream commit,
+// an existing branch with the same name is a leftover from an earlier attempt, and is moved to the new commit.
+func (c *Creator) stepBranch(ctx context.Context, op *state.Operation) error {
+	headOwner, headRepo := config.SplitRepoName(op.HeadRepo)
+	newRef := &github.Reference{
+		Ref:    github.String("refs/heads/" + op.Branch),
+		Object: &github.GitObject{SHA: github.String(op.CommitSHA)},
+	}
+	_, _, err := c.client.Git.CreateRef(ctx, headOwner, headRepo, newRef)
+	if err != nil && IsUnprocessable(err) {
+		c.opLogger(op).Info("Branch already exists, moving it to the new commit", "head_repo", op.HeadRepo, "commit_sha", op.CommitSHA)
+		_, _, err = c.client.Git.UpdateRef(ctx, headOwner, headRepo, newRef, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Keep track of the branch, so that it can be cleaned up later
+	if err := c.state.AddPullRequest(op.Record()); err != nil {
+		c.opLogger(op).Error("Could not save state", "error", err)
+	}
+	op.Step = state.StepBranchCreated
+	return nil
+}
+
+// stepPullRequest opens the pull request, or adopts an open pull request for the same branch
+func (c *Creator) stepPullRequest(ctx context.Context, watch config.RepoConfig, op *state.Operation) error {
+	owner, repo := config.SplitRepoName(op.Repo)
+	head := pullRequestHead(op.Repo, op.HeadRepo, op.Branch)
+	newPR := &github.NewPullRequest{
+		Title: github.String(op.Title),
+		Head:  github.String(head),
+		Base:  github.String(op.Base),
+		Body:  github.String(op.Body),
+		Draft: github.Bool(watch.Draft),
+	}
+	pr, _, err := c.client.PullRequests.Create(ctx, owner, repo, newPR)
+	if err != nil && IsUnprocessable(err) {
+		pr, err = c.findPullRequest(ctx, op)
+	}
+	if err != nil {
+		return err
+	}
+
+	op.Number = pr.GetNumber()
+	op.URL = pr.GetHTMLURL()
+	if err := c.state.AddPullRequest(op.Record()); err != nil {
+		c.opLogger(op).Error("Could not save state", "error", err)
+	}
+	op.Step = state.StepPullRequestCreated
+	return nil
+}
+
+// findPullRequest finds an open pull request for the branch of the operation
+func (c *Creator) findPullRequest(ctx context.Context, op *state.Operation) (*github.PullRequest, error) {
+	owner, repo := config.SplitRepoName(op.Repo)
+	headOwner, _ := config.SplitRepoName(op.HeadRepo)
+	prs, _, err := c.client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		Head:  headOwner + ":" + op.Branch,
+		State: "open",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(prs) == 0 {
+		return nil, fmt.Errorf("could not create a pull request for %s, and found no existing one", op.Branch)
+	}
+	c.opLogger(op).Info("Found an existing pull request for the branch", "pr", prs[0].GetHTMLURL())
+	return prs[0], nil
+}
+
+// stepFinish closes superseded pull requests, applies the metadata, and records that the upstream commit
+// has been handled. Failures here are logged, but do not fail the pull request as a whole.
+func (c *Creator) stepFinish(ctx context.Context, watch config.RepoConfig, op *state.Operation) {
+	owner, repo := config.SplitRepoName(op.Repo)
+	c.closeSuperseded(ctx, watch, op.Number)
+	if err := c.applyMetadata(ctx, owner, repo, op.Number, watch); err != nil {
+		c.opLogger(op).Warn("Created pull request, but could not apply all metadata", "pr", op.URL, "error", err)
+	}
+	members := op.Members
+	if len(members) == 0 {
+		members = []state.Member{{Watch: op.Watch, UpstreamSHA: op.UpstreamSHA, Tag: op.Tag}}
+	}
+	for _, member := range members {
+		if err := c.synced(member); err != nil {
+			c.opLogger(op).Error("Could not save state", "error", err)
+		}
+	}
+	if err := c.state.RemoveOperation(op.ID); err != nil {
+		c.opLogger(op).Error("Could not save state", "error", err)
+	}
+}
+
+// synced records that a watch has been synced to an upstream commit, and release or tag
+func (c *Creator) synced(member state.Member) error {
+	return c.state.UpdateWatch(member.Watch, func(ws *state.WatchState) {
+		ws.LastSHA = member.UpstreamSHA
+		ws.LastChecked = c.now()
+		if member.Tag != "" {
+			ws.LastTag = member.Tag
+		}
+		ws.AbandonedSHA = ""
+	})
+}
+
+// gaveUp records the upstream commits of an operation that failed too many times, so that the watches
+// do not try to create a pull request for them again, until there are newer upstream commits
+func (c *Creator) gaveUp(op *state.Operation) {
+	members := op.Members
+	if len(members) == 0 {
+		members = []state.Member{{Watch: op.Watch, UpstreamSHA: op.UpstreamSHA}}
+	}
+	for _, member := range members {
+		if err := c.state.UpdateWatch(member.Watch, func(ws *state.WatchState) { ws.AbandonedSHA = member.UpstreamSHA }); err != nil {
+			c.opLogger(op).Error("Could not save state", "error", err)
+			continue
+		}
+		c.logger().Warn("The upstream commit is not tried again until there is a newer one", "watch", member.Watch, "upstream_sha", member.UpstreamSHA)
+	}
+}
+
+// skip records the upstream changes of a watch whose target already has them, so that no pull request is opened for them
+func (c *Creator) skip(watch config.RepoConfig, data *TemplateData) {
+	c.logger().Info("The target already has the changes", "watch", watch.Key(), "target", watch.TargetRepoName, "head_sha", data.HeadSHA, "tag", data.tag())
+	if err := c.synced(state.Member{Watch: watch.Key(), UpstreamSHA: data.HeadSHA, Tag: data.tag()}); err != nil {
+		c.logger().Error("Could not save state", "watch", watch.Key(), "error", err)
+	}
+}
+
+// abandon rolls back an operation that can not be completed, by deleting its branch,
+// unless a pull request was already opened for it, and removing it from the outbox
+func (c *Creator) abandon(op *state.Operation) {
+	c.opLogger(op).Error("Abandoning pull request", "attempts", op.Attempts, "last_error", op.LastError)
+	if op.Step == state.StepBranchCreated {
+		c.rollbackBranch(op.Record())
+	}
+	if err := c.state.RemoveOperation(op.ID); err != nil {
+		c.opLogger(op).Error("Could not save state", "error", err)
+	}
+}
+
+// Resume resumes the unfinished operation of a watch, or of the group of the watch, if there is one.
+// Returns an error if the operation could not be completed, in which case the watch should not create another one.
+func (c *Creator) Resume(ctx context.Context, watch config.RepoConfig) error {
+	op, ok := c.state.OperationFor(watch.GroupKey())
+	if !ok {
+		return nil
+	}
+	c.opLogger(&op).Info("Resuming pull request", "step", op.Step, "attempt", op.Attempts+1)
+	if err := c.Run(ctx, &op); err != nil {
+		return err
+	}
+	c.opLogger(&op).Info("Created pull request", "pr", op.URL, "commit_sha", op.CommitSHA)
+	return nil
+}
+
+// AbandonOrphaned rolls back the operations of watches that are no longer configured
+func (c *Creator) AbandonOrphaned() {
+	for _, op := range c.state.Operations() {
+		if _, ok := c.watchByKey(op.Watch); !ok {
+			op.LastError = "the watch is no longer configured"
+			c.abandon(&op)
+		}
+	}
+}
+
+// IsNotFound checks if the given error is a 404 response from the GitHub API
+func IsNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// IsUnprocessable checks if the given error is a 422 response from the GitHub API
+func IsUnprocessable(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusUnprocessableEntity
+}
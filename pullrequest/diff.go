@@ -0,0 +1,114 @@
+package pullrequest
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v50/github"
+)
+
+const (
+	// maxBodyLength is the maximum length of a pull request body on GitHub
+	maxBodyLength = 65536
+
+	// bodySafetyMargin leaves room below maxBodyLength for the truncation notice
+	bodySafetyMargin = 1024
+
+	// diffStatWidth is the maximum width of the +/- bars in a diffstat
+	diffStatWidth = 50
+)
+
+// unifiedDiff combines the patches of the given files to a unified diff with git style headers.
+// Files that GitHub returned no patch for, like binary or very large files, only get a header.
+func unifiedDiff(files []*github.CommitFile) string {
+	var sb strings.Builder
+	for _, file := range files {
+		name := file.GetFilename()
+		oldName := name
+		if file.GetPreviousFilename() != "" {
+			oldName = file.GetPreviousFilename()
+		}
+		fmt.Fprintf(&sb, "diff --git a/%s b/%s\n", oldName, name)
+		if file.GetPatch() == "" {
+			fmt.Fprintf(&sb, "Binary files or too large diff for %s\n", name)
+			continue
+		}
+		switch file.GetStatus() {
+		case "added":
+			fmt.Fprintf(&sb, "--- /dev/null\n+++ b/%s\n", name)
+		case "removed":
+			fmt.Fprintf(&sb, "--- a/%s\n+++ /dev/null\n", oldName)
+		default:
+			fmt.Fprintf(&sb, "--- a/%s\n+++ b/%s\n", oldName, name)
+		}
+		sb.WriteString(file.GetPatch())
+		if !strings.HasSuffix(file.GetPatch(), "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// diffStat formats the changed files like "git diff --stat" does
+func diffStat(files []FileInfo) string {
+	if len(files) == 0 {
+		return ""
+	}
+	nameWidth, maxChanges := 0, 0
+	for _, file := range files {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(file.Filename))
+		maxChanges = max(maxChanges, file.Additions+file.Deletions)
+	}
+	var (
+		sb                   strings.Builder
+		additions, deletions int
+	)
+	for _, file := range files {
+		plus, minus := file.Additions, file.Deletions
+		if maxChanges > diffStatWidth {
+			// Scale the bars, but always show at least one character for a non-zero count
+			plus = scaleBar(plus, maxChanges)
+			minus = scaleBar(minus, maxChanges)
+		}
+		fmt.Fprintf(&sb, " %-*s | %d %s%s\n", nameWidth, file.Filename, file.Additions+file.Deletions, strings.Repeat("+", plus), strings.Repeat("-", minus))
+		additions += file.Additions
+		deletions += file.Deletions
+	}
+	noun := "files"
+	if len(files) == 1 {
+		noun = "file"
+	}
+	fmt.Fprintf(&sb, " %d %s changed, %d insertions(+), %d deletions(-)", len(files), noun, additions, deletions)
+	return sb.String()
+}
+
+func scaleBar(n, maxChanges int) int {
+	if n == 0 {
+		return 0
+	}
+	return max(1, n*diffStatWidth/maxChanges)
+}
+
+// truncateText cuts s to at most n bytes, at the end of a line if possible, and never inside of a UTF-8 sequence
+func truncateText(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	s = s[:n]
+	if i := strings.LastIndexByte(s, '\n'); i > 0 {
+		return s[:i+1]
+	}
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// patchFilename returns the name of the file that the full diff is written to when it is too large for the body
+func patchFilename(filePath string) string {
+	return strings.ReplaceAll(filePath, "/", "-") + ".patch"
+}
@@ -0,0 +1,90 @@
+package pullrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+)
+
+// How long to wait for GitHub to finish creating a fork
+const (
+	forkWaitTimeout  = 2 * time.Minute
+	forkPollInterval = 3 * time.Second
+)
+
+// headRepo returns the repository that the pull request branch should be pushed to, as owner/name.
+// If the watch is configured to use a fork, the fork is created if needed,
+// and its base branch is synced with the target repository.
+func (c *Creator) headRepo(ctx context.Context, watch config.RepoConfig) (string, error) {
+	if !watch.UsesFork() {
+		return watch.TargetRepoName, nil
+	}
+
+	forkName := watch.ForkRepoName
+	if forkName == "" {
+		var err error
+		if forkName, err = c.createFork(ctx, watch.TargetRepoName); err != nil {
+			return "", err
+		}
+	}
+
+	// Sync the base branch of the fork, so that the commit can be based on the head of the target
+	owner, repo := config.SplitRepoName(forkName)
+	request := &github.RepoMergeUpstreamRequest{Branch: github.String(watch.PullRequestBaseBranch)}
+	if _, _, err := c.client.Repositories.MergeUpstream(ctx, owner, repo, request); err != nil {
+		return "", fmt.Errorf("could not sync %s of fork %s: %w", watch.PullRequestBaseBranch, forkName, err)
+	}
+	return forkName, nil
+}
+
+// createFork forks the target repository into the account of the token owner, and waits until the fork is ready.
+// If the fork already exists, it is returned as it is. Returns the name of the fork as owner/name.
+func (c *Creator) createFork(ctx context.Context, targetRepoName string) (string, error) {
+	owner, repo := config.SplitRepoName(targetRepoName)
+	fork, _, err := c.client.Repositories.CreateFork(ctx, owner, repo, nil)
+	var accepted *github.AcceptedError
+	if err != nil && !errors.As(err, &accepted) {
+		return "", fmt.Errorf("could not fork %s: %w", targetRepoName, err)
+	}
+	forkName := fork.GetFullName()
+	if forkName == "" {
+		return "", fmt.Errorf("GitHub did not return the name of the fork of %s", targetRepoName)
+	}
+	if accepted == nil {
+		return forkName, nil
+	}
+
+	// The fork is created in the background, so wait until it can be read
+	c.logger().Info("Waiting for GitHub to create the fork", "fork", forkName)
+	forkOwner, forkRepo := config.SplitRepoName(forkName)
+	deadline := time.Now().Add(forkWaitTimeout)
+	for {
+		if _, _, err := c.client.Repositories.Get(ctx, forkOwner, forkRepo); err == nil {
+			return forkName, nil
+		} else if !IsNotFound(err) {
+			return "", err
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for the fork %s", forkName)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(forkPollInterval):
+		}
+	}
+}
+
+// pullRequestHead returns the head of a pull request from headRepoName into targetRepoName,
+// which is prefixed with the owner for cross-repository pull requests.
+func pullRequestHead(targetRepoName, headRepoName, branch string) string {
+	if headRepoName == targetRepoName {
+		return branch
+	}
+	owner, _ := config.SplitRepoName(headRepoName)
+	return owner + ":" + branch
+}
@@ -0,0 +1,143 @@
+package pullrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/gomod"
+	"github.com/xyproto/vigilant/state"
+)
+
+// requirement is the Go module that the watched path of a watch is part of, and the requirement of it in the target
+type requirement struct {
+	module  string      // the module path
+	dir     string      // the directory of the module in the source repository, empty for the root
+	version string      // the version that the target requires
+	goMod   *gomod.File // the go.mod of the target
+}
+
+// RequiredVersion returns the version of the Go module of the watched path, at the given upstream commit,
+// that the go.mod of the target requires, and the directory of the module in the source repository.
+// The version is the tag of the module in that directory, or a pseudo-version of a commit.
+func (c *Creator) RequiredVersion(ctx context.Context, watch config.RepoConfig, sha string) (dir, version string, err error) {
+	r, err := c.requirement(ctx, watch, nil, sha)
+	if err != nil {
+		return "", "", err
+	}
+	return r.dir, r.version, nil
+}
+
+// requirement finds the Go module of the watched path at the given upstream commit, and its requirement in the target,
+// in the go.mod as the earlier watches of a combined pull request left it, if data is given
+func (c *Creator) requirement(ctx context.Context, watch config.RepoConfig, data *TemplateData, sha string) (*requirement, error) {
+	module, dir, err := gomod.FindModule(watch.FilePath, func(name string) ([]byte, error) {
+		return c.fileAt(ctx, watch.SourceRepoName, name, sha)
+	})
+	if err != nil {
+		return nil, err
+	}
+	goModPath := watch.DestinationPath()
+	content, err := c.baseFile(ctx, watch, data, goModPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", goModPath, err)
+	}
+	f, err := gomod.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", goModPath, err)
+	}
+	required, ok := f.Require(module)
+	if !ok {
+		return nil, fmt.Errorf("%s does not require %s", goModPath, module)
+	}
+	return &requirement{module: module, dir: dir, version: required.Version, goMod: f}, nil
+}
+
+// proxy returns the client of the Go module proxy
+func (c *Creator) proxy() *gomod.Proxy {
+	proxyURL := c.config.GoProxy
+	if proxyURL == "" {
+		proxyURL = config.Defaults["go_proxy"].(string)
+	}
+	return &gomod.Proxy{URL: proxyURL, Client: c.httpClient()}
+}
+
+// updateGoMod updates the requirement of the Go module of a watch in the go.mod of the target, to the version of
+// the new release, or to the pseudo-version of the newest commit. The checksums of the new version are added to the
+// go.sum next to the go.mod, if there is one. Returns ErrUpToDate if the go.mod already requires that version, or a newer one.
+func (c *Creator) updateGoMod(ctx context.Context, watch config.RepoConfig, data *TemplateData) ([]state.FileChange, error) {
+	if data.HeadSHA == "" {
+		return nil, errors.New("a Go module can only be updated to a commit, release or tag")
+	}
+	r, err := c.requirement(ctx, watch, data, data.HeadSHA)
+	if err != nil {
+		return nil, err
+	}
+	query := data.HeadSHA
+	if data.Release != nil {
+		var ok bool
+		if query, ok = gomod.TagVersion(r.dir, data.Release.Tag); !ok {
+			return nil, fmt.Errorf("%s is not a version of %s", data.Release.Tag, r.module)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	proxy := c.proxy()
+	info, err := proxy.Info(ctx, r.module, query)
+	if err != nil {
+		return nil, err
+	}
+	if gomod.Compare(info.Version, r.version) <= 0 {
+		return nil, ErrUpToDate
+	}
+	c.logger().Info("Downloading Go module", "module", r.module, "version", info.Version)
+	mod, err := proxy.Mod(ctx, r.module, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	zip, err := proxy.Zip(ctx, r.module, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	zipHash, err := gomod.HashZip(zip)
+	if err != nil {
+		return nil, fmt.Errorf("could not hash %s@%s: %w", r.module, info.Version, err)
+	}
+
+	goModPath := watch.DestinationPath()
+	if err := r.goMod.SetRequire(r.module, info.Version); err != nil {
+		return nil, err
+	}
+	changes := []state.FileChange{{Path: goModPath, Content: r.goMod.Bytes()}}
+	goSumPath := path.Join(path.Dir(goModPath), "go.sum")
+	if sum, err := c.baseFile(ctx, watch, data, goSumPath); err == nil {
+		sum = gomod.UpdateSum(sum, r.module, r.version, info.Version, zipHash, gomod.HashMod(mod))
+		changes = append(changes, state.FileChange{Path: goSumPath, Content: sum})
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not read %s: %w", goSumPath, err)
+	}
+
+	data.Package = &PackageInfo{Name: r.module, Path: goModPath, OldVersion: r.version, Version: info.Version, Notes: requirementNotes(r, info.Version, mod)}
+	return changes, nil
+}
+
+// requirementNotes returns notes about the modules that a new version of a module requires newer versions of
+// than the target does, since the target then needs go mod tidy
+func requirementNotes(r *requirement, version string, mod []byte) []string {
+	f, err := gomod.Parse(mod)
+	if err != nil {
+		return []string{fmt.Sprintf("The go.mod of %s@%s could not be parsed: %v", r.module, version, err)}
+	}
+	var notes []string
+	for _, required := range f.Requires {
+		if current, ok := r.goMod.Require(required.Path); ok && gomod.Compare(required.Version, current.Version) > 0 {
+			notes = append(notes, fmt.Sprintf("%s@%s requires %s %s, which is newer than %s, so `go mod tidy` is needed",
+				r.module, version, required.Path, required.Version, current.Version))
+		}
+	}
+	return notes
+}
@@ -0,0 +1,108 @@
+package pullrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+)
+
+// defaultLabelColor is used for labels that vigilant has to create
+const defaultLabelColor = "ededed"
+
+// applyMetadata sets the labels, assignees, reviewers and milestone of a newly created pull request.
+// All steps are attempted, and the errors of the steps that failed are returned together.
+func (c *Creator) applyMetadata(ctx context.Context, owner, repo string, number int, watch config.RepoConfig) error {
+	var errs []error
+
+	if len(watch.Labels) > 0 {
+		if err := c.ensureLabels(ctx, owner, repo, watch.Labels); err != nil {
+			errs = append(errs, err)
+		}
+		if _, _, err := c.client.Issues.AddLabelsToIssue(ctx, owner, repo, number, watch.Labels); err != nil {
+			errs = append(errs, fmt.Errorf("could not add labels: %w", err))
+		}
+	}
+
+	if len(watch.Assignees) > 0 {
+		if _, _, err := c.client.Issues.AddAssignees(ctx, owner, repo, number, watch.Assignees); err != nil {
+			errs = append(errs, fmt.Errorf("could not add assignees: %w", err))
+		}
+	}
+
+	if len(watch.Reviewers) > 0 || len(watch.TeamReviewers) > 0 {
+		reviewers := github.ReviewersRequest{
+			Reviewers:     watch.Reviewers,
+			TeamReviewers: watch.TeamReviewers,
+		}
+		if _, _, err := c.client.PullRequests.RequestReviewers(ctx, owner, repo, number, reviewers); err != nil {
+			errs = append(errs, fmt.Errorf("could not request reviewers: %w", err))
+		}
+	}
+
+	if watch.Milestone != "" {
+		milestone, err := c.findMilestone(ctx, owner, repo, watch.Milestone)
+		if err == nil {
+			_, _, err = c.client.Issues.Edit(ctx, owner, repo, number, &github.IssueRequest{Milestone: &milestone})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not set milestone %q: %w", watch.Milestone, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ensureLabels creates the labels that do not already exist in the repository
+func (c *Creator) ensureLabels(ctx context.Context, owner, repo string, labels []string) error {
+	var errs []error
+	for _, name := range labels {
+		_, _, err := c.client.Issues.GetLabel(ctx, owner, repo, url.PathEscape(name))
+		if err == nil {
+			continue
+		}
+		if !IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("could not look up label %q: %w", name, err))
+			continue
+		}
+		label := &github.Label{
+			Name:  github.String(name),
+			Color: github.String(defaultLabelColor),
+		}
+		if _, _, err := c.client.Issues.CreateLabel(ctx, owner, repo, label); err != nil {
+			errs = append(errs, fmt.Errorf("could not create label %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findMilestone returns the number of the open milestone with the given title or number
+func (c *Creator) findMilestone(ctx context.Context, owner, repo, milestone string) (int, error) {
+	if number, err := strconv.Atoi(milestone); err == nil {
+		return number, nil
+	}
+	opts := &github.MilestoneListOptions{
+		State:       "open",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		milestones, resp, err := c.client.Issues.ListMilestones(ctx, owner, repo, opts)
+		if err != nil {
+			return 0, err
+		}
+		for _, m := range milestones {
+			if strings.EqualFold(m.GetTitle(), milestone) {
+				return m.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, errors.New("no open milestone with that title")
+		}
+		opts.Page = resp.NextPage
+	}
+}
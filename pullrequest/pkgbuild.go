@@ -0,0 +1,246 @@
+package pullrequest
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pkgbuild"
+	"github.com/xyproto/vigilant/state"
+)
+
+// downloadTimeout limits how long the download of a single source of a package may take
+const downloadTimeout = 10 * time.Minute
+
+// updatePKGBUILD updates the PKGBUILD of a watch to the new release: pkgver is set to its version, pkgrel to 1,
+// and the checksums are computed by downloading the sources. The .SRCINFO next to the PKGBUILD is regenerated,
+// if there is one. Returns ErrUpToDate if the PKGBUILD already has the version.
+func (c *Creator) updatePKGBUILD(ctx context.Context, watch config.RepoConfig, data *TemplateData) ([]state.FileChange, error) {
+	if data.Release == nil {
+		return nil, errors.New("a PKGBUILD can only be updated to a release or tag")
+	}
+	pkgbuildPath := watch.DestinationPath()
+	content, err := c.baseFile(ctx, watch, data, pkgbuildPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", pkgbuildPath, err)
+	}
+	f, err := pkgbuild.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", pkgbuildPath, err)
+	}
+	oldVersion, err := f.FullVersion()
+	if err != nil {
+		return nil, fmt.Errorf("could not read the version in %s: %w", pkgbuildPath, err)
+	}
+
+	pkgver := pkgbuild.Version(watch.TagVersion(data.Release.Tag))
+	if current, _ := f.Value("pkgver"); current == pkgver {
+		return nil, ErrUpToDate
+	}
+	if err := f.Set("pkgver", pkgver); err != nil {
+		return nil, err
+	}
+	if err := f.Set("pkgrel", "1"); err != nil {
+		return nil, err
+	}
+	if err := c.updateChecksums(ctx, f); err != nil {
+		return nil, fmt.Errorf("could not update the checksums in %s: %w", pkgbuildPath, err)
+	}
+	changes := []state.FileChange{{Path: pkgbuildPath, Content: f.Bytes()}}
+
+	srcinfoPath := path.Join(path.Dir(pkgbuildPath), ".SRCINFO")
+	if _, err := c.baseFile(ctx, watch, data, srcinfoPath); err == nil {
+		srcinfo, err := f.SrcInfo()
+		if err != nil {
+			return nil, fmt.Errorf("could not generate %s: %w", srcinfoPath, err)
+		}
+		changes = append(changes, state.FileChange{Path: srcinfoPath, Content: srcinfo})
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("could not read %s: %w", srcinfoPath, err)
+	}
+
+	name, err := f.Value("pkgbase")
+	if err == nil && name == "" {
+		name, err = f.Value("pkgname")
+	}
+	if err != nil {
+		return nil, err
+	}
+	version, err := f.FullVersion()
+	if err != nil {
+		return nil, err
+	}
+	data.Package = &PackageInfo{Name: name, Path: pkgbuildPath, OldVersion: oldVersion, Version: version}
+	return changes, nil
+}
+
+// targetFile returns the contents of a file on the base branch of the target repository of a watch
+func (c *Creator) targetFile(ctx context.Context, watch config.RepoConfig, filePath string) ([]byte, error) {
+	return c.fileAt(ctx, watch.TargetRepoName, filePath, watch.PullRequestBaseBranch)
+}
+
+// baseFile returns the contents of a file on the base branch of the target repository of a watch, with the changes
+// that the earlier watches of a combined pull request made to it, so that the changes of the watch build on theirs
+func (c *Creator) baseFile(ctx context.Context, watch config.RepoConfig, data *TemplateData, filePath string) ([]byte, error) {
+	if data != nil {
+		for _, change := range slices.Backward(data.base) {
+			if change.Path != filePath {
+				continue
+			}
+			if change.Delete {
+				return nil, fmt.Errorf("%w: %s is deleted by another watch of the group", fs.ErrNotExist, filePath)
+			}
+			if change.Content != nil {
+				return change.Content, nil
+			}
+			break
+		}
+	}
+	return c.targetFile(ctx, watch, filePath)
+}
+
+// fileAt returns the contents of a file in a repository at a branch or commit.
+// The error of a file that does not exist wraps both fs.ErrNotExist and the 404 response.
+func (c *Creator) fileAt(ctx context.Context, repoName, filePath, ref string) ([]byte, error) {
+	owner, repo := config.SplitRepoName(repoName)
+	file, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, filePath, &github.RepositoryContentGetOptions{Ref: ref})
+	if IsNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", fs.ErrNotExist, err)
+	} else if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is a directory", filePath)
+	}
+	content, err := file.GetContent()
+	return []byte(content), err
+}
+
+// updateChecksums computes the checksums of the sources of a PKGBUILD, for every checksum array that it has,
+// including those of the sources of an architecture, like sha256sums_x86_64. Repositories are skipped,
+// like makepkg does, and files next to the PKGBUILD and sources that are skipped on purpose keep their checksums.
+func (c *Creator) updateChecksums(ctx context.Context, f *pkgbuild.File) error {
+	arches, err := f.Values("arch")
+	if err != nil {
+		return err
+	}
+	arrays := []string{"source"}
+	for _, arch := range arches {
+		if f.Has("source_" + arch) {
+			arrays = append(arrays, "source_"+arch)
+		}
+	}
+	for _, array := range arrays {
+		suffix := strings.TrimPrefix(array, "source")
+		if f.Has("cksums" + suffix) {
+			return fmt.Errorf("the ck checksums of cksums%s are not supported", suffix)
+		}
+		var algorithms []string
+		old := make(map[string][]string)
+		for _, algorithm := range pkgbuild.Algorithms {
+			if !f.Has(algorithm + "sums" + suffix) {
+				continue
+			}
+			algorithms = append(algorithms, algorithm)
+			if old[algorithm], err = f.Values(algorithm + "sums" + suffix); err != nil {
+				return err
+			}
+		}
+		if len(algorithms) == 0 {
+			continue
+		}
+		entries, err := f.Values(array)
+		if err != nil {
+			return err
+		}
+
+		sums := make(map[string][]string)
+		for i, entry := range entries {
+			source := pkgbuild.ParseSource(entry)
+			kept := true
+			for _, algorithm := range algorithms {
+				kept = kept && i < len(old[algorithm]) && old[algorithm][i] == "SKIP"
+			}
+			switch {
+			case source.IsVCS() || kept:
+				for _, algorithm := range algorithms {
+					sums[algorithm] = append(sums[algorithm], "SKIP")
+				}
+			case source.IsLocal():
+				for _, algorithm := range algorithms {
+					if i >= len(old[algorithm]) {
+						return fmt.Errorf("%ssums%s has no checksum for %s", algorithm, suffix, entry)
+					}
+					sums[algorithm] = append(sums[algorithm], old[algorithm][i])
+				}
+			default:
+				downloaded, err := c.download(ctx, source.URL, algorithms)
+				if err != nil {
+					return err
+				}
+				for _, algorithm := range algorithms {
+					sums[algorithm] = append(sums[algorithm], downloaded[algorithm])
+				}
+			}
+		}
+		for _, algorithm := range algorithms {
+			if err := f.Set(algorithm+"sums"+suffix, sums[algorithm]...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// download downloads a source, and returns its checksums for the given algorithms
+func (c *Creator) download(ctx context.Context, rawURL string, algorithms []string) (map[string]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("can not download %s, only http and https sources are supported", rawURL)
+	}
+	c.logger().Info("Downloading source", "url", rawURL)
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not download %s: %s", rawURL, resp.Status)
+	}
+
+	hashes := make(map[string]hash.Hash)
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		hashes[algorithm] = pkgbuild.NewHash(algorithm)
+		writers = append(writers, hashes[algorithm])
+	}
+	if _, err := io.Copy(io.MultiWriter(writers...), resp.Body); err != nil {
+		return nil, fmt.Errorf("could not download %s: %w", rawURL, err)
+	}
+	sums := make(map[string]string)
+	for algorithm, h := range hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums, nil
+}
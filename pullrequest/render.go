@@ -0,0 +1,58 @@
+package pullrequest
+
+import (
+	"regexp"
+	"strings"
+)
+
+// zeroWidthSpace is inserted into mentions and references, so that GitHub does not link them
+const zeroWidthSpace = "\u200b"
+
+var (
+	// mentionPattern matches @user and @org/team mentions, but not email addresses
+	mentionPattern = regexp.MustCompile(`(^|[^A-Za-z0-9_./@-])@([A-Za-z0-9])`)
+
+	// referencePattern matches #123, owner/repo#123 and GH-123 style references
+	referencePattern = regexp.MustCompile(`(?i)(#|\bGH-)([0-9])`)
+
+	// markdownEscaper escapes the characters that have a meaning inline in GitHub flavored Markdown
+	markdownEscaper = strings.NewReplacer(
+		`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `{`, `\{`, `}`, `\}`,
+		`[`, `\[`, `]`, `\]`, `(`, `\(`, `)`, `\)`, `<`, `&lt;`, `>`, `&gt;`,
+		`|`, `\|`, `~`, `\~`,
+	)
+
+	// blockStartPattern matches text that would start a list or a heading
+	blockStartPattern = regexp.MustCompile(`^([-+#=]|[0-9]+[.)])`)
+)
+
+// neutralize makes sure that upstream text can not ping people or cross-link issues in the target repository
+func neutralize(s string) string {
+	s = mentionPattern.ReplaceAllString(s, "${1}@"+zeroWidthSpace+"${2}")
+	return referencePattern.ReplaceAllString(s, "${1}"+zeroWidthSpace+"${2}")
+}
+
+// escapeMarkdown escapes s so that it is rendered as plain text, on a single line
+func escapeMarkdown(s string) string {
+	s = markdownEscaper.Replace(strings.Join(strings.Fields(s), " "))
+	return blockStartPattern.ReplaceAllStringFunc(s, func(m string) string {
+		return m[:len(m)-1] + `\` + m[len(m)-1:]
+	})
+}
+
+// safeInline makes untrusted text safe for use inline in Markdown, like in a list item or a link text
+func safeInline(s string) string {
+	return escapeMarkdown(neutralize(s))
+}
+
+// commitSubject returns the first line of a commit message
+func commitSubject(message string) string {
+	subject, _, _ := strings.Cut(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	return strings.TrimSpace(subject)
+}
+
+// commitBody returns a commit message without the first line, and without surrounding blank lines
+func commitBody(message string) string {
+	_, body, _ := strings.Cut(strings.ReplaceAll(message, "\r\n", "\n"), "\n")
+	return strings.Trim(body, "\n \t")
+}
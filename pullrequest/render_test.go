@@ -0,0 +1,49 @@
+package pullrequest
+
+import "testing"
+
+func TestNeutralize(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"Thanks @user", "Thanks @\u200buser"},
+		{"cc @org/team", "cc @\u200borg/team"},
+		{"Mail user@example.com", "Mail user@example.com"},
+		{"Fixes #1", "Fixes #\u200b1"},
+		{"See owner/repo#12", "See owner/repo#\u200b12"},
+		{"Closes GH-3", "Closes GH-\u200b3"},
+		{"Issue #", "Issue #"},
+	} {
+		if got := neutralize(c.in); got != c.want {
+			t.Errorf("neutralize(%q): expected %q, got %q", c.in, c.want, got)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"Use `go test` here", "Use \\`go test\\` here"},
+		{"A ``code `span` with`` backticks", "A \\`\\`code \\`span\\` with\\`\\` backticks"},
+		{"<script>alert(1)</script>", "&lt;script&gt;alert\\(1\\)&lt;/script&gt;"},
+		{"**bold** and _it_ [link](https://example.com)", "\\*\\*bold\\*\\* and \\_it\\_ \\[link\\]\\(https://example.com\\)"},
+		{"# Heading", "\\# Heading"},
+		{"- item", "\\- item"},
+		{"1. item", "1\\. item"},
+		{"two\nlines  and\tspaces", "two lines and spaces"},
+	} {
+		if got := escapeMarkdown(c.in); got != c.want {
+			t.Errorf("escapeMarkdown(%q): expected %q, got %q", c.in, c.want, got)
+		}
+	}
+}
+
+func TestSafeInline(t *testing.T) {
+	for _, c := range []struct{ in, want string }{
+		{"Fixes #1, thanks @user", "Fixes #\u200b1, thanks @\u200buser"},
+		{"Fix owner/repo#1 in `main.c`", "Fix owner/repo#\u200b1 in \\`main.c\\`"},
+		{"<img src=x onerror=alert(1)> @admin", "&lt;img src=x onerror=alert\\(1\\)&gt; @\u200badmin"},
+		{"`@user` in a code span", "\\`@\u200buser\\` in a code span"},
+	} {
+		if got := safeInline(c.in); got != c.want {
+			t.Errorf("safeInline(%q): expected %q, got %q", c.in, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package pullrequest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+)
+
+// gitlinkMode is the mode of a tree entry that is a submodule, which points to a commit instead of a blob
+const gitlinkMode = "160000"
+
+// SubmoduleCommit returns the upstream commit that the submodule of a watch points to, on the base branch of the target
+func (c *Creator) SubmoduleCommit(ctx context.Context, watch config.RepoConfig) (string, error) {
+	owner, repo := config.SplitRepoName(watch.TargetRepoName)
+	submodulePath := watch.DestinationPath()
+	file, _, _, err := c.client.Repositories.GetContents(ctx, owner, repo, submodulePath, &github.RepositoryContentGetOptions{Ref: watch.PullRequestBaseBranch})
+	if err != nil {
+		return "", fmt.Errorf("could not read %s: %w", submodulePath, err)
+	}
+	if file == nil || file.GetType() != "submodule" {
+		return "", fmt.Errorf("%s is not a submodule", submodulePath)
+	}
+	return file.GetSHA(), nil
+}
+
+// updateSubmodule points the submodule of a watch in the target to the newest upstream commit, which is the commit
+// of the new release for watches of releases or tags. Returns ErrUpToDate if the submodule already points to that
+// commit, or to a newer one.
+func (c *Creator) updateSubmodule(ctx context.Context, watch config.RepoConfig, data *TemplateData) ([]state.FileChange, error) {
+	if data.HeadSHA == "" {
+		return nil, errors.New("a submodule can only be updated to a commit, release or tag")
+	}
+	old, err := c.SubmoduleCommit(ctx, watch)
+	if err != nil {
+		return nil, err
+	}
+	if old == data.HeadSHA {
+		return nil, ErrUpToDate
+	}
+
+	// A submodule that was moved ahead by hand is not moved back. The old commit may not be in the source
+	// repository, like when the submodule is a fork, and the submodule is then updated.
+	owner, repo := config.SplitRepoName(watch.SourceRepoName)
+	comparison, _, err := c.client.Repositories.CompareCommits(ctx, owner, repo, old, data.HeadSHA, &github.ListOptions{PerPage: 1})
+	if err == nil && comparison.GetStatus() == "behind" {
+		return nil, ErrUpToDate
+	} else if err != nil && !IsNotFound(err) {
+		return nil, fmt.Errorf("could not compare %s with %s: %w", old, data.HeadSHA, err)
+	}
+
+	version := shortSHA(data.HeadSHA)
+	if data.Release != nil {
+		version = data.Release.Tag
+	}
+	submodulePath := watch.DestinationPath()
+	data.Package = &PackageInfo{Name: watch.SourceRepoName, Path: submodulePath, OldVersion: shortSHA(old), Version: version}
+	return []state.FileChange{{Path: submodulePath, SHA: data.HeadSHA, Mode: gitlinkMode}}, nil
+}
@@ -0,0 +1,259 @@
+package pullrequest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+	"github.com/xyproto/vigilant/transform"
+)
+
+// ManifestName is the name of the manifest in the target directory of a watch in sync mode
+const ManifestName = ".vigilant-sync"
+
+// manifest records the upstream commit that a directory was last synced from,
+// and the upstream commit that every file was last changed by a sync at
+type manifest struct {
+	commit string
+	files  map[string]string // the path relative to the directory -> the upstream commit
+}
+
+// parseManifest parses a manifest, where the first line that is not a comment is "commit SHA",
+// and every following line is the upstream commit SHA of a file, and its path
+func parseManifest(data []byte) (*manifest, error) {
+	m := &manifest{files: make(map[string]string)}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sha, name, ok := strings.Cut(line, " ")
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("line %d: expected a commit and a path", n)
+		case sha == "commit":
+			m.commit = name
+		default:
+			m.files[strings.TrimSpace(name)] = sha
+		}
+	}
+	if m.commit == "" {
+		return nil, errors.New("the synced commit is missing")
+	}
+	return m, scanner.Err()
+}
+
+// bytes returns the manifest of a watch, with the files sorted by path
+func (m *manifest) bytes(watch config.RepoConfig) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# This directory is synced from %s in %s by vigilant, and changes to it will be overwritten.\n", watch.FilePath, watch.SourceRepoName)
+	fmt.Fprintf(&b, "# Every file is listed with the upstream commit that it was last changed at.\n")
+	fmt.Fprintf(&b, "commit %s\n", m.commit)
+	names := make([]string, 0, len(m.files))
+	for name := range m.files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s %s\n", m.files[name], name)
+	}
+	return []byte(b.String())
+}
+
+// SyncedCommit returns the upstream commit that the target directory of a watch in sync mode was last synced from,
+// according to its manifest, or an empty string if the directory has not been synced yet
+func (c *Creator) SyncedCommit(ctx context.Context, watch config.RepoConfig) (string, error) {
+	m, err := c.manifest(ctx, watch)
+	if err != nil || m == nil {
+		return "", err
+	}
+	return m.commit, nil
+}
+
+// manifest reads the manifest in the target directory of a watch, which is nil if there is none
+func (c *Creator) manifest(ctx context.Context, watch config.RepoConfig) (*manifest, error) {
+	manifestPath := path.Join(watch.DestinationPath(), ManifestName)
+	content, err := c.targetFile(ctx, watch, manifestPath)
+	if IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", manifestPath, err)
+	}
+	m, err := parseManifest(content)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", manifestPath, err)
+	}
+	return m, nil
+}
+
+// updateSync makes the target directory of a watch a copy of the watched directory at the newest upstream commit,
+// with the files that the include and exclude globs of the watch select, changed by the transforms of the watch.
+// Files that an earlier sync wrote, according to the manifest, and that are not in the watched directory anymore, are
+// deleted from the target directory, except for those that the globs leave alone. Other files in the target directory
+// are kept. The manifest is written with the upstream commit of every file. Returns ErrUpToDate if the target directory
+// already has the files.
+func (c *Creator) updateSync(ctx context.Context, watch config.RepoConfig, data *TemplateData) ([]state.FileChange, error) {
+	if data.HeadSHA == "" {
+		return nil, errors.New("a directory can only be synced from a commit, release or tag")
+	}
+	pipeline, err := transform.New(watch)
+	if err != nil {
+		return nil, err
+	}
+	sourceDir, targetDir := watch.WatchedPath(), watch.DestinationPath()
+	old, err := c.manifest(ctx, watch)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		old = &manifest{files: make(map[string]string)}
+	}
+	upstream, err := c.treeFiles(ctx, watch.SourceRepoName, data.HeadSHA, sourceDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(upstream) == 0 {
+		return nil, fmt.Errorf("%s is not a directory with files at %s", watch.FilePath, data.HeadSHA)
+	}
+	target, err := c.treeFiles(ctx, watch.TargetRepoName, watch.PullRequestBaseBranch, targetDir)
+	if err != nil {
+		return nil, err
+	}
+
+	synced := &manifest{commit: data.HeadSHA, files: make(map[string]string)}
+	transformed := make([][]string, pipeline.Len()) // the files that every transform changed
+	var changes []state.FileChange
+	for _, name := range sortedKeys(upstream) {
+		entry := upstream[name]
+		if !watch.Syncs(name) || name == ManifestName {
+			continue
+		}
+		// The files that are transformed are compared after the transforms, so they are always downloaded
+		sha, transforms := entry.GetSHA(), pipeline.Transforms(name)
+		var content []byte
+		var applied []int
+		if transforms {
+			if content, err = c.blob(ctx, watch.SourceRepoName, entry.GetSHA()); err != nil {
+				return nil, fmt.Errorf("could not get %s from %s: %w", path.Join(sourceDir, name), watch.SourceRepoName, err)
+			}
+			if content, applied, err = pipeline.Apply(ctx, name, path.Join(sourceDir, name), content); err != nil {
+				return nil, err
+			}
+			sha = blobSHA(content)
+		}
+		if current, ok := target[name]; ok && current.GetSHA() == sha && current.GetMode() == entry.GetMode() {
+			synced.files[name] = data.HeadSHA
+			if commit, ok := old.files[name]; ok {
+				synced.files[name] = commit
+			}
+			continue
+		}
+		if !transforms {
+			if content, err = c.blob(ctx, watch.SourceRepoName, entry.GetSHA()); err != nil {
+				return nil, fmt.Errorf("could not get %s from %s: %w", path.Join(sourceDir, name), watch.SourceRepoName, err)
+			}
+		}
+		for _, i := range applied {
+			transformed[i] = append(transformed[i], name)
+		}
+		changes = append(changes, state.FileChange{Path: path.Join(targetDir, name), Content: content, Mode: entry.GetMode()})
+		synced.files[name] = data.HeadSHA
+	}
+	for _, name := range sortedKeys(target) {
+		if _, ok := synced.files[name]; ok || !watch.Syncs(name) {
+			continue
+		}
+		if _, ok := old.files[name]; !ok {
+			continue
+		}
+		changes = append(changes, state.FileChange{Path: path.Join(targetDir, name), Delete: true})
+	}
+	if len(changes) == 0 {
+		return nil, ErrUpToDate
+	}
+	changes = append(changes, state.FileChange{Path: path.Join(targetDir, ManifestName), Content: synced.bytes(watch)})
+
+	version := shortSHA(data.HeadSHA)
+	if data.Release != nil {
+		version = data.Release.Tag
+	}
+	data.Package = &PackageInfo{Name: watch.SourceRepoName, Path: targetDir, OldVersion: shortSHA(old.commit), Version: version}
+	for i, names := range transformed {
+		if len(names) == 1 {
+			data.Transforms = append(data.Transforms, fmt.Sprintf("%s in `%s`", pipeline.Describe(i), names[0]))
+		} else if len(names) > 1 {
+			data.Transforms = append(data.Transforms, fmt.Sprintf("%s in %d files", pipeline.Describe(i), len(names)))
+		}
+	}
+	return changes, nil
+}
+
+// blob downloads the content of a blob
+func (c *Creator) blob(ctx context.Context, repoName, sha string) ([]byte, error) {
+	owner, repo := config.SplitRepoName(repoName)
+	blob, _, err := c.client.Git.GetBlob(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	if blob.GetEncoding() != "base64" {
+		return []byte(blob.GetContent()), nil
+	}
+	return base64.StdEncoding.DecodeString(strings.ReplaceAll(blob.GetContent(), "\n", ""))
+}
+
+// blobSHA returns the SHA of a git blob with the given content
+func blobSHA(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// treeFiles returns the files in a directory of a repository at a branch or commit, by their path relative to the directory.
+// An empty directory, or ".", is the root of the repository.
+func (c *Creator) treeFiles(ctx context.Context, repoName, ref, dir string) (map[string]*github.TreeEntry, error) {
+	owner, repo := config.SplitRepoName(repoName)
+	tree, _, err := c.client.Git.GetTree(ctx, owner, repo, ref, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not get the files of %s at %s: %w", repoName, ref, err)
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("%s has too many files at %s to be listed", repoName, ref)
+	}
+	prefix := strings.Trim(path.Clean("/"+dir), "/") + "/"
+	if prefix == "/" {
+		prefix = ""
+	}
+	files := make(map[string]*github.TreeEntry)
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" {
+			continue
+		}
+		if name, ok := strings.CutPrefix(entry.GetPath(), prefix); ok {
+			files[name] = entry
+		}
+	}
+	return files, nil
+}
+
+// sortedKeys returns the keys of a map of files, sorted
+func sortedKeys(files map[string]*github.TreeEntry) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
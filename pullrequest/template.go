@@ -0,0 +1,419 @@
+package pullrequest
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/state"
+	"github.com/xyproto/vigilant/transform"
+)
+
+// The default templates reproduce the original, hard-coded pull request format,
+// except that the branch is named after the upstream commit, so that a retry reuses it
+const (
+	defaultBranchTemplate        = `{{ slug .Watch.DisplayPath }}-update-{{ with .Release }}{{ slug .Tag }}{{ else }}{{ short .HeadSHA }}{{ end }}`
+	defaultTitleTemplate         = `{{ with .Package }}Update {{ .Name }} to {{ .Version }}{{ else }}Update: Changes in {{ .Watch.DisplayPath }}{{ with .Release }} in {{ .Tag }}{{ end }}{{ end }}`
+	defaultCommitMessageTemplate = `{{ with .Package }}Update {{ .Name }} to {{ .Version }}{{ else }}Notify about changes to {{ .Watch.DisplayPath }}{{ with .Release }} in {{ .Tag }}{{ end }}{{ end }}`
+	defaultBodyTemplate          = "{{ with .Package }}This pull request updates {{ safe .Name }} in `{{ .Path }}` {{ with .OldVersion }}from {{ . }} {{ end }}to {{ .Version }}, " +
+		"for the changes to `{{ $.Watch.DisplayPath }}` in the source repository" +
+		"{{ else }}This pull request notifies that there have been changes to `{{ .Watch.DisplayPath }}` in the source repository{{ end }}" +
+		"{{ with .Release }}, in {{ if .URL }}[{{ safe .Name }}]({{ .URL }}){{ else }}{{ safe .Name }}{{ end }}" +
+		"{{ with .PreviousTag }} since {{ safe . }}{{ end }}{{ end }}.\n\n" +
+		"{{ with .Package }}{{ with .Notes }}{{ range . }}> {{ safe . }}\n{{ end }}\n{{ end }}{{ end }}" +
+		"{{ with .Transforms }}The files were changed before they were committed:\n\n{{ range . }}* {{ . }}\n{{ end }}\n{{ end }}" +
+		"{{ range .Commits }}" +
+		"- {{ if .URL }}[{{ safe (subject .Message) }}]({{ .URL }}){{ else }}{{ safe (subject .Message) }}{{ end }}" +
+		"{{ with .Author }} by {{ safe . }}{{ end }}" +
+		"{{ if not .Date.IsZero }} - {{ date \"RFC1123\" .Date }}{{ end }}\n" +
+		"{{ if body .Message }}\n  <details>\n  <summary>Full commit message</summary>\n\n{{ indent 2 (fence \"\" .Message) }}\n\n  </details>\n\n{{ end }}" +
+		"{{ end }}" +
+		"{{ if .Diff }}\n{{ fence \"\" .DiffStat }}\n\n<details>\n<summary>Diff</summary>\n\n{{ fence \"diff\" .Diff }}\n\n" +
+		"{{ if .DiffTruncated }}The diff was truncated.{{ with .PatchFile }} The full diff is in `{{ . }}` on this branch.{{ end }}\n\n{{ end }}</details>\n{{ end }}"
+)
+
+// The default templates of combined pull requests list the rendered body of every member under a heading,
+// and name the branch after the group and a hash of the upstream commits of all members
+const (
+	defaultGroupBranchTemplate        = `{{ slug .Group }}-update-{{ short .HeadSHA }}`
+	defaultGroupTitleTemplate         = `{{ with .Packages }}Update {{ range $i, $p := . }}{{ if $i }}, {{ end }}{{ $p.Name }} to {{ $p.Version }}{{ end }}{{ else }}Update: Changes in {{ join ", " .Paths }}{{ end }}`
+	defaultGroupCommitMessageTemplate = `{{ with .Packages }}Update {{ range $i, $p := . }}{{ if $i }}, {{ end }}{{ $p.Name }} to {{ $p.Version }}{{ end }}{{ else }}Notify about changes to {{ join ", " .Paths }}{{ end }}`
+	defaultGroupBodyTemplate          = "This pull request notifies that there have been changes to the watches of the `{{ .Group }}` group.\n" +
+		"{{ range .Members }}\n## `{{ .Watch.DisplayPath }}` in {{ .Watch.SourceRepoName }}\n\n{{ trim .Body }}\n{{ end }}"
+)
+
+// TemplateData is the data model that all templates are rendered against
+type TemplateData struct {
+	Watch      config.RepoConfig // the watch that triggered the pull request
+	Release    *ReleaseInfo      // the new release or tag, for watches of releases or tags
+	Package    *PackageInfo      // the updated package, for watches that update a PKGBUILD, a Go module requirement or a submodule
+	Transforms []string          // the transforms that changed the synced files, for watches in sync mode
+	Commits    []CommitInfo      // the new upstream commits, newest first
+	Stats      DiffStats         // the combined diff stats of the watched files
+	Files      []FileInfo        // the watched files that were changed by the new commits
+	Now        time.Time         // the time of rendering
+
+	BaseSHA       string // the last synced upstream commit that the diff is against
+	HeadSHA       string // the newest upstream commit
+	Diff          string // the unified diff of the watched paths
+	DiffStat      string // the diffstat of the watched paths, like "git diff --stat"
+	DiffTruncated bool   // true if Diff was truncated to fit in the pull request body
+	PatchFile     string // the name of the file on the branch with the full diff, if it was truncated
+
+	Group   string       // the group of a combined pull request
+	Members []MemberInfo // the watches of a combined pull request that have new commits, in the order of the configuration
+
+	base []state.FileChange // the changes of the earlier watches of a combined pull request, which this watch builds on
+}
+
+// MemberInfo is a watch of a combined pull request, with its data, and its body as rendered with its own templates
+type MemberInfo struct {
+	*TemplateData
+	Body string
+}
+
+// Paths returns the watched paths of the members of a combined pull request, without duplicates
+func (data *TemplateData) Paths() []string {
+	var paths []string
+	for _, member := range data.Members {
+		if !slices.Contains(paths, member.Watch.DisplayPath()) {
+			paths = append(paths, member.Watch.DisplayPath())
+		}
+	}
+	return paths
+}
+
+// Packages returns the updated packages of the members of a combined pull request,
+// or nil if any of the members does not update a package
+func (data *TemplateData) Packages() []*PackageInfo {
+	var packages []*PackageInfo
+	for _, member := range data.Members {
+		if member.Package == nil {
+			return nil
+		}
+		packages = append(packages, member.Package)
+	}
+	return packages
+}
+
+// tag returns the release or tag of the data, if there is one
+func (data *TemplateData) tag() string {
+	if data.Release == nil {
+		return ""
+	}
+	return data.Release.Tag
+}
+
+// ReleaseInfo describes an upstream release or tag
+type ReleaseInfo struct {
+	Tag         string
+	Name        string // the name of the release, or the tag
+	URL         string // the page of the release or tag on GitHub
+	PreviousTag string // the release or tag that the commits are listed since
+	Prerelease  bool
+}
+
+// PackageInfo describes a package, a Go module requirement or a submodule that is updated to a new upstream version
+type PackageInfo struct {
+	Name       string   // the pkgbase, or the first pkgname, or the module path, or the source repository of a submodule or synced directory
+	Path       string   // the PKGBUILD, go.mod, submodule or synced directory in the target repository
+	OldVersion string   // like 1.2.0-3, v1.2.0, or the short SHA of the commit that a submodule pointed to, or a directory was synced from
+	Version    string   // like 1.3.0-1, v1.3.0, or the tag or short SHA of the commit that a submodule points to, or a directory is synced from
+	Notes      []string // what else may need to be changed by hand, like the requirements of a new module version
+}
+
+// CommitInfo describes a single upstream commit
+type CommitInfo struct {
+	SHA     string
+	Author  string
+	Email   string
+	Date    time.Time
+	Message string
+	URL     string
+}
+
+// DiffStats is the sum of the changes in all files
+type DiffStats struct {
+	Additions int
+	Deletions int
+	Changes   int
+}
+
+// FileInfo describes a single changed file
+type FileInfo struct {
+	Filename  string
+	Status    string
+	Additions int
+	Deletions int
+	Changes   int
+}
+
+// Templates is a parsed set of templates, ready to be executed
+type Templates struct {
+	branch        *template.Template
+	title         *template.Template
+	body          *template.Template
+	commitMessage *template.Template
+}
+
+// PullRequestText is the rendered output of a set of templates
+type PullRequestText struct {
+	Branch        string
+	Title         string
+	Body          string
+	CommitMessage string
+}
+
+var nonBranchChars = regexp.MustCompile(`[^A-Za-z0-9._/-]+`)
+
+// templateFuncs are the helper functions that are available in all templates
+var templateFuncs = template.FuncMap{
+	"short":      shortSHA,
+	"subject":    commitSubject,
+	"body":       commitBody,
+	"markdown":   escapeMarkdown,
+	"neutralize": neutralize,
+	"safe":       safeInline,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+	"slug":  slug,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"join": func(sep string, elems []string) string {
+		return strings.Join(elems, sep)
+	},
+	"indent": func(n int, s string) string {
+		pad := strings.Repeat(" ", n)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"fence": fence,
+	"date": func(layout string, t time.Time) string {
+		switch layout {
+		case "RFC1123":
+			layout = time.RFC1123
+		case "RFC3339":
+			layout = time.RFC3339
+		case "DateOnly":
+			layout = time.DateOnly
+		}
+		return t.Format(layout)
+	},
+}
+
+// shortSHA abbreviates a commit SHA to 7 characters
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// slug replaces the characters that can not be in a branch name with dashes
+func slug(s string) string {
+	return strings.Trim(nonBranchChars.ReplaceAllString(strings.ReplaceAll(s, "/", "-"), "-"), "-.")
+}
+
+// fence wraps s in a fenced code block, with a fence that is longer than any run of backticks in s
+func fence(lang, s string) string {
+	longest, run := 0, 0
+	for _, r := range s {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	f := strings.Repeat("`", max(3, longest+1))
+	return f + lang + "\n" + strings.TrimSuffix(s, "\n") + "\n" + f
+}
+
+// ParseTemplates parses all templates in tc, using the built-in defaults for empty fields
+func ParseTemplates(tc config.TemplateConfig) (*Templates, error) {
+	return parseTemplates(tc.Merge(config.TemplateConfig{
+		Branch:        defaultBranchTemplate,
+		Title:         defaultTitleTemplate,
+		Body:          defaultBodyTemplate,
+		CommitMessage: defaultCommitMessageTemplate,
+	}))
+}
+
+// ParseGroupTemplates parses all templates in tc for combined pull requests, using the built-in defaults
+// for combined pull requests for empty fields
+func ParseGroupTemplates(tc config.TemplateConfig) (*Templates, error) {
+	return parseTemplates(tc.Merge(config.TemplateConfig{
+		Branch:        defaultGroupBranchTemplate,
+		Title:         defaultGroupTitleTemplate,
+		Body:          defaultGroupBodyTemplate,
+		CommitMessage: defaultGroupCommitMessageTemplate,
+	}))
+}
+
+func parseTemplates(tc config.TemplateConfig) (*Templates, error) {
+	var (
+		t   Templates
+		err error
+	)
+	if t.branch, err = template.New("branch").Funcs(templateFuncs).Parse(tc.Branch); err != nil {
+		return nil, err
+	}
+	if t.title, err = template.New("title").Funcs(templateFuncs).Parse(tc.Title); err != nil {
+		return nil, err
+	}
+	if t.body, err = template.New("body").Funcs(templateFuncs).Parse(tc.Body); err != nil {
+		return nil, err
+	}
+	if t.commitMessage, err = template.New("commit_message").Funcs(templateFuncs).Parse(tc.CommitMessage); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Render executes all templates against the given data
+func (t *Templates) Render(data *TemplateData) (*PullRequestText, error) {
+	var (
+		text PullRequestText
+		err  error
+	)
+	if text.Branch, err = execute(t.branch, data); err != nil {
+		return nil, err
+	}
+	if text.Title, err = execute(t.title, data); err != nil {
+		return nil, err
+	}
+	if text.Body, err = execute(t.body, data); err != nil {
+		return nil, err
+	}
+	if text.CommitMessage, err = execute(t.commitMessage, data); err != nil {
+		return nil, err
+	}
+	// Branch names and titles must be a single line
+	text.Branch = strings.TrimSpace(text.Branch)
+	text.Title = strings.TrimSpace(text.Title)
+	if text.Branch == "" {
+		return nil, fmt.Errorf("the branch template rendered an empty branch name")
+	}
+	if text.Title == "" {
+		return nil, fmt.Errorf("the title template rendered an empty title")
+	}
+	return &text, nil
+}
+
+func execute(t *template.Template, data *TemplateData) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render the %s template: %w", t.Name(), err)
+	}
+	return buf.String(), nil
+}
+
+// newCommitInfo converts a commit from the GitHub API to the template data model
+func newCommitInfo(commit *github.RepositoryCommit) CommitInfo {
+	return CommitInfo{
+		SHA:     commit.GetSHA(),
+		Author:  commit.GetCommit().GetAuthor().GetName(),
+		Email:   commit.GetCommit().GetAuthor().GetEmail(),
+		Date:    commit.GetCommit().GetAuthor().GetDate().Time,
+		Message: commit.GetCommit().GetMessage(),
+		URL:     commit.GetHTMLURL(),
+	}
+}
+
+// newFileInfo converts a changed file from the GitHub API to the template data model
+func newFileInfo(file *github.CommitFile) FileInfo {
+	return FileInfo{
+		Filename:  file.GetFilename(),
+		Status:    file.GetStatus(),
+		Additions: file.GetAdditions(),
+		Deletions: file.GetDeletions(),
+		Changes:   file.GetChanges(),
+	}
+}
+
+// SampleData returns made-up data for previewing the templates of a watch
+func SampleData(watch config.RepoConfig, now time.Time) *TemplateData {
+	files := []FileInfo{
+		{Filename: watch.FilePath, Status: "modified", Additions: 12, Deletions: 3, Changes: 15},
+	}
+	return &TemplateData{
+		Watch: watch,
+		Commits: []CommitInfo{
+			{
+				SHA:     "3f1c2a9d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39",
+				Author:  "Jane Doe",
+				Email:   "jane@example.com",
+				Date:    now.Add(-2 * time.Hour),
+				Message: "Fix an off-by-one error\n\nThe last byte of the input was not always written.",
+				URL:     fmt.Sprintf("https://github.com/%s/commit/3f1c2a9d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39", watch.SourceRepoName),
+			},
+			{
+				SHA:     "a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9",
+				Author:  "John Roe",
+				Email:   "john@example.com",
+				Date:    now.Add(-26 * time.Hour),
+				Message: "Add a new command line option",
+				URL:     fmt.Sprintf("https://github.com/%s/commit/a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9", watch.SourceRepoName),
+			},
+		},
+		Stats:      DiffStats{Additions: 12, Deletions: 3, Changes: 15},
+		Files:      files,
+		Now:        now,
+		BaseSHA:    "0d9c8b7a6f5e4d3c2b1a0f9e8d7c6b5a4f3e2d1c",
+		HeadSHA:    "3f1c2a9d8e7b6a5f4e3d2c1b0a9f8e7d6c5b4a39",
+		Diff:       fmt.Sprintf("diff --git a/%[1]s b/%[1]s\n--- a/%[1]s\n+++ b/%[1]s\n@@ -10,3 +10,3 @@\n int main(void)\n-    return 1;\n+    return 0;\n", watch.FilePath),
+		DiffStat:   diffStat(files),
+		Release:    sampleRelease(watch),
+		Package:    samplePackage(watch),
+		Transforms: sampleTransforms(watch),
+	}
+}
+
+// sampleTransforms returns the transforms of a watch in sync mode, as if every transform changed three files
+func sampleTransforms(watch config.RepoConfig) []string {
+	pipeline, err := transform.New(watch)
+	if err != nil || watch.Mode != config.ModeSync {
+		return nil
+	}
+	var transforms []string
+	for i := range pipeline.Len() {
+		transforms = append(transforms, pipeline.Describe(i)+" in 3 files")
+	}
+	return transforms
+}
+
+// sampleRelease returns a made-up release for watches of releases or tags
+func sampleRelease(watch config.RepoConfig) *ReleaseInfo {
+	if !watch.WatchesReleases() {
+		return nil
+	}
+	return &ReleaseInfo{
+		Tag:         "v1.3.0",
+		Name:        "Version 1.3.0",
+		URL:         fmt.Sprintf("https://github.com/%s/releases/tag/v1.3.0", watch.SourceRepoName),
+		PreviousTag: "v1.2.0",
+	}
+}
+
+// samplePackage returns a made-up package for watches that update a PKGBUILD, a Go module requirement or a submodule
+func samplePackage(watch config.RepoConfig) *PackageInfo {
+	switch watch.Mode {
+	case config.ModePKGBUILD:
+		_, name := config.SplitRepoName(watch.SourceRepoName)
+		return &PackageInfo{Name: name, Path: watch.DestinationPath(), OldVersion: "1.2.0-3", Version: "1.3.0-1"}
+	case config.ModeGoMod:
+		return &PackageInfo{Name: "github.com/" + watch.SourceRepoName, Path: watch.DestinationPath(), OldVersion: "v1.2.0", Version: "v1.3.0"}
+	case config.ModeSubmodule:
+		return &PackageInfo{Name: watch.SourceRepoName, Path: watch.DestinationPath(), OldVersion: "0d9c8b7", Version: "3f1c2a9"}
+	case config.ModeSync:
+		return &PackageInfo{Name: watch.SourceRepoName, Path: watch.DestinationPath(), OldVersion: "0d9c8b7", Version: "3f1c2a9"}
+	}
+	return nil
+}
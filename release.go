@@ -0,0 +1,205 @@
+package vigilant
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+	"github.com/xyproto/vigilant/semver"
+	"github.com/xyproto/vigilant/state"
+)
+
+// maxReleasePages is the number of pages of releases or tags that are looked through for the newest version
+const maxReleasePages = 10
+
+// release is a release or tag of the source repository that matches a watch
+type release struct {
+	info    pullrequest.ReleaseInfo
+	version semver.Version
+}
+
+// releaseChanges looks for a new release or tag of the source repository of a watch, and returns the data
+// for a pull request about the commits that changed the watched path since the previous one, or nil if there are none.
+// The first release that is found is only remembered, so that pull requests are opened for the releases after it.
+func (e *Engine) releaseChanges(ctx context.Context, watch config.RepoConfig) (*pullrequest.TemplateData, error) {
+	logger := e.watchLogger(watch)
+	lastTag := e.state.Watch(watch.Key()).LastTag
+	logger.Info("Checking for new releases", "trigger", watch.Trigger, "last_tag", lastTag)
+	releases, err := e.listReleases(ctx, watch)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		logger.Info("No matching releases found", "tag_pattern", watch.TagPattern, "versions", watch.Versions)
+		return nil, nil
+	}
+	newest := releases[0]
+	if newest.info.Tag == lastTag {
+		return nil, nil
+	}
+	if last, ok := watch.MatchTag(lastTag); ok && newest.version.Compare(last) <= 0 {
+		return nil, nil
+	}
+	if lastTag == "" {
+		logger.Info("Found the first release, pull requests are opened for the releases after it", "tag", newest.info.Tag)
+		return nil, e.rememberTag(watch, newest.info.Tag)
+	}
+
+	baseSHA, err := e.tagCommit(ctx, watch.SourceRepoName, lastTag)
+	if pullrequest.IsNotFound(err) {
+		logger.Warn("The previous release no longer exists, pull requests are opened for the releases after the newest one",
+			"last_tag", lastTag, "tag", newest.info.Tag)
+		return nil, e.rememberTag(watch, newest.info.Tag)
+	} else if err != nil {
+		return nil, fmt.Errorf("could not find the commit of %s: %w", lastTag, err)
+	}
+	headSHA, err := e.tagCommit(ctx, watch.SourceRepoName, newest.info.Tag)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the commit of %s: %w", newest.info.Tag, err)
+	}
+	commits, err := e.releaseCommits(ctx, watch, baseSHA, headSHA)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		logger.Info("The new release does not change the watched path", "tag", newest.info.Tag, "last_tag", lastTag)
+		return nil, e.rememberTag(watch, newest.info.Tag)
+	}
+
+	data := e.creator.TemplateDataBetween(ctx, watch, commits, baseSHA, headSHA)
+	newest.info.PreviousTag = lastTag
+	data.Release = &newest.info
+	return data, nil
+}
+
+// rememberTag records the newest release or tag of a watch that no pull request is opened for
+func (e *Engine) rememberTag(watch config.RepoConfig, tag string) error {
+	return e.state.UpdateWatch(watch.Key(), func(ws *state.WatchState) {
+		ws.LastTag = tag
+	})
+}
+
+// listReleases returns the releases or tags of the source repository that match the watch, newest version first.
+// Draft releases are skipped, and so are pre-releases, unless the watch allows them.
+func (e *Engine) listReleases(ctx context.Context, watch config.RepoConfig) ([]release, error) {
+	owner, repo := config.SplitRepoName(watch.SourceRepoName)
+	var releases []release
+	add := func(info pullrequest.ReleaseInfo) {
+		if version, ok := watch.MatchTag(info.Tag); ok {
+			releases = append(releases, release{info: info, version: version})
+		}
+	}
+	opts := &github.ListOptions{PerPage: 100}
+	for page := 0; page < maxReleasePages; page++ {
+		var resp *github.Response
+		if watch.Trigger == config.TriggerTags {
+			tags, r, err := e.githubClient.Repositories.ListTags(ctx, owner, repo, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, tag := range tags {
+				add(pullrequest.ReleaseInfo{
+					Tag:  tag.GetName(),
+					Name: tag.GetName(),
+					URL:  fmt.Sprintf("https://github.com/%s/releases/tag/%s", watch.SourceRepoName, tag.GetName()),
+				})
+			}
+			resp = r
+		} else {
+			rels, r, err := e.githubClient.Repositories.ListReleases(ctx, owner, repo, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, rel := range rels {
+				if rel.GetDraft() || (rel.GetPrerelease() && !watch.Prereleases) {
+					continue
+				}
+				name := rel.GetName()
+				if name == "" {
+					name = rel.GetTagName()
+				}
+				add(pullrequest.ReleaseInfo{Tag: rel.GetTagName(), Name: name, URL: rel.GetHTMLURL(), Prerelease: rel.GetPrerelease()})
+			}
+			resp = r
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	slices.SortStableFunc(releases, func(a, b release) int {
+		return b.version.Compare(a.version)
+	})
+	return releases, nil
+}
+
+// tagCommit returns the SHA of the commit that a tag points to
+func (e *Engine) tagCommit(ctx context.Context, repoName, tag string) (string, error) {
+	owner, repo := config.SplitRepoName(repoName)
+	ref, _, err := e.githubClient.Git.GetRef(ctx, owner, repo, "tags/"+tag)
+	if err != nil {
+		return "", err
+	}
+	// An annotated tag points to a tag object, which points to the commit
+	object := ref.GetObject()
+	for object.GetType() == "tag" {
+		annotated, _, err := e.githubClient.Git.GetTag(ctx, owner, repo, object.GetSHA())
+		if err != nil {
+			return "", err
+		}
+		object = annotated.GetObject()
+	}
+	return object.GetSHA(), nil
+}
+
+// releaseCommits returns the commits from base to head that changed the watched path, newest first
+func (e *Engine) releaseCommits(ctx context.Context, watch config.RepoConfig, baseSHA, headSHA string) ([]*github.RepositoryCommit, error) {
+	owner, repo := config.SplitRepoName(watch.SourceRepoName)
+
+	// The commits of the release, and the date of the previous release, which the commits are listed since
+	inRelease := make(map[string]bool)
+	var since time.Time
+	compareOpts := &github.ListOptions{PerPage: 100}
+	for {
+		comparison, resp, err := e.githubClient.Repositories.CompareCommits(ctx, owner, repo, baseSHA, headSHA, compareOpts)
+		if err != nil {
+			return nil, err
+		}
+		since = comparison.GetBaseCommit().GetCommit().GetCommitter().GetDate().Time
+		for _, commit := range comparison.Commits {
+			inRelease[commit.GetSHA()] = true
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		compareOpts.Page = resp.NextPage
+	}
+
+	opts := &github.CommitsListOptions{
+		SHA:         headSHA,
+		Path:        watch.WatchedPath(),
+		Since:       since,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	var commits []*github.RepositoryCommit
+	for {
+		page, resp, err := e.githubClient.Repositories.ListCommits(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, commit := range page {
+			if inRelease[commit.GetSHA()] {
+				commits = append(commits, commit)
+			}
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return commits, nil
+}
@@ -0,0 +1,93 @@
+package vigilant
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+)
+
+func TestReleaseTrigger(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Trigger = config.TriggerReleases
+		c.Repos[0].TagPattern = "v*"
+		c.Repos[0].Versions = ">= 1.0"
+	})
+	lastTag := func() string {
+		return e.engine.state.Watch(e.engine.repoConfigs[0].Key()).LastTag
+	}
+
+	// The first release is only remembered
+	e.source.AddRelease(githubfake.Release{Tag: "v1.0.0", Name: "Version 1.0.0"}, "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 0 || lastTag() != "v1.0.0" {
+		t.Fatalf("expected no pull request, and v1.0.0 to be remembered, got %d and %q", n, lastTag())
+	}
+
+	// Commits alone, pre-releases and drafts do not open pull requests
+	e.upstreamCommit("Return 0 from main", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.upstreamCommit("Update the README", map[string]string{"README": "A tool\n"})
+	e.check()
+	e.source.AddRelease(githubfake.Release{Tag: "v1.1.0-rc.1", Prerelease: true}, "main")
+	e.source.AddRelease(githubfake.Release{Tag: "v1.1.1", Draft: true}, "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull requests before the release, got %d", n)
+	}
+
+	e.source.AddRelease(githubfake.Release{Tag: "v1.1.0", Name: "Version 1.1.0"}, "main")
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request for the release, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Title != "Update: Changes in src/main.c in v1.1.0" || pr.Head != "src-main.c-update-v1.1.0" {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+	if !strings.Contains(pr.Body, "in [Version 1.1.0](") || !strings.Contains(pr.Body, "since v1.0.0") {
+		t.Errorf("expected the release in the body:\n%s", pr.Body)
+	}
+	if !strings.Contains(pr.Body, "Return 0 from main") || strings.Contains(pr.Body, "Update the README") {
+		t.Errorf("expected only the commits that change the watched path in the body:\n%s", pr.Body)
+	}
+	if lastTag() != "v1.1.0" {
+		t.Errorf("expected v1.1.0 to be remembered, got %q", lastTag())
+	}
+
+	// A release that does not change the watched path, and an older release, are skipped
+	e.upstreamCommit("Update the README again", map[string]string{"README": "A small tool\n"})
+	e.source.AddRelease(githubfake.Release{Tag: "v1.2.0"}, "main")
+	e.check()
+	e.source.AddRelease(githubfake.Release{Tag: "v1.0.1"}, "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 1 || lastTag() != "v1.2.0" {
+		t.Errorf("expected still 1 pull request, and v1.2.0 to be remembered, got %d and %q", n, lastTag())
+	}
+}
+
+func TestTagTrigger(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Trigger = config.TriggerTags
+		c.Repos[0].TagPattern = "tool-*"
+		c.Repos[0].Versions = "< 2"
+	})
+	e.source.Tag("tool-1.0", "main")
+	e.check()
+
+	e.upstreamCommit("Return 0 from main", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.source.Tag("tool-2.0", "main")
+	e.source.Tag("other-1.5", "main")
+	e.check()
+	if n := len(e.pullRequests()); n != 0 {
+		t.Fatalf("expected no pull requests for tags that do not match, got %d", n)
+	}
+
+	e.source.Tag("tool-1.1", "main")
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 || prs[0].Title != "Update: Changes in src/main.c in tool-1.1" {
+		t.Fatalf("expected 1 pull request for tool-1.1, got %+v", prs)
+	}
+}
@@ -0,0 +1,317 @@
+package vigilant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/systemd"
+)
+
+// gcJob is the job number of the branch cleanup, which is scheduled like a watch.
+// The other jobs are the groups of watches, which are checked together.
+const gcJob = -1
+
+// jobSet keeps track of the jobs that are queued or running, so that a job never runs concurrently with itself
+type jobSet struct {
+	mu      sync.Mutex
+	busy    map[int]bool
+	running bool // jobs are only queued while Run is running, since nothing else takes them from the queue
+}
+
+// acquire marks a job as busy. Returns false if it already was.
+func (js *jobSet) acquire(job int) bool {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if js.busy[job] {
+		return false
+	}
+	if js.busy == nil {
+		js.busy = make(map[int]bool)
+	}
+	js.busy[job] = true
+	return true
+}
+
+// release marks a job as no longer busy
+func (js *jobSet) release(job int) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	delete(js.busy, job)
+}
+
+// enqueue marks a job as busy and puts it on the queue. Returns false if it already was busy,
+// or if Run is not running.
+func (js *jobSet) enqueue(job int, queue chan<- int) bool {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	if !js.running || js.busy[job] {
+		return false
+	}
+	if js.busy == nil {
+		js.busy = make(map[int]bool)
+	}
+	js.busy[job] = true
+	queue <- job
+	return true
+}
+
+// start lets jobs be queued
+func (js *jobSet) start() {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.running = true
+}
+
+// stop stops jobs from being queued, and releases the jobs that are still on the queue
+func (js *jobSet) stop(queue <-chan int) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	js.running = false
+	for {
+		select {
+		case job := <-queue:
+			delete(js.busy, job)
+		default:
+			return
+		}
+	}
+}
+
+// interval returns how often the given job should run. A group is checked at the shortest poll interval of its watches.
+func (e *Engine) interval(job int) time.Duration {
+	interval := e.pollInterval
+	if job == gcJob {
+		return interval
+	}
+	for i, watch := range e.groupWatches(job) {
+		if poll := time.Duration(watch.PollInterval) * time.Minute; poll > 0 && (i == 0 || poll < interval) {
+			interval = poll
+		}
+	}
+	return interval
+}
+
+// groupWatches returns the watches of the given job
+func (e *Engine) groupWatches(job int) []config.RepoConfig {
+	var watches []config.RepoConfig
+	for _, i := range e.groups[job] {
+		watches = append(watches, e.repoConfigs[i])
+	}
+	return watches
+}
+
+// jobName returns a description of the given job, for use in log messages
+func (e *Engine) jobName(job int) string {
+	if job == gcJob {
+		return "branch cleanup"
+	}
+	watches := e.groupWatches(job)
+	if len(watches) > 1 {
+		return fmt.Sprintf("check of the %s group in %s", watches[0].Group, watches[0].TargetRepoName)
+	}
+	return fmt.Sprintf("check of %s in %s", watches[0].FilePath, watches[0].SourceRepoName)
+}
+
+// enqueue queues a job for the worker pool, unless it is already queued or running, or Run is not running.
+// The queue has room for every job, so this never blocks.
+func (e *Engine) enqueue(job int) bool {
+	return e.jobs.enqueue(job, e.queue)
+}
+
+// runJob checks a group of watches, or cleans up branches, and then marks the job as done
+func (e *Engine) runJob(ctx context.Context, job int) watchResult {
+	defer e.jobs.release(job)
+	if job == gcJob {
+		e.CollectGarbage(ctx, false)
+		return resultUpToDate
+	}
+	e.status.start()
+	result := e.checkGroup(ctx, e.groupWatches(job))
+	e.status.finish(e.groups[job], result, e.now())
+	e.notify(systemd.Status(e.status.String()))
+	return result
+}
+
+// Run schedules every watch independently, at its poll interval, and checks them on a bounded pool of workers,
+// until ctx is cancelled. Then no new jobs are started, and the running jobs get until the shutdown timeout
+// to finish before they are cancelled too. With leader election, the watches are only scheduled while
+// this instance is the leader, and the running jobs are cancelled right away when it loses the lease.
+func (e *Engine) Run(ctx context.Context) {
+	if e.lease != nil {
+		e.runElected(ctx)
+		return
+	}
+	e.schedule(ctx)
+}
+
+// schedule runs the jobs at their intervals until ctx is cancelled. The running jobs are cancelled right away
+// if ctx is cancelled with errLostLease, and otherwise after the shutdown timeout.
+func (e *Engine) schedule(ctx context.Context) {
+	e.logger.Info("Starting server", "workers", e.workers)
+	e.jobs.start()
+	defer e.jobs.stop(e.queue)
+
+	// The jobs run with a context that is only cancelled when the shutdown timeout is over, or the lease is lost
+	workCtx, cancelWork := context.WithCancelCause(context.Background())
+	defer cancelWork(nil)
+
+	var wg sync.WaitGroup
+	for w := 0; w < e.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case job := <-e.queue:
+					if ctx.Err() != nil {
+						e.jobs.release(job)
+						return
+					}
+					e.runJob(workCtx, job)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	// Roll back the unfinished pull requests of watches that have been removed from the configuration
+	e.creator.AbandonOrphaned()
+
+	// The first check of each job is one interval after startup, unless it has an unfinished pull request
+	now := time.Now()
+	next := make(map[int]time.Time, len(e.groups)+1)
+	next[gcJob] = now.Add(e.interval(gcJob))
+	for job := range e.groups {
+		next[job] = now.Add(e.interval(job))
+		watch := e.repoConfigs[e.groups[job][0]]
+		if _, ok := e.state.OperationFor(watch.GroupKey()); ok {
+			e.watchLogger(watch).Info("Resuming the unfinished pull request")
+			e.enqueue(job)
+		}
+	}
+
+	timer := time.NewTimer(time.Until(earliest(next)))
+	defer timer.Stop()
+
+	// Ping the systemd watchdog from the scheduler loop, at half the interval that systemd expects
+	var watchdog <-chan time.Time
+	if interval, ok := systemd.WatchdogInterval(); ok {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		watchdog = ticker.C
+	}
+	e.notifyReady()
+
+	for {
+		select {
+		case <-watchdog:
+			e.notify(systemd.Watchdog)
+		case <-timer.C:
+			now := time.Now()
+			for job, due := range next {
+				if now.Before(due) {
+					continue
+				}
+				if !e.enqueue(job) {
+					e.logger.Warn("Skipping scheduled job, since it is still queued or running", "job", e.jobName(job))
+				}
+				next[job] = now.Add(e.interval(job))
+			}
+			timer.Reset(time.Until(earliest(next)))
+		case <-ctx.Done():
+			if errors.Is(context.Cause(ctx), errLostLease) {
+				// Another instance may already be checking, so the running jobs are cancelled right away
+				e.logger.Info("Stopping the checks, since this instance is no longer the leader")
+				cancelWork(errLostLease)
+			} else {
+				e.logger.Info("Shutting down server")
+				e.notify(systemd.Stopping + "\n" + systemd.Status("Shutting down"))
+			}
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(e.shutdownTimeout):
+				e.logger.Warn("Jobs are still running after the shutdown timeout, cancelling them", "timeout", e.shutdownTimeout)
+				cancelWork(nil)
+				<-done
+			}
+			e.logger.Info("Server stopped")
+			return
+		}
+	}
+}
+
+// earliest returns the earliest of the given times
+func earliest(times map[int]time.Time) time.Time {
+	var first time.Time
+	for _, t := range times {
+		if first.IsZero() || t.Before(first) {
+			first = t
+		}
+	}
+	return first
+}
+
+// TriggerCheck queues a check of all watches that are not already queued or running.
+// It only has an effect while Run is running.
+func (e *Engine) TriggerCheck() {
+	e.triggerWatches(func(config.RepoConfig) bool { return true })
+}
+
+// triggerWatches queues a check of the groups with a watch that matches, unless they are already queued or running.
+// Returns the number of checks that were queued.
+func (e *Engine) triggerWatches(match func(config.RepoConfig) bool) int {
+	n := 0
+	for job := range e.groups {
+		if slices.ContainsFunc(e.groupWatches(job), match) && e.enqueue(job) {
+			n++
+		}
+	}
+	return n
+}
+
+// CheckOnce checks all watches once, with at most the configured number of workers running at the same time,
+// and then cleans up branches. Watches that are already being checked by Run are skipped.
+// Returns an error if any of the checks failed, which has been logged.
+func (e *Engine) CheckOnce(ctx context.Context) error {
+	e.logger.Info("Checking repositories for updates")
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Int32
+	)
+	sem := make(chan struct{}, e.workers)
+	for i := range e.groups {
+		if !e.jobs.acquire(i) {
+			e.logger.Warn("Skipping job, since it is already queued or running", "job", e.jobName(i))
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if e.runJob(ctx, i) == resultFailed {
+				failed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if e.jobs.acquire(gcJob) {
+		e.runJob(ctx, gcJob)
+	}
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("%d of %d checks failed", n, len(e.groups))
+	}
+	return nil
+}
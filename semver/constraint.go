@@ -0,0 +1,107 @@
+package semver
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constraint is a set of alternatives separated by ||, which are comparisons separated by commas,
+// like ">= 9.1, < 10 || 11.0.2". A version satisfies the constraint if it satisfies all comparisons
+// of one of the alternatives. The operators are =, !=, >, >=, <, <=, ~ and ^, where ~1.2.3 allows
+// newer patch versions, and ^1.2.3 allows newer minor versions, or newer patch versions for 0.x.
+type Constraint struct {
+	text         string
+	alternatives [][]comparison
+}
+
+// comparison is a single comparison with a version
+type comparison struct {
+	op      string
+	version Version
+}
+
+// operators are the comparison operators, with the longer operators first
+var operators = []string{">=", "<=", "!=", ">", "<", "=", "~", "^"}
+
+// ParseConstraint parses a constraint. An empty constraint is satisfied by every version.
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{text: s}
+	if strings.TrimSpace(s) == "" {
+		return c, nil
+	}
+	for _, alternative := range strings.Split(s, "||") {
+		var comparisons []comparison
+		for _, part := range strings.Split(alternative, ",") {
+			part = strings.TrimSpace(part)
+			op := "="
+			for _, o := range operators {
+				if rest, ok := strings.CutPrefix(part, o); ok {
+					op, part = o, strings.TrimSpace(rest)
+					break
+				}
+			}
+			if part == "" {
+				return Constraint{}, fmt.Errorf("invalid version constraint %q, a comparison has no version", s)
+			}
+			v, err := Parse(part)
+			if err != nil {
+				return Constraint{}, fmt.Errorf("invalid version constraint %q: %w", s, err)
+			}
+			comparisons = append(comparisons, comparison{op: op, version: v})
+		}
+		c.alternatives = append(c.alternatives, comparisons)
+	}
+	return c, nil
+}
+
+// String returns the constraint as it was parsed
+func (c Constraint) String() string {
+	return c.text
+}
+
+// Check checks if the version satisfies the constraint
+func (c Constraint) Check(v Version) bool {
+	if len(c.alternatives) == 0 {
+		return true
+	}
+	for _, comparisons := range c.alternatives {
+		ok := true
+		for _, cmp := range comparisons {
+			if !cmp.check(v) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks if the version satisfies a single comparison
+func (cmp comparison) check(v Version) bool {
+	c := v.Compare(cmp.version)
+	switch cmp.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case "~":
+		return c >= 0 && v.Major == cmp.version.Major && v.Minor == cmp.version.Minor
+	case "^":
+		if cmp.version.Major == 0 {
+			return c >= 0 && v.Major == 0 && v.Minor == cmp.version.Minor
+		}
+		return c >= 0 && v.Major == cmp.version.Major
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+// Package semver parses the versions in release tags, and checks them against constraints like ">= 9.1, < 10".
+// It is lenient, since upstream projects tag their releases in many ways: a leading v is allowed,
+// the minor and patch versions may be left out, and numbers may have leading zeros, like v9.1.0123.
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version
+type Version struct {
+	Major, Minor, Patch int
+	Prerelease          []string // the dot separated identifiers after the -, like rc and 1 for -rc.1
+	Original            string   // the version as it was parsed
+}
+
+// Parse parses a version like v1.2.3, 1.2.3-rc.1+build.5, 9.1.0123 or 2
+func Parse(s string) (Version, error) {
+	v := Version{Original: s}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	rest, _, _ = strings.Cut(rest, "+")
+	core, pre, hasPre := strings.Cut(rest, "-")
+	if hasPre {
+		if pre == "" {
+			return Version{}, fmt.Errorf("invalid version %q, the pre-release is empty", s)
+		}
+		v.Prerelease = strings.Split(pre, ".")
+	}
+	parts := strings.Split(core, ".")
+	if len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q, must have at most three numbers", s)
+	}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid version %q, %q is not a number", s, part)
+		}
+		*numbers[i] = n
+	}
+	return v, nil
+}
+
+// String returns the version as it was parsed
+func (v Version) String() string {
+	if v.Original != "" {
+		return v.Original
+	}
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Prerelease) > 0 {
+		s += "-" + strings.Join(v.Prerelease, ".")
+	}
+	return s
+}
+
+// IsPrerelease checks if the version has a pre-release, like 1.0.0-rc.1
+func (v Version) IsPrerelease() bool {
+	return len(v.Prerelease) > 0
+}
+
+// Compare returns -1, 0 or 1 if v is lower than, equal to or higher than w.
+// A pre-release is lower than the release, and build metadata is ignored.
+func (v Version) Compare(w Version) int {
+	for _, c := range [][2]int{{v.Major, w.Major}, {v.Minor, w.Minor}, {v.Patch, w.Patch}} {
+		if c[0] != c[1] {
+			return compareInts(c[0], c[1])
+		}
+	}
+	switch {
+	case len(v.Prerelease) == 0 && len(w.Prerelease) == 0:
+		return 0
+	case len(v.Prerelease) == 0:
+		return 1
+	case len(w.Prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(w.Prerelease); i++ {
+		if c := compareIdentifiers(v.Prerelease[i], w.Prerelease[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(v.Prerelease), len(w.Prerelease))
+}
+
+// compareIdentifiers compares two pre-release identifiers, where numbers are lower than other identifiers
+func compareIdentifiers(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
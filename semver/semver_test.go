@@ -0,0 +1,65 @@
+package semver
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	// Every version is lower than the next one
+	ordered := []string{"0.9", "v1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "v1.2", "9.1.0099", "9.1.0123", "10"}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, err := Parse(ordered[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := Parse(ordered[i+1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Compare(b) != -1 || b.Compare(a) != 1 || a.Compare(a) != 0 {
+			t.Errorf("expected %s < %s", a, b)
+		}
+	}
+	if a, _ := Parse("1.2.3+build.5"); a.Compare(Version{Major: 1, Minor: 2, Patch: 3}) != 0 {
+		t.Error("build metadata should be ignored")
+	}
+	for _, s := range []string{"", "v", "1.2.3.4", "1.x", "release-1.2", "1.0-"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) should fail", s)
+		}
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		match      []string
+		noMatch    []string
+	}{
+		{"", []string{"1.0", "0.0.1-rc.1"}, nil},
+		{">= 9.1, < 10", []string{"9.1", "v9.1.0123", "9.9.9"}, []string{"9.0.999", "10.0.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0"}},
+		{"^1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.9", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "1.2.3"}},
+		{"1.0 || >=2, !=2.1", []string{"1.0.0", "2.0.0", "2.2"}, []string{"1.1", "2.1"}},
+	}
+	for _, test := range tests {
+		c, err := ParseConstraint(test.constraint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range test.match {
+			if v, _ := Parse(s); !c.Check(v) {
+				t.Errorf("%s should satisfy %q", s, test.constraint)
+			}
+		}
+		for _, s := range test.noMatch {
+			if v, _ := Parse(s); c.Check(v) {
+				t.Errorf("%s should not satisfy %q", s, test.constraint)
+			}
+		}
+	}
+	for _, s := range []string{">=", "1.0,", ">= one", "1.0 ||"} {
+		if _, err := ParseConstraint(s); err == nil {
+			t.Errorf("ParseConstraint(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package state
+
+import "time"
+
+// The steps of creating a pull request. An operation is saved to the outbox after every step,
+// so that it can be resumed from where it stopped after a crash or a failed API call.
+const (
+	StepPrepared           = "prepared"             // the text and file changes have been rendered
+	StepCommitted          = "committed"            // the commit has been created
+	StepBranchCreated      = "branch_created"       // the branch points to the commit
+	StepPullRequestCreated = "pull_request_created" // the pull request has been opened
+)
+
+// FileChange is a change to a single path in a commit
+type FileChange struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content,omitempty"` // the new file contents, if not nil
+	SHA     string `json:"sha,omitempty"`     // the SHA of an existing object, used if Content is nil
+	Mode    string `json:"mode,omitempty"`    // defaults to "100644", and "160000" is a submodule that points to the commit SHA
+	Delete  bool   `json:"delete,omitempty"`  // remove the path instead
+}
+
+// Member is a watch that is part of a combined pull request, and the upstream commit it is updated to
+type Member struct {
+	Watch       string `json:"watch"`
+	UpstreamSHA string `json:"upstream_sha"`
+	Tag         string `json:"tag,omitempty"` // the release or tag, for watches of releases or tags
+}
+
+// Operation is a pull request that is being created, as saved in the outbox
+type Operation struct {
+	ID            string       `json:"id"`
+	Watch         string       `json:"watch"`    // the key of the watch, or of the group of a combined pull request
+	Step          string       `json:"step"`     // the last step that was completed
+	Attempts      int          `json:"attempts"` // the number of failed attempts so far
+	LastError     string       `json:"last_error,omitempty"`
+	UpstreamSHA   string       `json:"upstream_sha"`      // the newest upstream commit, or a hash of those of the members
+	Members       []Member     `json:"members,omitempty"` // the watches of a combined pull request
+	Tag           string       `json:"tag,omitempty"`     // the release or tag, for watches of releases or tags
+	Repo          string       `json:"repo"`              // the target repository, as owner/name
+	HeadRepo      string       `json:"head_repo"`         // the repository that the branch is pushed to
+	Base          string       `json:"base"`              // the base branch
+	Branch        string       `json:"branch"`            // the pull request branch
+	Title         string       `json:"title"`
+	Body          string       `json:"body"`
+	CommitMessage string       `json:"commit_message"`
+	Changes       []FileChange `json:"changes"`
+	CommitSHA     string       `json:"commit_sha,omitempty"`
+	Number        int          `json:"number,omitempty"`
+	URL           string       `json:"url,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+}
+
+// Record returns the pull request record that keeps track of the branch of the operation
+func (op *Operation) Record() PullRequestRecord {
+	return PullRequestRecord{
+		Watch:     op.Watch,
+		Repo:      op.Repo,
+		HeadRepo:  op.HeadRepo,
+		Branch:    op.Branch,
+		Number:    op.Number,
+		URL:       op.URL,
+		CreatedAt: op.CreatedAt,
+	}
+}
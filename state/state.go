@@ -0,0 +1,237 @@
+// Package state keeps track of what vigilant has done, in a JSON file that survives restarts:
+// the last synced commit of every watch, the branches and pull requests it created,
+// and the outbox of pull requests that are being created.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// PullRequestRecord is a branch, and possibly a pull request, that vigilant has created
+type PullRequestRecord struct {
+	Watch     string    `json:"watch"`               // the key of the watch that created it
+	Repo      string    `json:"repo"`                // the repository of the pull request, as owner/name
+	HeadRepo  string    `json:"head_repo,omitempty"` // the repository that the branch is in, if it is a fork
+	Branch    string    `json:"branch"`              // the name of the branch
+	Number    int       `json:"number,omitempty"`    // the pull request number, or 0 if no pull request was created
+	URL       string    `json:"url,omitempty"`       // the pull request URL
+	CreatedAt time.Time `json:"created_at"`          // when the branch was created
+	ClosedAt  time.Time `json:"closed_at,omitempty"` // when the pull request was merged or closed
+}
+
+// BranchRepo returns the repository that the branch is in, as owner/name
+func (r PullRequestRecord) BranchRepo() string {
+	if r.HeadRepo != "" {
+		return r.HeadRepo
+	}
+	return r.Repo
+}
+
+// WatchState is what vigilant remembers about a single watch
+type WatchState struct {
+	LastSHA     string    `json:"last_sha,omitempty"`     // the newest upstream commit that a pull request was created for
+	LastChecked time.Time `json:"last_checked,omitempty"` // when the last pull request was created, commits are looked for after this
+	LastTag     string    `json:"last_tag,omitempty"`     // the newest release or tag that was seen, for watches of releases or tags
+	// AbandonedSHA is the upstream commit of a pull request that was given up on after too many failed attempts,
+	// which is not tried again until there is a newer upstream commit
+	AbandonedSHA string `json:"abandoned_sha,omitempty"`
+}
+
+// State is the data that vigilant keeps between runs, in addition to since.timestamp,
+// which is only used for watches that have not created a pull request yet
+type State struct {
+	Watches      map[string]WatchState `json:"watches,omitempty"`
+	PullRequests []PullRequestRecord   `json:"pull_requests"`
+	Outbox       []Operation           `json:"outbox,omitempty"`
+}
+
+// ErrFenced is returned when a fenced store is modified
+var ErrFenced = errors.New("the state can not be changed, since another instance may have taken it over")
+
+// Store is a State that is saved as JSON to a file whenever it is modified
+type Store struct {
+	mu     sync.Mutex
+	path   string
+	state  State
+	fenced bool // see Fence
+}
+
+// Open reads the state from the given path. A missing file gives an empty state.
+func Open(path string) (*Store, error) {
+	store := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.state); err != nil {
+		return nil, fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return store, nil
+}
+
+// Reload reads the state from the file again, after another process has changed it
+func (st *Store) Reload() error {
+	reloaded, err := Open(st.path)
+	if err != nil {
+		return err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.state = reloaded.state
+	st.fenced = false
+	return nil
+}
+
+// Fence stops the file from being written, so that every following change fails with ErrFenced, until the state is
+// reloaded. It is used when this instance is no longer the leader, since another instance may be writing the file.
+func (st *Store) Fence() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.fenced = true
+}
+
+// save writes the state to disk. The caller must hold the lock.
+func (st *Store) save() error {
+	if st.fenced {
+		return ErrFenced
+	}
+	data, err := json.MarshalIndent(&st.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that a crash never leaves a truncated state file behind
+	tmp, err := os.CreateTemp(filepath.Dir(st.path), filepath.Base(st.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), st.path)
+}
+
+// Watch returns the state of the watch with the given key
+func (st *Store) Watch(key string) WatchState {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.state.Watches[key]
+}
+
+// UpdateWatch modifies the state of the watch with the given key, and saves the state
+func (st *Store) UpdateWatch(key string, update func(ws *WatchState)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.state.Watches == nil {
+		st.state.Watches = make(map[string]WatchState)
+	}
+	ws := st.state.Watches[key]
+	update(&ws)
+	st.state.Watches[key] = ws
+	return st.save()
+}
+
+// PullRequests returns a copy of all pull request records
+func (st *Store) PullRequests() []PullRequestRecord {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]PullRequestRecord(nil), st.state.PullRequests...)
+}
+
+// AddPullRequest adds a record, or replaces the record with the same repository and branch
+func (st *Store) AddPullRequest(record PullRequestRecord) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, r := range st.state.PullRequests {
+		if r.Repo == record.Repo && r.Branch == record.Branch {
+			st.state.PullRequests[i] = record
+			return st.save()
+		}
+	}
+	st.state.PullRequests = append(st.state.PullRequests, record)
+	return st.save()
+}
+
+// UpdatePullRequest replaces the record with the same repository and branch
+func (st *Store) UpdatePullRequest(record PullRequestRecord) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, r := range st.state.PullRequests {
+		if r.Repo == record.Repo && r.Branch == record.Branch {
+			st.state.PullRequests[i] = record
+			return st.save()
+		}
+	}
+	return fmt.Errorf("no record of branch %s in %s", record.Branch, record.Repo)
+}
+
+// RemovePullRequest removes the record with the given repository and branch
+func (st *Store) RemovePullRequest(repo, branch string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, r := range st.state.PullRequests {
+		if r.Repo == repo && r.Branch == branch {
+			st.state.PullRequests = append(st.state.PullRequests[:i], st.state.PullRequests[i+1:]...)
+			return st.save()
+		}
+	}
+	return nil
+}
+
+// Operations returns a copy of all operations in the outbox
+func (st *Store) Operations() []Operation {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]Operation(nil), st.state.Outbox...)
+}
+
+// OperationFor returns the unfinished operation of the watch with the given key, if there is one
+func (st *Store) OperationFor(watch string) (Operation, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, op := range st.state.Outbox {
+		if op.Watch == watch {
+			return op, true
+		}
+	}
+	return Operation{}, false
+}
+
+// SaveOperation adds an operation to the outbox, or replaces the operation with the same ID
+func (st *Store) SaveOperation(op Operation) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, o := range st.state.Outbox {
+		if o.ID == op.ID {
+			st.state.Outbox[i] = op
+			return st.save()
+		}
+	}
+	st.state.Outbox = append(st.state.Outbox, op)
+	return st.save()
+}
+
+// RemoveOperation removes the operation with the given ID from the outbox
+func (st *Store) RemoveOperation(id string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for i, o := range st.state.Outbox {
+		if o.ID == id {
+			st.state.Outbox = append(st.state.Outbox[:i], st.state.Outbox[i+1:]...)
+			return st.save()
+		}
+	}
+	return nil
+}
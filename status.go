@@ -0,0 +1,130 @@
+package vigilant
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xyproto/vigilant/systemd"
+)
+
+// watchResult is the outcome of a check of a watch
+type watchResult int
+
+const (
+	resultUpToDate watchResult = iota + 1
+	resultCreated
+	resultFailed
+	resultSkipped // the newest upstream commit was given up on, until there is a newer one
+)
+
+func (r watchResult) String() string {
+	switch r {
+	case resultUpToDate:
+		return "up to date"
+	case resultCreated:
+		return "pull request created"
+	case resultFailed:
+		return "failed"
+	case resultSkipped:
+		return "skipped"
+	}
+	return "not checked yet"
+}
+
+// engineStatus keeps track of the checks, for systemd and the status endpoint
+type engineStatus struct {
+	mu        sync.Mutex
+	leader    string // the instance that holds the lease, if it is not this one
+	running   int
+	lastCheck time.Time
+	results   map[int]watchResult // the result of the last check of each watch
+}
+
+// start records that a check has started
+func (s *engineStatus) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running++
+}
+
+// finish records the result of a check of the given watches
+func (s *engineStatus) finish(watches []int, result watchResult, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	s.lastCheck = now
+	if s.results == nil {
+		s.results = make(map[int]watchResult)
+	}
+	for _, watch := range watches {
+		s.results[watch] = result
+	}
+}
+
+// setLeader records which other instance is the leader, or that this instance is, if leader is empty
+func (s *engineStatus) setLeader(leader string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leader = leader
+}
+
+// result returns the result of the last check of the given watch, or 0 if it has not been checked
+func (s *engineStatus) result(watch int) watchResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.results[watch]
+}
+
+// String summarizes the last checks, like "Last check at 2024-03-01 12:02 UTC: 2 up to date, 1 failed"
+func (s *engineStatus) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.leader != "" {
+		return fmt.Sprintf("Standby, %s is the leader", s.leader)
+	}
+	if s.lastCheck.IsZero() {
+		if s.running > 0 {
+			return fmt.Sprintf("Running the first checks (%d)", s.running)
+		}
+		return "Waiting for the first check"
+	}
+	counts := make(map[watchResult]int)
+	for _, result := range s.results {
+		counts[result]++
+	}
+	var parts []string
+	for _, c := range []struct {
+		result watchResult
+		label  string
+	}{
+		{resultUpToDate, "up to date"},
+		{resultCreated, "with a new pull request"},
+		{resultFailed, "failed"},
+		{resultSkipped, "skipped"},
+	} {
+		if counts[c.result] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[c.result], c.label))
+		}
+	}
+	text := fmt.Sprintf("Last check at %s: %s", s.lastCheck.UTC().Format("2006-01-02 15:04 MST"), strings.Join(parts, ", "))
+	if s.running > 0 {
+		text += fmt.Sprintf("; %d running", s.running)
+	}
+	return text
+}
+
+// notifyReady tells systemd that vigilant has started, the first time it is called
+func (e *Engine) notifyReady() {
+	e.ready.Do(func() {
+		e.notify(systemd.Ready + "\n" + systemd.Status(e.status.String()))
+	})
+}
+
+// notify sends a notification to systemd, if vigilant runs as a systemd service
+func (e *Engine) notify(state string) {
+	if _, err := systemd.Notify(state); err != nil {
+		e.logger.Warn("Could not notify systemd", "error", err)
+	}
+}
@@ -0,0 +1,22 @@
+package vigilant
+
+import (
+	"context"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// submoduleChanges replaces the commits in the data of a watch that updates a submodule with the commits that
+// changed the watched path since the commit that the submodule in the target points to
+func (e *Engine) submoduleChanges(ctx context.Context, watch config.RepoConfig, data *pullrequest.TemplateData) (*pullrequest.TemplateData, error) {
+	old, err := e.creator.SubmoduleCommit(ctx, watch)
+	if err != nil {
+		return nil, err
+	}
+	previous := old
+	if len(previous) > 7 {
+		previous = previous[:7]
+	}
+	return e.changesSince(ctx, watch, data, old, previous)
+}
@@ -0,0 +1,58 @@
+package vigilant
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+)
+
+func TestSubmoduleMode(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Mode = config.ModeSubmodule
+		c.Repos[0].TargetPath = "vendor/tool"
+	})
+	initial, _ := e.source.Branch("main")
+	e.target.Commit("main", githubfake.Commit{
+		Message:    "Add the tool as a submodule",
+		Files:      map[string]string{".gitmodules": "[submodule \"vendor/tool\"]\n\tpath = vendor/tool\n\turl = https://github.com/upstream/tool\n"},
+		Submodules: map[string]string{"vendor/tool": initial},
+	})
+
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+	head := e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.upstreamCommit("Update the README", map[string]string{"README": "A tool\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	pr := prs[1]
+	if pr.Title != "Update upstream/tool to "+head[:7] {
+		t.Errorf("unexpected title %q", pr.Title)
+	}
+	if sha, ok := e.target.Submodule(pr.Head, "vendor/tool"); !ok || sha != head {
+		t.Errorf("expected the submodule to point to %s, got %q", head, sha)
+	}
+	// The submodule still points to the initial commit, so the commits since then are listed
+	for _, want := range []string{"updates upstream/tool in `vendor/tool` from " + initial[:7] + " to " + head[:7], "Return 0", "Return 2"} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+	if _, ok := e.target.File(pr.Head, "src-main.c-updates.md"); ok {
+		t.Error("expected no notification file")
+	}
+
+	// A submodule that was moved past the new commit by hand is not moved back
+	e.upstreamCommit("Return 3", map[string]string{"src/main.c": "int main(void) { return 3; }\n"})
+	newest := e.upstreamCommit("Update the README again", map[string]string{"README": "The tool\n"})
+	e.target.Commit("main", githubfake.Commit{Message: "Update the tool", Submodules: map[string]string{"vendor/tool": newest}})
+	e.check()
+	if n := len(e.pullRequests()); n != 2 {
+		t.Errorf("expected still 2 pull requests, got %d", n)
+	}
+}
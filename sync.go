@@ -0,0 +1,22 @@
+package vigilant
+
+import (
+	"context"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// syncChanges replaces the commits in the data of a watch that syncs a directory with the commits that
+// changed the watched directory since the commit in the manifest of the target directory, if it has been synced before
+func (e *Engine) syncChanges(ctx context.Context, watch config.RepoConfig, data *pullrequest.TemplateData) (*pullrequest.TemplateData, error) {
+	old, err := e.creator.SyncedCommit(ctx, watch)
+	if err != nil || old == "" {
+		return data, err
+	}
+	previous := old
+	if len(previous) > 7 {
+		previous = previous[:7]
+	}
+	return e.changesSince(ctx, watch, data, old, previous)
+}
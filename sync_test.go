@@ -0,0 +1,191 @@
+package vigilant
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+	"github.com/xyproto/vigilant/pullrequest"
+)
+
+// merge commits the files of a pull request in sync mode to the main branch of the target, like merging it would
+func (e *testEnv) merge(pr githubfake.PullRequest, names []string, deleted []string) {
+	e.t.Helper()
+	files := make(map[string]string)
+	for _, name := range names {
+		content, ok := e.target.File(pr.Head, name)
+		if !ok {
+			e.t.Fatalf("expected %s in the pull request", name)
+		}
+		files[name] = content
+	}
+	e.target.Commit("main", githubfake.Commit{Message: pr.Title, Files: files, Delete: deleted})
+}
+
+func TestSyncMode(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Mode = config.ModeSync
+		c.Repos[0].FilePath = "src/"
+		c.Repos[0].TargetPath = "third_party/tool"
+		c.Repos[0].Exclude = []string{"*.md"}
+	})
+	manifestPath := "third_party/tool/" + pullrequest.ManifestName
+	e.target.Commit("main", githubfake.Commit{
+		Message: "Vendor the tool",
+		Files:   map[string]string{"third_party/tool/old.c": "int old;\n", "third_party/tool/LOCAL.md": "Patched locally\n"},
+	})
+
+	first := e.upstreamCommit("Add util.h", map[string]string{"src/util.h": "int util(void);\n", "src/NOTES.md": "Notes\n"})
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Title != "Update upstream/tool to "+first[:7] {
+		t.Errorf("unexpected title %q", pr.Title)
+	}
+	if want := "updates upstream/tool in `third_party/tool` to " + first[:7]; !strings.Contains(pr.Body, want) {
+		t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+	}
+	if content, _ := e.target.File(pr.Head, "third_party/tool/util.h"); content != "int util(void);\n" {
+		t.Errorf("expected util.h to be added, got %q", content)
+	}
+	if _, ok := e.target.File(pr.Head, "third_party/tool/main.c"); !ok {
+		t.Error("expected main.c to be added")
+	}
+	if _, ok := e.target.File(pr.Head, "third_party/tool/old.c"); !ok {
+		t.Error("expected old.c, which was not synced, to be kept")
+	}
+	if _, ok := e.target.File(pr.Head, "third_party/tool/NOTES.md"); ok {
+		t.Error("expected the excluded NOTES.md to not be synced")
+	}
+	if _, ok := e.target.File(pr.Head, "third_party/tool/LOCAL.md"); !ok {
+		t.Error("expected the excluded LOCAL.md to be kept")
+	}
+	manifest, _ := e.target.File(pr.Head, manifestPath)
+	for _, want := range []string{"commit " + first + "\n", first + " main.c\n", first + " util.h\n"} {
+		if !strings.Contains(manifest, want) {
+			t.Errorf("expected %q in the manifest:\n%s", want, manifest)
+		}
+	}
+	e.merge(pr, []string{"third_party/tool/main.c", "third_party/tool/util.h", manifestPath}, nil)
+
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.upstreamCommit("Update the README", map[string]string{"README": "A tool\n"})
+	e.clock.Advance(time.Minute)
+	head := e.source.Commit("main", githubfake.Commit{Message: "Remove util.h", Delete: []string{"src/util.h"}})
+	e.check()
+
+	prs = e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	pr = prs[1]
+	// The manifest records the commit that was synced, so the commits since then are listed
+	for _, want := range []string{"from " + first[:7] + " to " + head[:7], "Return 2"} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+	if strings.Contains(pr.Body, "Update the README") {
+		t.Errorf("expected only the commits that changed the watched directory:\n%s", pr.Body)
+	}
+	if content, _ := e.target.File(pr.Head, "third_party/tool/main.c"); content != "int main(void) { return 2; }\n" {
+		t.Errorf("expected main.c to be updated, got %q", content)
+	}
+	if _, ok := e.target.File(pr.Head, "third_party/tool/util.h"); ok {
+		t.Error("expected util.h to be deleted")
+	}
+	// Only the files in the manifest are deleted
+	if _, ok := e.target.File(pr.Head, "third_party/tool/old.c"); !ok {
+		t.Error("expected old.c, which was never synced, to be kept")
+	}
+	manifest, _ = e.target.File(pr.Head, manifestPath)
+	if want := "commit " + head + "\n" + head + " main.c\n"; !strings.HasSuffix(manifest, want) {
+		t.Errorf("expected the manifest to end with %q:\n%s", want, manifest)
+	}
+	e.merge(pr, []string{"third_party/tool/main.c", manifestPath}, []string{"third_party/tool/util.h"})
+
+	// A change to only excluded files is nothing to sync
+	e.upstreamCommit("Update the notes", map[string]string{"src/NOTES.md": "Even more notes\n"})
+	e.check()
+	if n := len(e.pullRequests()); n != 2 {
+		t.Errorf("expected still 2 pull requests, got %d", n)
+	}
+}
+
+func TestSyncTransforms(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Mode = config.ModeSync
+		c.Repos[0].FilePath = "src/"
+		c.Repos[0].TargetPath = "third_party/tool"
+		c.Repos[0].Exclude = []string{"*.md"}
+		c.Repos[0].Transforms = []config.TransformConfig{
+			{Type: config.TransformReplace, Files: []string{"*.c"}, Pattern: `return (\d+)`, Replacement: "return EXIT_CODE($1)"},
+			{Type: config.TransformPrepend, Text: "// Synced from {{ .Path }} in {{ .Repo }}"},
+		}
+	})
+	e.upstreamCommit("Add util.h", map[string]string{"src/util.h": "int util(void);\n"})
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if content, _ := e.target.File(pr.Head, "third_party/tool/main.c"); content != "// Synced from src/main.c in upstream/tool\nint main(void)\n{\n    return EXIT_CODE(1);\n}\n" {
+		t.Errorf("unexpected main.c %q", content)
+	}
+	if content, _ := e.target.File(pr.Head, "third_party/tool/util.h"); content != "// Synced from src/util.h in upstream/tool\nint util(void);\n" {
+		t.Errorf("unexpected util.h %q", content)
+	}
+	for _, want := range []string{"* Replaced `return (\\d+)` with `return EXIT_CODE($1)` in `main.c`\n", "* Added a header in 2 files\n"} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+	manifestPath := "third_party/tool/" + pullrequest.ManifestName
+	e.merge(pr, []string{"third_party/tool/main.c", "third_party/tool/util.h", manifestPath}, nil)
+
+	// The transformed files are compared after they are transformed, so a change to only excluded files is nothing to sync
+	e.upstreamCommit("Add notes", map[string]string{"src/NOTES.md": "Notes\n"})
+	e.check()
+	if n := len(e.pullRequests()); n != 1 {
+		t.Fatalf("expected still 1 pull request, got %d", n)
+	}
+
+	e.upstreamCommit("Return 2", map[string]string{"src/main.c": "int main(void) { return 2; }\n"})
+	e.check()
+	prs = e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests, got %d", len(prs))
+	}
+	if !strings.Contains(prs[1].Body, "* Added a header in `main.c`\n") || strings.Contains(prs[1].Body, "util.h") {
+		t.Errorf("expected only main.c to be changed:\n%s", prs[1].Body)
+	}
+}
+
+func TestSyncRoot(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Mode = config.ModeSync
+		c.Repos[0].FilePath = "."
+		c.Repos[0].TargetPath = "third_party/tool"
+	})
+	e.upstreamCommit("Add util.h", map[string]string{"src/util.h": "int util(void);\n"})
+	e.check()
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 pull request, got %d", len(prs))
+	}
+	if pr := prs[0]; !githubfake.ValidRefName("refs/heads/"+pr.Head) || pr.Title != "Update upstream/tool to "+pr.Head[len(pr.Head)-7:] {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+	// The whole source repository is synced
+	for _, name := range []string{"README", "src/main.c", "src/util.h"} {
+		if _, ok := e.target.File(prs[0].Head, "third_party/tool/"+name); !ok {
+			t.Errorf("expected %s to be synced", name)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package systemd implements the parts of the systemd service protocols that vigilant uses:
+// readiness and status notifications and watchdog pings with sd_notify, and socket activation.
+// Everything is a no-op when vigilant is not started by systemd.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification states, see sd_notify(3)
+const (
+	Ready    = "READY=1"
+	Stopping = "STOPPING=1"
+	Watchdog = "WATCHDOG=1"
+)
+
+// listenFDsStart is the first file descriptor that systemd passes sockets in
+const listenFDsStart = 3
+
+// Status returns the notification that sets the status text that systemctl status shows
+func Status(text string) string {
+	return "STATUS=" + strings.ReplaceAll(text, "\n", " ")
+}
+
+// Notify sends a notification to the service manager, over the socket in $NOTIFY_SOCKET.
+// Several states can be given at once, separated by newlines. Returns false if there is no socket.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// A socket that starts with @ is in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("could not connect to the notification socket: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, fmt.Errorf("could not send a notification: %w", err)
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often the service manager expects a watchdog ping, from $WATCHDOG_USEC.
+// Returns false if the watchdog is not enabled for this process.
+func WatchdogInterval() (time.Duration, bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// Listeners returns the sockets that systemd passed to this process with socket activation,
+// as given by $LISTEN_PID and $LISTEN_FDS. The variables are unset, so that child processes
+// do not use the sockets too. Returns no listeners if the process was not socket activated.
+func Listeners() ([]net.Listener, error) {
+	return listeners(listenFDsStart)
+}
+
+// listeners returns the listeners for the $LISTEN_FDS file descriptors from firstFD
+func listeners(firstFD int) ([]net.Listener, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	var result []net.Listener
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("LISTEN_FD_%d", firstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(firstFD+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, ln := range result {
+				ln.Close()
+			}
+			return nil, fmt.Errorf("socket %s is not a listening socket: %w", name, err)
+		}
+		result = append(result, ln)
+	}
+	return result, nil
+}
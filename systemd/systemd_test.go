@@ -0,0 +1,100 @@
+//go:build unix
+
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeNotifySocket listens on a notification socket in a temporary directory, and sets $NOTIFY_SOCKET to it
+func fakeNotifySocket(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if sent, err := Notify(Ready); sent || err != nil {
+		t.Errorf("Notify without a socket = %v, %v", sent, err)
+	}
+
+	conn := fakeNotifySocket(t)
+	if sent, err := Notify(Ready + "\n" + Status("Checked\n2 watches")); !sent || err != nil {
+		t.Fatalf("Notify = %v, %v", sent, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(buf[:n]), "READY=1\nSTATUS=Checked 2 watches"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("the watchdog should be disabled")
+	}
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	if interval, ok := WatchdogInterval(); !ok || interval != 30*time.Second {
+		t.Errorf("WatchdogInterval() = %v, %v", interval, ok)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if _, ok := WatchdogInterval(); ok {
+		t.Error("the watchdog is for another process")
+	}
+}
+
+func TestListeners(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	if lns, err := Listeners(); len(lns) != 0 || err != nil {
+		t.Errorf("Listeners without socket activation = %v, %v", lns, err)
+	}
+
+	// Pass a socket like systemd does, but at the file descriptor that it happens to get
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := syscall.Dup(int(f.Fd()))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "control")
+	lns, err := listeners(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lns) != 1 || lns[0].Addr().String() != ln.Addr().String() {
+		t.Fatalf("unexpected listeners %v", lns)
+	}
+	lns[0].Close()
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("LISTEN_FDS should be unset")
+	}
+}
@@ -0,0 +1,133 @@
+package vigilant
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/githubfake"
+)
+
+func TestWatchFansOutToTargets(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].TargetRepoName = ""
+		c.Repos[0].Targets = []config.TargetConfig{
+			{RepoName: "distro/packages", Path: "tool/UPSTREAM.md"},
+			{RepoName: "distro/packages", BaseBranch: "stable", Path: "tool/UPSTREAM.md"},
+			{RepoName: "ports/tool", BaseBranch: "develop"},
+		}
+	})
+	e.target.Commit("stable", githubfake.Commit{Message: "Branch off stable", Files: map[string]string{"tool/PKGBUILD": "pkgname=tool\n"}})
+	ports := e.gh.AddRepo("ports/tool", "develop")
+	ports.Commit("develop", githubfake.Commit{Message: "Initial commit", Date: e.clock.Now().Add(-24 * time.Hour), Files: map[string]string{"README": "Port\n"}})
+
+	sha := e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 2 {
+		t.Fatalf("expected 2 pull requests in distro/packages, got %d", len(prs))
+	}
+	bases := map[string]bool{}
+	for _, pr := range prs {
+		bases[pr.Base] = true
+		if content, ok := e.target.File(pr.Head, "tool/UPSTREAM.md"); !ok || content != pr.Body {
+			t.Errorf("expected the body to be committed to tool/UPSTREAM.md on %s, got %q", pr.Head, content)
+		}
+	}
+	if !bases["main"] || !bases["stable"] {
+		t.Errorf("expected pull requests against main and stable, got %v", bases)
+	}
+	portPRs := ports.PullRequests()
+	if len(portPRs) != 1 || portPRs[0].Base != "develop" {
+		t.Fatalf("expected 1 pull request against develop in ports/tool, got %+v", portPRs)
+	}
+	if _, ok := ports.File(portPRs[0].Head, "src-main.c-updates.md"); !ok {
+		t.Error("expected the notification file at the default path")
+	}
+
+	// Every target keeps track of its own last synced commit
+	for _, watch := range e.engine.repoConfigs {
+		if got := e.engine.state.Watch(watch.Key()).LastSHA; got != sha {
+			t.Errorf("expected the last synced commit of %s to be %s, got %s", watch.Key(), sha, got)
+		}
+	}
+}
+
+func TestGroupCreatesCombinedPullRequest(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Group = "tool"
+		lib := c.Repos[0]
+		lib.FilePath = "lib/"
+		c.Repos = append(c.Repos, lib)
+	})
+	main := e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	lib := e.upstreamCommit("Add a library", map[string]string{"lib/tool.c": "int tool(void) { return 1; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 combined pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Title != "Update: Changes in src/main.c, lib/" || !strings.HasPrefix(pr.Head, "tool-update-") {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+	for _, want := range []string{"## `src/main.c` in upstream/tool", "Return 0", "## `lib/` in upstream/tool", "Add a library"} {
+		if !strings.Contains(pr.Body, want) {
+			t.Errorf("expected %q in the body:\n%s", want, pr.Body)
+		}
+	}
+	for _, path := range []string{"src-main.c-updates.md", "lib--updates.md"} {
+		if _, ok := e.target.File(pr.Head, path); !ok {
+			t.Errorf("expected %s on the branch", path)
+		}
+	}
+	for i, sha := range []string{main, lib} {
+		if got := e.engine.state.Watch(e.engine.repoConfigs[i].Key()).LastSHA; got != sha {
+			t.Errorf("expected the last synced commit of %s to be %s, got %s", e.engine.repoConfigs[i].FilePath, sha, got)
+		}
+	}
+
+	// A change to one watch supersedes the combined pull request
+	e.upstreamCommit("Add another function", map[string]string{"lib/tool.c": "int tool(void) { return 2; }\n"})
+	e.check()
+	prs = e.pullRequests()
+	if len(prs) != 2 || prs[0].State != "closed" {
+		t.Fatalf("expected the first pull request to be superseded, got %+v", prs)
+	}
+	if strings.Contains(prs[1].Body, "src/main.c") || !strings.Contains(prs[1].Body, "Add another function") {
+		t.Errorf("expected only the changed watch in the body:\n%s", prs[1].Body)
+	}
+}
+
+func TestGroupTemplates(t *testing.T) {
+	e := newTestEnv(t, func(c *config.Config) {
+		c.Repos[0].Group = "tool"
+		c.Templates = config.TemplateConfig{
+			Branch: "{{ with .Group }}{{ . }}{{ else }}{{ slug .Watch.FilePath }}{{ end }}-{{ short .HeadSHA }}",
+			Title:  "{{ with .Group }}Update the {{ . }} group ({{ len $.Members }} watches){{ else }}Update {{ .Watch.FilePath }}{{ end }}",
+			Body: "{{ if .Members }}{{ range .Members }}### {{ .Watch.FilePath }}\n{{ .Body }}{{ end }}" +
+				"{{ else }}{{ range .Commits }}- {{ safe (subject .Message) }}\n{{ end }}{{ end }}",
+		}
+		lib := c.Repos[0]
+		lib.FilePath = "lib/"
+		c.Repos = append(c.Repos, lib)
+	})
+	e.upstreamCommit("Return 0", map[string]string{"src/main.c": "int main(void) { return 0; }\n"})
+	e.upstreamCommit("Add a library", map[string]string{"lib/tool.c": "int tool(void) { return 1; }\n"})
+	e.check()
+
+	prs := e.pullRequests()
+	if len(prs) != 1 {
+		t.Fatalf("expected 1 combined pull request, got %d", len(prs))
+	}
+	pr := prs[0]
+	if pr.Title != "Update the tool group (2 watches)" || !strings.HasPrefix(pr.Head, "tool-") {
+		t.Errorf("unexpected pull request %+v", pr)
+	}
+	if want := "### src/main.c\n- Return 0\n### lib/\n- Add a library\n"; pr.Body != want {
+		t.Errorf("expected the body %q, got %q", want, pr.Body)
+	}
+}
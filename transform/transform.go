@@ -0,0 +1,185 @@
+// Package transform changes the contents of upstream files before they are committed to the target, with a
+// pipeline of regular expression replacements, headers and footers, line ending conversions and filter commands
+package transform
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/xyproto/vigilant/config"
+)
+
+// filterTimeout is how long a filter command can run for a single file
+const filterTimeout = time.Minute
+
+// Pipeline is the transforms of a watch, in the order that they are applied
+type Pipeline struct {
+	repo  string // the source repository
+	steps []step
+}
+
+// step is a transform, with its regular expression or text template
+type step struct {
+	config.TransformConfig
+	pattern *regexp.Regexp
+	text    *template.Template
+}
+
+// textData is the data that the text of a header or footer is rendered against
+type textData struct {
+	Repo string // the source repository, like owner/name
+	Path string // the path of the file in the source repository
+}
+
+// New returns the pipeline of the transforms of a watch
+func New(watch config.RepoConfig) (*Pipeline, error) {
+	p := &Pipeline{repo: watch.SourceRepoName}
+	for i, t := range watch.Transforms {
+		s := step{TransformConfig: t}
+		var err error
+		switch t.Type {
+		case config.TransformReplace:
+			s.pattern, err = regexp.Compile(t.Pattern)
+		case config.TransformPrepend, config.TransformAppend:
+			s.text, err = template.New("text").Option("missingkey=error").Parse(t.Text)
+		case config.TransformLineEndings, config.TransformFilter:
+		default:
+			err = fmt.Errorf("unknown type %q", t.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("transform %d: %w", i+1, err)
+		}
+		p.steps = append(p.steps, s)
+	}
+	return p, nil
+}
+
+// Len returns the number of transforms
+func (p *Pipeline) Len() int {
+	return len(p.steps)
+}
+
+// Transforms checks if any of the transforms changes the file with the given path, relative to the synced directory
+func (p *Pipeline) Transforms(rel string) bool {
+	for _, s := range p.steps {
+		if s.Transforms(rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply transforms a file, given by its path relative to the synced directory and its path in the source repository.
+// Returns the new content, and the indices of the transforms that changed it. Binary files are not transformed.
+func (p *Pipeline) Apply(ctx context.Context, rel, sourcePath string, content []byte) ([]byte, []int, error) {
+	if isBinary(content) {
+		return content, nil, nil
+	}
+	var applied []int
+	for i, s := range p.steps {
+		if !s.Transforms(rel) {
+			continue
+		}
+		result, err := s.apply(ctx, rel, textData{Repo: p.repo, Path: sourcePath}, content)
+		if err != nil {
+			return nil, nil, fmt.Errorf("transform %d (%s) of %s: %w", i+1, s.Type, rel, err)
+		}
+		if !bytes.Equal(result, content) {
+			applied = append(applied, i)
+		}
+		content = result
+	}
+	return content, applied, nil
+}
+
+// apply transforms the content of a single file
+func (s step) apply(ctx context.Context, rel string, data textData, content []byte) ([]byte, error) {
+	switch s.Type {
+	case config.TransformReplace:
+		return s.pattern.ReplaceAll(content, []byte(s.Replacement)), nil
+	case config.TransformPrepend, config.TransformAppend:
+		var b bytes.Buffer
+		if err := s.text.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		text := b.Bytes()
+		if s.Type == config.TransformPrepend {
+			if len(text) > 0 && text[len(text)-1] != '\n' {
+				text = append(text, '\n')
+			}
+			return append(text, content...), nil
+		}
+		result := append([]byte(nil), content...)
+		if len(result) > 0 && result[len(result)-1] != '\n' {
+			result = append(result, '\n')
+		}
+		return append(result, text...), nil
+	case config.TransformLineEndings:
+		lf := bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+		if s.LineEndings == "crlf" {
+			return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n")), nil
+		}
+		return lf, nil
+	case config.TransformFilter:
+		return s.filter(ctx, rel, data, content)
+	}
+	return nil, fmt.Errorf("unknown type %q", s.Type)
+}
+
+// filterEnv is the environment variables that filter commands get from vigilant. Others, like the token and the
+// passphrase of the signing key, are not passed on, since a filter command should not need them.
+var filterEnv = []string{"PATH", "HOME", "LANG"}
+
+// filter pipes the content of a file through the command of the transform. The command gets the path of the file
+// relative to the synced directory in $VIGILANT_FILE, and the source repository in $VIGILANT_SOURCE_REPO.
+func (s step) filter(ctx context.Context, rel string, data textData, content []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, filterTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Env = []string{"VIGILANT_FILE=" + rel, "VIGILANT_SOURCE_REPO=" + data.Repo}
+	for _, name := range filterEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	cmd.Stdin = bytes.NewReader(content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%s: %w: %s", s.Command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %w", s.Command[0], err)
+	}
+	return append([]byte{}, stdout.Bytes()...), nil
+}
+
+// Describe returns a description of the transform with the given index, for the pull request
+func (p *Pipeline) Describe(i int) string {
+	s := p.steps[i]
+	switch s.Type {
+	case config.TransformReplace:
+		return fmt.Sprintf("Replaced `%s` with `%s`", s.Pattern, s.Replacement)
+	case config.TransformPrepend:
+		return "Added a header"
+	case config.TransformAppend:
+		return "Added a footer"
+	case config.TransformLineEndings:
+		return "Converted the line endings to " + strings.ToUpper(s.LineEndings)
+	case config.TransformFilter:
+		return fmt.Sprintf("Filtered through `%s`", strings.Join(s.Command, " "))
+	}
+	return s.Type
+}
+
+// isBinary checks if content looks like a binary file, which has a NUL byte in the first 8000 bytes, like git checks
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
@@ -0,0 +1,102 @@
+package transform
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xyproto/vigilant/config"
+)
+
+func TestApply(t *testing.T) {
+	p, err := New(config.RepoConfig{
+		SourceRepoName: "madler/zlib",
+		Transforms: []config.TransformConfig{
+			{Type: config.TransformReplace, Files: []string{"*.c"}, Pattern: `#include "(\w+)\.h"`, Replacement: `#include "zlib/$1.h"`},
+			{Type: config.TransformPrepend, Text: "// Synced from {{ .Path }} in {{ .Repo }}"},
+			{Type: config.TransformAppend, Files: []string{"*.h"}, Text: "// End of file\n"},
+			{Type: config.TransformLineEndings, LineEndings: "lf"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, applied, err := p.Apply(context.Background(), "inflate.c", "src/inflate.c", []byte("#include \"zutil.h\"\r\nint x;\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// Synced from src/inflate.c in madler/zlib\n#include \"zlib/zutil.h\"\nint x;\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if !slices.Equal(applied, []int{0, 1, 3}) {
+		t.Errorf("unexpected transforms %v", applied)
+	}
+
+	got, applied, err = p.Apply(context.Background(), "zlib.h", "src/zlib.h", []byte("int inflate(void);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "// Synced from src/zlib.h in madler/zlib\nint inflate(void);\n// End of file\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if !slices.Equal(applied, []int{1, 2}) {
+		t.Errorf("unexpected transforms %v", applied)
+	}
+
+	// Binary files are left as they are
+	binary := []byte("\x00\x01#include \"zutil.h\"\r\n")
+	if got, applied, _ := p.Apply(context.Background(), "data.c", "src/data.c", binary); string(got) != string(binary) || applied != nil {
+		t.Errorf("expected the binary file to not be transformed, got %q", got)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	p, err := New(config.RepoConfig{Transforms: []config.TransformConfig{
+		{Type: config.TransformFilter, Command: []string{"sh", "-c", `tr a-z A-Z; echo "$VIGILANT_FILE"`}},
+		{Type: config.TransformLineEndings, LineEndings: "crlf"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := p.Apply(context.Background(), "dir/a.txt", "src/dir/a.txt", []byte("abc\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ABC\r\ndir/a.txt\r\n"; string(got) != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// The token is not passed on to filters
+	t.Setenv("GITHUB_TOKEN", "secret")
+	p, _ = New(config.RepoConfig{SourceRepoName: "madler/zlib", Transforms: []config.TransformConfig{
+		{Type: config.TransformFilter, Command: []string{"sh", "-c", `echo "$VIGILANT_SOURCE_REPO token=$GITHUB_TOKEN"`}},
+	}})
+	if got, _, err := p.Apply(context.Background(), "a.txt", "a.txt", []byte("abc\n")); err != nil || string(got) != "madler/zlib token=\n" {
+		t.Errorf("expected no token in the environment of the filter, got %q (%v)", got, err)
+	}
+
+	p, _ = New(config.RepoConfig{Transforms: []config.TransformConfig{{Type: config.TransformFilter, Command: []string{"sh", "-c", "echo broken >&2; exit 3"}}}})
+	if _, _, err := p.Apply(context.Background(), "a.txt", "a.txt", []byte("abc\n")); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected the error of the filter, got %v", err)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	p, err := New(config.RepoConfig{Transforms: []config.TransformConfig{
+		{Type: config.TransformReplace, Pattern: "foo", Replacement: "bar"},
+		{Type: config.TransformLineEndings, LineEndings: "crlf"},
+		{Type: config.TransformFilter, Command: []string{"clang-format", "-style=file"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"Replaced `foo` with `bar`", "Converted the line endings to CRLF", "Filtered through `clang-format -style=file`"} {
+		if got := p.Describe(i); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+	if _, err := New(config.RepoConfig{Transforms: []config.TransformConfig{{Type: config.TransformReplace, Pattern: "("}}}); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
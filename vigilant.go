@@ -0,0 +1,343 @@
+// Package vigilant watches files and directories in GitHub repositories,
+// and opens a pull request in a target repository when they change.
+//
+// An Engine is created from a validated configuration with New, and either checks all watches
+// once with CheckOnce, or schedules them at their poll intervals with Run:
+//
+//	cfg, err := config.Load("") // or the path of a configuration file
+//	if err != nil {
+//		return err
+//	}
+//	engine, err := vigilant.New(cfg)
+//	if err != nil {
+//		return err
+//	}
+//	if err := engine.CheckOnce(ctx); err != nil {
+//		return err
+//	}
+package vigilant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v50/github"
+	"github.com/xyproto/env/v2"
+	"github.com/xyproto/vigilant/config"
+	"github.com/xyproto/vigilant/lock"
+	"github.com/xyproto/vigilant/pullrequest"
+	"github.com/xyproto/vigilant/state"
+	"golang.org/x/oauth2"
+)
+
+// Engine checks the watches of a configuration for upstream changes, and creates pull requests for them
+type Engine struct {
+	githubClient      *github.Client
+	creator           *pullrequest.Creator
+	repoConfigs       []config.RepoConfig // the watches, with one watch per target
+	groups            [][]int             // the watches that are checked together, as indices in repoConfigs
+	state             *state.Store
+	stateDir          string // durable data, like the pull requests that have been created
+	cacheDir          string // disposable data, that can be deleted at any time
+	sincePath         string
+	token             string
+	logger            *slog.Logger
+	pollInterval      time.Duration
+	branchGracePeriod time.Duration
+	lastChecked       time.Time // the default for watches that have never created a pull request
+	workers           int
+	apiTimeout        time.Duration
+	shutdownTimeout   time.Duration
+	queue             chan int
+	jobs              jobSet
+	status            engineStatus
+	ready             sync.Once
+	dirLock           *lock.Lock  // the exclusive lock on the state directory, without leader election
+	lease             *lock.Lease // the lease on the shared state directory, with leader election
+	controlToken      string
+	webhookSecret     string
+	clock             func() time.Time // returns the current time, can be replaced in tests
+}
+
+// Option changes how an engine is set up
+type Option func(*Engine)
+
+// WithClient makes the engine use the given GitHub client, instead of one for $GITHUB_TOKEN
+func WithClient(client *github.Client) Option {
+	return func(e *Engine) {
+		e.githubClient = client
+	}
+}
+
+// WithToken makes the engine use the given GitHub token, instead of $GITHUB_TOKEN
+func WithToken(token string) Option {
+	return func(e *Engine) {
+		e.token = token
+	}
+}
+
+// WithClock makes the engine use the given function to get the current time
+func WithClock(clock func() time.Time) Option {
+	return func(e *Engine) {
+		e.clock = clock
+	}
+}
+
+// WithStateDir makes the engine keep its state in the given directory, instead of the configured state_dir
+func WithStateDir(dir string) Option {
+	return func(e *Engine) {
+		e.stateDir = dir
+	}
+}
+
+// WithCacheDir makes the engine keep disposable data in the given directory, instead of the configured cache_dir
+func WithCacheDir(dir string) Option {
+	return func(e *Engine) {
+		e.cacheDir = dir
+	}
+}
+
+// WithLogger makes the engine log to the given logger, instead of slog.Default()
+func WithLogger(logger *slog.Logger) Option {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// New sets up a GitHub client and loads the state, given a configuration that has been validated with Validate
+func New(cfg *config.Config, opts ...Option) (*Engine, error) {
+	watches := cfg.Watches()
+	groups := groupWatches(watches)
+	e := &Engine{
+		repoConfigs:       watches,
+		groups:            groups,
+		pollInterval:      time.Duration(cfg.PollInterval) * time.Minute,
+		branchGracePeriod: time.Duration(cfg.BranchGracePeriod) * time.Hour,
+		workers:           cfg.Workers,
+		apiTimeout:        time.Duration(cfg.APITimeout) * time.Second,
+		shutdownTimeout:   time.Duration(cfg.ShutdownTimeout) * time.Second,
+		queue:             make(chan int, len(groups)+1),
+		controlToken:      cfg.Control.Token,
+		webhookSecret:     cfg.Control.WebhookSecret,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.logger == nil {
+		e.logger = slog.Default()
+	}
+
+	// Check the templates of all watches up front, so that problems are found at startup
+	for _, repo := range watches {
+		if _, err := pullrequest.ParseTemplates(repo.Templates.Merge(cfg.Templates)); err != nil {
+			return nil, fmt.Errorf("invalid template for %s: %w", repo.SourceRepoName, err)
+		}
+	}
+
+	// Release the lock on the state directory if anything fails after it was taken
+	if err := e.setup(cfg); err != nil {
+		e.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// setup sets up the directories, the state, the GitHub client and the pull request creator
+func (e *Engine) setup(cfg *config.Config) error {
+	if err := e.setupDirs(cfg); err != nil {
+		return err
+	}
+	e.sincePath = filepath.Join(e.stateDir, "since.timestamp")
+
+	store, err := state.Open(filepath.Join(e.stateDir, "state.json"))
+	if err != nil {
+		return fmt.Errorf("error loading state: %w", err)
+	}
+	e.state = store
+
+	if err := e.setupClient(); err != nil {
+		return err
+	}
+
+	e.creator = pullrequest.New(e.githubClient, e.state, cfg)
+	e.creator.Now = e.now
+	e.creator.Logger = e.logger
+	if err := e.creator.LoadSigningKeys(); err != nil {
+		return err
+	}
+
+	e.initSinceFile()
+	return nil
+}
+
+// setupDirs creates the state and cache directories, which are given as options, configured, or the defaults,
+// and moves the state from where older versions kept it
+func (e *Engine) setupDirs(cfg *config.Config) error {
+	defaultState := false
+	if e.stateDir == "" {
+		e.stateDir = cfg.StateDir
+	}
+	if e.stateDir == "" {
+		dir, err := DefaultStateDir()
+		if err != nil {
+			return err
+		}
+		e.stateDir, defaultState = dir, true
+	}
+	if e.cacheDir == "" {
+		e.cacheDir = cfg.CacheDir
+	}
+	if e.cacheDir == "" {
+		dir, err := DefaultCacheDir()
+		if err != nil {
+			return err
+		}
+		e.cacheDir = dir
+	}
+	if err := os.MkdirAll(e.stateDir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := os.MkdirAll(e.cacheDir, 0700); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	// Instances that share a state directory take turns with a lease, otherwise only one instance can use it
+	if le := cfg.LeaderElection; le.Enabled {
+		id := le.ID
+		if id == "" {
+			id = lock.DefaultHolder()
+		}
+		e.lease = lock.NewLease(e.stateDir, id, time.Duration(le.LeaseDuration)*time.Second)
+	} else {
+		dirLock, err := lock.Acquire(e.stateDir)
+		if err != nil {
+			return err
+		}
+		e.dirLock = dirLock
+	}
+
+	// Older versions kept the state in the cache directory, which was always ~/.cache/vigilant
+	// or ~/Library/Caches/vigilant. It is only looked for there if the state directory is the default.
+	oldDirs := []string{e.cacheDir}
+	if home, err := os.UserHomeDir(); err == nil && defaultState {
+		switch runtime.GOOS {
+		case "darwin":
+			oldDirs = append(oldDirs, filepath.Join(home, "Library", "Caches", "vigilant"))
+		case "linux":
+			oldDirs = append(oldDirs, filepath.Join(home, ".cache", "vigilant"))
+		}
+	}
+	return e.migrateState(e.stateDir, oldDirs...)
+}
+
+// Close releases the lock on the state directory, or the lease if this instance is the leader
+func (e *Engine) Close() error {
+	var errs []error
+	if e.lease != nil {
+		errs = append(errs, e.lease.Release())
+	}
+	if e.dirLock != nil {
+		errs = append(errs, e.dirLock.Release())
+	}
+	return errors.Join(errs...)
+}
+
+// now returns the current time
+func (e *Engine) now() time.Time {
+	if e.clock != nil {
+		return e.clock()
+	}
+	return time.Now()
+}
+
+// groupWatches groups the watches that share pull requests, in the order of their first watch
+func groupWatches(watches []config.RepoConfig) [][]int {
+	var groups [][]int
+	index := make(map[string]int)
+	for i, watch := range watches {
+		if g, ok := index[watch.GroupKey()]; ok {
+			groups[g] = append(groups[g], i)
+			continue
+		}
+		index[watch.GroupKey()] = len(groups)
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+// watchLogger returns a logger that adds the attributes of a watch to every message
+func (e *Engine) watchLogger(watch config.RepoConfig) *slog.Logger {
+	return e.logger.With("source", watch.SourceRepoName, "path", watch.FilePath, "target", watch.TargetRepoName)
+}
+
+func (e *Engine) initSinceFile() {
+	// Check if since.timestamp exists
+	if _, err := os.Stat(e.sincePath); os.IsNotExist(err) {
+		// Create default since.timestamp with current time
+		e.logger.Info("Creating default since.timestamp", "path", e.sincePath)
+		e.lastChecked = e.now()
+		e.updateSinceInCache()
+	} else {
+		// Load existing since.timestamp
+		e.loadSinceValue()
+	}
+}
+
+func (e *Engine) loadSinceValue() {
+	data, err := os.ReadFile(e.sincePath)
+	if err != nil {
+		e.logger.Warn("Could not read since.timestamp, assuming first run", "error", err)
+		e.lastChecked = e.now()
+		return
+	}
+
+	e.lastChecked, err = time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		e.logger.Warn("Could not parse since.timestamp, using the current time", "error", err)
+		e.lastChecked = e.now()
+	}
+}
+
+func (e *Engine) updateSinceInCache() {
+	// Write the lastChecked time to since.timestamp
+	data := e.lastChecked.Format(time.RFC3339)
+	if err := os.WriteFile(e.sincePath, []byte(data), 0644); err != nil {
+		e.logger.Error("Could not write since.timestamp", "path", e.sincePath, "error", err)
+	} else {
+		e.logger.Info("Updated the last checked time in since.timestamp", "time", data)
+	}
+}
+
+// setupClient creates a GitHub client for GITHUB_TOKEN from the environment, unless a client or a token was given
+func (e *Engine) setupClient() error {
+	if e.githubClient != nil {
+		return nil
+	}
+	if e.token == "" {
+		e.token = env.Str("GITHUB_TOKEN", "")
+	}
+	if e.token == "" {
+		return errors.New("GITHUB_TOKEN environment variable is required")
+	}
+	e.githubClient = newGitHubClient(e.token, e.apiTimeout)
+	return nil
+}
+
+// newGitHubClient returns a GitHub client where every API call times out after the given duration
+func newGitHubClient(token string, timeout time.Duration) *github.Client {
+	ctx := context.Background()
+	ts := oauth2.StaticTokenSource(
+		&oauth2.Token{AccessToken: token},
+	)
+	tc := oauth2.NewClient(ctx, ts)
+	tc.Timeout = timeout
+	return github.NewClient(tc)
+}